@@ -59,3 +59,7 @@ func DownloadJSON(c *gin.Context) {
 		c.JSON(200, err.Error())
 	}
 }
+
+func GatewayHealth(c *gin.Context) {
+	c.JSON(200, service.GatewayHealth())
+}
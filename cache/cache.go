@@ -23,7 +23,6 @@ func Redis(address string, password string) error {
 		// log connecting to redis failed
 		log.Error("redis init err : ", err)
 		panic("redis error")
-		return err
 	}
 	client.SAdd("api_key", "VV6I9K4T1XB9HEZ187XJI51AR2FT8CJ8VV", 0)
 	client.SAdd("api_key", "CB3C47F716DC464EF5FB93941FBC8BBD95", 0)
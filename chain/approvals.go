@@ -0,0 +1,418 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"math/big"
+	"spike-blockchain-server/chain/contract"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	approvalsPrefix         = "approvals_"
+	approvalsBackfillPrefix = "approvals_backfill_"
+)
+
+const (
+	approvalAllowance = "allowance"
+	approvalOperator  = "operator"
+	approvalToken     = "token"
+)
+
+// unlimitedAllowance is where wallets and dapps start to mean "max".
+var unlimitedAllowance = new(big.Int).Lsh(big.NewInt(1), 255)
+
+type TokenApproval struct {
+	Token              string   `json:"token"`
+	Contract           string   `json:"contract"`
+	Symbol             string   `json:"symbol,omitempty"`
+	Kind               string   `json:"kind"`
+	Spender            string   `json:"spender"`
+	TokenId            string   `json:"tokenId,omitempty"`
+	Allowance          string   `json:"allowance,omitempty"`
+	FormattedAllowance string   `json:"formattedAllowance,omitempty"`
+	Unlimited          bool     `json:"unlimited,omitempty"`
+	BlockNumber        uint64   `json:"blockNumber"`
+	Revoke             RevokeTx `json:"revoke"`
+}
+
+// RevokeTx is the unsigned transaction that sets the approval back to zero.
+type RevokeTx struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Data    string `json:"data"`
+	Value   string `json:"value"`
+	ChainId string `json:"chainId"`
+}
+
+type approvalsService struct {
+	Address string `form:"address" json:"address" binding:"required"`
+}
+
+// approvalKey is a field of the approvals_<owner> hash, the value is the
+// block of the last Approval event seen for it.
+type approvalKey struct {
+	tp      TokenType
+	spender common.Address
+	tokenId *big.Int
+}
+
+func (k approvalKey) String() string {
+	if k.tokenId != nil {
+		return fmt.Sprintf("%s:%s:%s", k.tp.String(), strings.ToLower(k.spender.Hex()), k.tokenId.String())
+	}
+	return fmt.Sprintf("%s:%s", k.tp.String(), strings.ToLower(k.spender.Hex()))
+}
+
+func parseApprovalKey(s string) (approvalKey, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || !common.IsHexAddress(parts[1]) {
+		return approvalKey{}, false
+	}
+	k := approvalKey{spender: common.HexToAddress(parts[1])}
+	found := false
+	for _, tp := range approvalTokens() {
+		if tp.String() == parts[0] {
+			k.tp, found = tp, true
+		}
+	}
+	if !found {
+		return approvalKey{}, false
+	}
+	if len(parts) == 3 {
+		tokenId, ok := new(big.Int).SetString(parts[2], 10)
+		if !ok || k.tp != gameNft {
+			return approvalKey{}, false
+		}
+		k.tokenId = tokenId
+	}
+	return k, true
+}
+
+func (k approvalKey) kind() string {
+	switch {
+	case k.tp != gameNft:
+		return approvalAllowance
+	case k.tokenId != nil:
+		return approvalToken
+	default:
+		return approvalOperator
+	}
+}
+
+func approvalTokens() []TokenType {
+	return []TokenType{governanceToken, gameToken, usdc, gameNft}
+}
+
+func approvalContract(tp TokenType) string {
+	switch tp {
+	case governanceToken:
+		return config.Cfg.Contract.GovernanceTokenAddress
+	case gameToken:
+		return config.Cfg.Contract.GameTokenAddress
+	case usdc:
+		return config.Cfg.Contract.UsdcAddress
+	case gameNft:
+		return config.Cfg.Contract.GameNftAddress
+	}
+	return ""
+}
+
+// ApprovalIndex keeps, per owner, the spenders and operators it ever approved
+// on our tokens and nft. The index only names candidates, every listed
+// approval is read back from the contract and stale ones are dropped.
+// The tokens and nft are backfilled from their deploy block, usdc is shared
+// with the whole chain and only indexed from the live events.
+type ApprovalIndex struct {
+	ec      *ethclient.Client
+	rpc     *rpc.Client
+	rc      *redis.Client
+	tokens  *TokenRegistry
+	chainId *big.Int
+	erc20   abi.ABI
+	nft     abi.ABI
+}
+
+func newApprovalIndex(ec *ethclient.Client, rpcClient *rpc.Client, rc *redis.Client, tokens *TokenRegistry, chainId *big.Int) *ApprovalIndex {
+	return &ApprovalIndex{
+		ec:      ec,
+		rpc:     rpcClient,
+		rc:      rc,
+		tokens:  tokens,
+		chainId: chainId,
+		erc20:   getABI(GameTokenABI),
+		nft:     getABI(GameNftABI),
+	}
+}
+
+func (ai *ApprovalIndex) mappings(tp TokenType) map[string]EventMapping {
+	handle := func(ev *DecodedEvent) {
+		if ev.Stage != stageFinalized.String() {
+			return
+		}
+		ai.apply(tp, ev.Event, ev.decodedArgs, ev.BlockNumber)
+	}
+	if tp == gameNft {
+		return map[string]EventMapping{
+			"Approval":       {Handle: handle},
+			"ApprovalForAll": {Handle: handle},
+		}
+	}
+	return map[string]EventMapping{
+		"Approval": {Handle: handle},
+	}
+}
+
+func (ai *ApprovalIndex) apply(tp TokenType, event string, args decodedArgs, blockNumber uint64) {
+	var (
+		owner common.Address
+		key   = approvalKey{tp: tp}
+		set   bool
+	)
+	switch {
+	case event == "ApprovalForAll":
+		owner, key.spender = args.Address("owner"), args.Address("operator")
+		set, _ = args.Arg("approved").(bool)
+	case tp == gameNft:
+		owner, key.spender, key.tokenId = args.Address("owner"), args.Address("approved"), args.BigInt("tokenId")
+		set = key.spender != emptyAddr
+	default:
+		owner, key.spender = args.Address("owner"), args.Address("spender")
+		set = args.BigInt("value").Sign() > 0
+	}
+	hash := approvalsPrefix + strings.ToLower(owner.Hex())
+	if prev, err := ai.rc.HGet(hash, key.String()).Uint64(); err == nil && prev > blockNumber {
+		return
+	}
+	if set {
+		ai.rc.HSet(hash, key.String(), blockNumber)
+	} else if key.tokenId == nil {
+		ai.rc.HDel(hash, key.String())
+	}
+}
+
+// backfill replays the Approval logs of the contracts with a deploy block up
+// to the finalized block, resuming from where an earlier run stopped.
+func (ai *ApprovalIndex) backfill() {
+	head, err := ai.ec.BlockNumber(context.Background())
+	for err != nil {
+		log.Error("query now blockNum err : ", err)
+		time.Sleep(time.Second)
+		head, err = ai.ec.BlockNumber(context.Background())
+	}
+	to := queryFinalizedHeight(ai.rpc, new(big.Int).SetUint64(head)).Uint64()
+	for tp, deployBlock := range map[TokenType]uint64{
+		governanceToken: config.Cfg.Contract.GovernanceTokenDeployBlock,
+		gameToken:       config.Cfg.Contract.GameTokenDeployBlock,
+		gameNft:         config.Cfg.Contract.GameNftDeployBlock,
+	} {
+		if deployBlock == 0 {
+			log.Infof("approvals backfill of %s skipped, no deploy block", tp.String())
+			continue
+		}
+		ai.backfillToken(tp, deployBlock, to)
+	}
+}
+
+func (ai *ApprovalIndex) backfillToken(tp TokenType, from, to uint64) {
+	contractAbi := ai.erc20
+	if tp == gameNft {
+		contractAbi = ai.nft
+	}
+	events := make(map[common.Hash]abi.Event)
+	ids := make([]common.Hash, 0, 2)
+	for name := range ai.mappings(tp) {
+		events[contractAbi.Events[name].ID] = contractAbi.Events[name]
+		ids = append(ids, contractAbi.Events[name].ID)
+	}
+	cursorKey := approvalsBackfillPrefix + tp.String()
+	if cursor, err := ai.rc.Get(cursorKey).Uint64(); err == nil {
+		from = cursor + 1
+	}
+	for from <= to {
+		end := from + ownerBackfillStep - 1
+		if end > to {
+			end = to
+		}
+		logs, err := ai.ec.FilterLogs(context.Background(), ethereum.FilterQuery{
+			Addresses: []common.Address{common.HexToAddress(approvalContract(tp))},
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Topics:    [][]common.Hash{ids},
+		})
+		if err != nil {
+			log.Errorf("approvals backfill err : %+v, token : %s, from : %d, to : %d", err, tp.String(), from, end)
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, l := range logs {
+			event := events[l.Topics[0]]
+			args, err := decodeLog(event, l)
+			if err != nil {
+				log.Errorf("approvals backfill unpack err : %+v, txHash : %s", err, l.TxHash)
+				continue
+			}
+			ai.apply(tp, event.Name, args, l.BlockNumber)
+		}
+		ai.rc.Set(cursorKey, strconv.FormatUint(end, 10), 0)
+		from = end + 1
+	}
+	log.Infof("approvals backfill of %s done, blockNum : %d", tp.String(), to)
+}
+
+// approvalsOf lists the approvals of owner that are still live on chain.
+func (ai *ApprovalIndex) approvalsOf(owner common.Address) ([]TokenApproval, error) {
+	hash := approvalsPrefix + strings.ToLower(owner.Hex())
+	fields, err := ai.rc.HGetAll(hash).Result()
+	if err != nil {
+		return nil, err
+	}
+	approvals := make([]TokenApproval, 0, len(fields))
+	for field, block := range fields {
+		key, ok := parseApprovalKey(field)
+		if !ok {
+			ai.rc.HDel(hash, field)
+			continue
+		}
+		approval, live, err := ai.verify(owner, key)
+		if err != nil {
+			return nil, err
+		}
+		if !live {
+			ai.rc.HDel(hash, field)
+			continue
+		}
+		approval.BlockNumber, _ = strconv.ParseUint(block, 10, 64)
+		approvals = append(approvals, approval)
+	}
+	return approvals, nil
+}
+
+// verify reads the approval back from the contract, live is false once it
+// was revoked, spent or the nft changed hands.
+func (ai *ApprovalIndex) verify(owner common.Address, key approvalKey) (TokenApproval, bool, error) {
+	contractAddr := common.HexToAddress(approvalContract(key.tp))
+	approval := TokenApproval{
+		Token:    key.tp.String(),
+		Contract: contractAddr.Hex(),
+		Kind:     key.kind(),
+		Spender:  key.spender.Hex(),
+	}
+	var data []byte
+	var packErr error
+	switch approval.Kind {
+	case approvalAllowance:
+		erc20, err := contract.NewGameToken(contractAddr, ai.ec)
+		if err != nil {
+			return approval, false, err
+		}
+		allowance, err := erc20.Allowance(nil, owner, key.spender)
+		if err != nil {
+			return approval, false, err
+		}
+		if allowance.Sign() == 0 {
+			return approval, false, nil
+		}
+		approval.Allowance = allowance.String()
+		approval.FormattedAllowance, _ = ai.tokens.formatAmount(key.tp, allowance)
+		approval.Unlimited = allowance.Cmp(unlimitedAllowance) >= 0
+		if info, err := ai.tokens.get(key.tp); err == nil {
+			approval.Symbol = info.Symbol
+		}
+		data, packErr = ai.erc20.Pack("approve", key.spender, big.NewInt(0))
+	case approvalOperator:
+		nft, err := contract.NewGameNft(contractAddr, ai.ec)
+		if err != nil {
+			return approval, false, err
+		}
+		approved, err := nft.IsApprovedForAll(nil, owner, key.spender)
+		if err != nil || !approved {
+			return approval, false, err
+		}
+		data, packErr = ai.nft.Pack("setApprovalForAll", key.spender, false)
+	case approvalToken:
+		nft, err := contract.NewGameNft(contractAddr, ai.ec)
+		if err != nil {
+			return approval, false, err
+		}
+		tokenOwner, err := nft.OwnerOf(nil, key.tokenId)
+		if err != nil {
+			// a burned token reverts ownerOf, the approval went with it
+			if executionReverted(err) {
+				return approval, false, nil
+			}
+			return approval, false, err
+		}
+		if tokenOwner != owner {
+			return approval, false, nil
+		}
+		approved, err := nft.GetApproved(nil, key.tokenId)
+		if err != nil || approved != key.spender {
+			return approval, false, err
+		}
+		approval.TokenId = key.tokenId.String()
+		data, packErr = ai.nft.Pack("approve", emptyAddr, key.tokenId)
+	}
+	if packErr != nil {
+		return approval, false, packErr
+	}
+	approval.Revoke = RevokeTx{
+		From:    owner.Hex(),
+		To:      contractAddr.Hex(),
+		Data:    hexutil.Encode(data),
+		Value:   "0",
+		ChainId: ai.chainId.String(),
+	}
+	return approval, true, nil
+}
+
+// executionReverted tells a call the contract reverted from a node or
+// transport error, only the former says something about the token.
+func executionReverted(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == 3 {
+		return true
+	}
+	return strings.Contains(err.Error(), "execution reverted")
+}
+
+func (bl *BscListener) QueryWalletApprovals(c *gin.Context) {
+	var service approvalsService
+	if err := c.ShouldBind(&service); err == nil && common.IsHexAddress(service.Address) {
+		res := bl.queryWalletApprovals(service.Address)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) queryWalletApprovals(address string) serializer.Response {
+	approvals, err := bl.approvals.approvalsOf(common.HexToAddress(address))
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Msg:   "chain node err ",
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: approvals,
+	}
+}
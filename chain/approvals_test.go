@@ -0,0 +1,56 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApprovalKey(t *testing.T) {
+	spender := common.HexToAddress("0x10ED43C718714eb63d5aA57B78B54704E256024E")
+	for _, key := range []approvalKey{
+		{tp: gameToken, spender: spender},
+		{tp: gameNft, spender: spender},
+		{tp: gameNft, spender: spender, tokenId: big.NewInt(42)},
+	} {
+		parsed, ok := parseApprovalKey(key.String())
+		assert.True(t, ok)
+		assert.Equal(t, key.String(), parsed.String())
+		assert.Equal(t, key.kind(), parsed.kind())
+	}
+	assert.Equal(t, approvalAllowance, approvalKey{tp: usdc}.kind())
+	assert.Equal(t, approvalOperator, approvalKey{tp: gameNft}.kind())
+
+	_, ok := parseApprovalKey("bnb:" + spender.Hex())
+	assert.False(t, ok)
+	_, ok = parseApprovalKey("gameToken:" + spender.Hex() + ":1")
+	assert.False(t, ok)
+	_, ok = parseApprovalKey("gameNft:0x01:1")
+	assert.False(t, ok)
+}
+
+type codeErr struct{ code int }
+
+func (e codeErr) Error() string  { return "reverted" }
+func (e codeErr) ErrorCode() int { return e.code }
+
+func TestExecutionReverted(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		reverted bool
+	}{
+		{errors.New("execution reverted: ERC721: invalid token ID"), true},
+		{errors.New("execution reverted"), true},
+		{fmt.Errorf("call ownerOf: %w", codeErr{code: 3}), true},
+		{codeErr{code: -32000}, false},
+		{errors.New("dial tcp 127.0.0.1:8545: connect: connection refused"), false},
+		{context.DeadlineExceeded, false},
+	} {
+		assert.Equal(t, tc.reverted, executionReverted(tc.err), tc.err.Error())
+	}
+}
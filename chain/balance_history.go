@@ -0,0 +1,235 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/go-redis/redis"
+	"math/big"
+	"spike-blockchain-server/serializer"
+	"strconv"
+	"strings"
+)
+
+const (
+	blockTimeKey       = "block_time"
+	transferReplayStep = 5000
+	// transferReplayMax is about a week of bsc blocks.
+	transferReplayMax = 201600
+)
+
+var (
+	ErrorNoArchive    = errors.New("historical bnb balance needs an archive node")
+	ErrorReplayTooFar = errors.New("block is too old to rebuild its balance without an archive node")
+)
+
+type HistoricalBalance struct {
+	BlockNumber uint64        `json:"blockNumber"`
+	Timestamp   uint64        `json:"timestamp"`
+	Balances    []balanceShow `json:"balances"`
+}
+
+// BlockTimeIndex resolves timestamps to blocks by binary search over headers,
+// the header times it reads are kept in redis.
+type BlockTimeIndex struct {
+	ec *ethclient.Client
+	rc *redis.Client
+}
+
+func newBlockTimeIndex(ec *ethclient.Client, rc *redis.Client) *BlockTimeIndex {
+	return &BlockTimeIndex{
+		ec: ec,
+		rc: rc,
+	}
+}
+
+func (bi *BlockTimeIndex) timeOf(number uint64) (uint64, error) {
+	field := strconv.FormatUint(number, 10)
+	if t, err := bi.rc.HGet(blockTimeKey, field).Uint64(); err == nil {
+		return t, nil
+	}
+	header, err := bi.ec.HeaderByNumber(context.Background(), new(big.Int).SetUint64(number))
+	if err != nil {
+		return 0, err
+	}
+	bi.rc.HSet(blockTimeKey, field, header.Time)
+	return header.Time, nil
+}
+
+// blockAt returns the last block whose time is at or before ts.
+func (bi *BlockTimeIndex) blockAt(ts uint64) (uint64, error) {
+	head, err := bi.ec.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if head.Time <= ts {
+		return head.Number.Uint64(), nil
+	}
+	genesis, err := bi.timeOf(0)
+	if err != nil {
+		return 0, err
+	}
+	if ts < genesis {
+		return 0, errors.New("timestamp is before the genesis block")
+	}
+	lo, hi := uint64(0), head.Number.Uint64()
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		t, err := bi.timeOf(mid)
+		if err != nil {
+			return 0, err
+		}
+		if t <= ts {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// missingState reports whether err is the node answering that it has pruned
+// the state of the block.
+func missingState(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "missing trie node") || strings.Contains(msg, "state is not available") || strings.Contains(msg, "state not available")
+}
+
+// balancesAt reads balances at block from the archive node. When the node
+// has pruned that state the token balances of the last transferReplayMax
+// blocks are rebuilt from the latest ones by replaying the Transfer logs
+// after block backwards, bnb can not be.
+func (bl *BscListener) balancesAt(owner common.Address, tokens []balanceToken, block uint64) ([]balanceShow, error) {
+	balances, err := bl.archive.balances([]common.Address{owner}, tokens, new(big.Int).SetUint64(block))
+	if err == nil {
+		return balances[0].Balances, nil
+	}
+	if !missingState(err) {
+		return nil, err
+	}
+	log.Warnf("query archive balance at %d err : %+v, replay transfers", block, err)
+
+	head, err := bl.ec.BlockNumber(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if block > head {
+		return nil, errors.New("block is in the future")
+	}
+	if head-block > transferReplayMax {
+		return nil, ErrorReplayTooFar
+	}
+	for _, token := range tokens {
+		if token.tp == bnb {
+			return nil, ErrorNoArchive
+		}
+	}
+	shows := make([]balanceShow, 0, len(tokens))
+	for _, token := range tokens {
+		latest, err := bl.balances.balances([]common.Address{owner}, []balanceToken{token}, new(big.Int).SetUint64(head))
+		if err != nil {
+			return nil, err
+		}
+		raw, _ := new(big.Int).SetString(latest[0].Balances[0].Raw, 10)
+		delta, err := bl.transferDelta(common.HexToAddress(bl.tokens.configs[token.tp]), owner, block+1, head)
+		if err != nil {
+			return nil, err
+		}
+		raw.Sub(raw, delta)
+		formatted, decimals := bl.tokens.formatAmount(token.tp, raw)
+		shows = append(shows, balanceShow{
+			Symbol:   token.symbol,
+			Balance:  formatted,
+			Raw:      raw.String(),
+			Decimals: decimals,
+		})
+	}
+	return shows, nil
+}
+
+// transferDelta is what owner received minus what it sent of token within
+// [from, to].
+func (bl *BscListener) transferDelta(token, owner common.Address, from, to uint64) (*big.Int, error) {
+	delta := new(big.Int)
+	transfer := common.HexToHash(EventSignHash(TransferTopic))
+	ownerTopic := common.BytesToHash(owner.Bytes())
+	for start := from; start <= to; start += transferReplayStep {
+		end := start + transferReplayStep - 1
+		if end > to {
+			end = to
+		}
+		for _, topics := range [][][]common.Hash{
+			{{transfer}, {ownerTopic}},
+			{{transfer}, nil, {ownerTopic}},
+		} {
+			logs, err := bl.ec.FilterLogs(context.Background(), ethereum.FilterQuery{
+				Addresses: []common.Address{token},
+				FromBlock: new(big.Int).SetUint64(start),
+				ToBlock:   new(big.Int).SetUint64(end),
+				Topics:    topics,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, l := range logs {
+				if len(l.Topics) != 3 || l.Removed {
+					continue
+				}
+				value := new(big.Int).SetBytes(l.Data)
+				if l.Topics[2] == ownerTopic {
+					delta.Add(delta, value)
+				}
+				if l.Topics[1] == ownerTopic {
+					delta.Sub(delta, value)
+				}
+			}
+		}
+	}
+	return delta, nil
+}
+
+func (bl *BscListener) queryHistoricalBalance(service walletBalanceService) serializer.Response {
+	tokens, err := parseBalanceTokens(service.Tokens)
+	if err != nil || !common.IsHexAddress(service.Address) {
+		return serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		}
+	}
+	var block uint64
+	if service.BlockNumber != nil {
+		block = *service.BlockNumber
+	} else if block, err = bl.blockTimes.blockAt(service.Timestamp); err != nil {
+		return serializer.Response{
+			Code:  500,
+			Msg:   "chain node err ",
+			Error: err.Error(),
+		}
+	}
+	blockTime, err := bl.blockTimes.timeOf(block)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Msg:   "chain node err ",
+			Error: err.Error(),
+		}
+	}
+	balances, err := bl.balancesAt(common.HexToAddress(service.Address), tokens, block)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Msg:   err.Error(),
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: HistoricalBalance{
+			BlockNumber: block,
+			Timestamp:   blockTime,
+			Balances:    balances,
+		},
+	}
+}
@@ -0,0 +1,310 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+	"math/big"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+	"strings"
+)
+
+const (
+	defaultMulticall3   = "0xcA11bde05977b3631167028862bE2a173976CA11"
+	maxBalanceAddresses = 500
+	balanceBatchSize    = 500
+)
+
+type balanceToken struct {
+	tp     TokenType
+	symbol string
+}
+
+type WalletBalance struct {
+	Address  string        `json:"address"`
+	Balances []balanceShow `json:"balances"`
+}
+
+type balancesService struct {
+	Addresses []string `json:"addresses" binding:"required"`
+	// Tokens are symbols (skk, sks, usdc, bnb), all of them when empty.
+	Tokens      []string `json:"tokens"`
+	BlockNumber uint64   `json:"blockNumber"`
+}
+
+type multicallCall struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicallResult struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// balanceCall reads the balance of owner, from the token contract or with
+// getEthBalance for bnb.
+type balanceCall struct {
+	owner  common.Address
+	token  common.Address
+	native bool
+}
+
+func balanceTokens() []balanceToken {
+	return []balanceToken{
+		{tp: governanceToken, symbol: "SKK"},
+		{tp: gameToken, symbol: "SKS"},
+		{tp: usdc, symbol: "USDC"},
+		{tp: bnb, symbol: "BNB"},
+	}
+}
+
+func parseBalanceTokens(symbols []string) ([]balanceToken, error) {
+	if len(symbols) == 0 {
+		return balanceTokens(), nil
+	}
+	tokens := make([]balanceToken, 0, len(symbols))
+	for _, symbol := range symbols {
+		found := false
+		for _, token := range balanceTokens() {
+			if strings.EqualFold(token.symbol, symbol) {
+				tokens = append(tokens, token)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("token %s is not supported", symbol)
+		}
+	}
+	return tokens, nil
+}
+
+// BalanceReader reads the balances of many wallets in one round trip with
+// Multicall3, and with a batch of eth_call where Multicall3 is not deployed
+// yet at the requested block.
+type BalanceReader struct {
+	ec        *ethclient.Client
+	rpc       *rpc.Client
+	tokens    *TokenRegistry
+	multicall common.Address
+	mcAbi     abi.ABI
+	erc20     abi.ABI
+}
+
+func newBalanceReader(ec *ethclient.Client, rpcClient *rpc.Client, tokens *TokenRegistry) *BalanceReader {
+	multicall := config.Cfg.Contract.Multicall3Address
+	if multicall == "" {
+		multicall = defaultMulticall3
+	}
+	return &BalanceReader{
+		ec:        ec,
+		rpc:       rpcClient,
+		tokens:    tokens,
+		multicall: common.HexToAddress(multicall),
+		mcAbi:     getABI(Multicall3ABI),
+		erc20:     getABI(GameTokenABI),
+	}
+}
+
+// balances returns the balances of every owner in tokens order, block nil is
+// the latest block.
+func (br *BalanceReader) balances(owners []common.Address, tokens []balanceToken, block *big.Int) ([]WalletBalance, error) {
+	calls := make([]balanceCall, 0, len(owners)*len(tokens))
+	for _, owner := range owners {
+		for _, token := range tokens {
+			call := balanceCall{owner: owner, native: token.tp == bnb}
+			if !call.native {
+				call.token = common.HexToAddress(br.tokens.configs[token.tp])
+			}
+			calls = append(calls, call)
+		}
+	}
+	raws := make([]*big.Int, 0, len(calls))
+	for start := 0; start < len(calls); start += balanceBatchSize {
+		end := start + balanceBatchSize
+		if end > len(calls) {
+			end = len(calls)
+		}
+		batch, err := br.multicallBalances(calls[start:end], block)
+		if err != nil {
+			log.Warnf("multicall balances err : %+v, fallback to batched eth_call", err)
+			if batch, err = br.batchBalances(calls[start:end], block); err != nil {
+				return nil, err
+			}
+		}
+		raws = append(raws, batch...)
+	}
+
+	result := make([]WalletBalance, 0, len(owners))
+	for i, owner := range owners {
+		wb := WalletBalance{
+			Address:  owner.Hex(),
+			Balances: make([]balanceShow, 0, len(tokens)),
+		}
+		for j, token := range tokens {
+			formatted, decimals := br.tokens.formatAmount(token.tp, raws[i*len(tokens)+j])
+			wb.Balances = append(wb.Balances, balanceShow{
+				Symbol:   token.symbol,
+				Balance:  formatted,
+				Raw:      raws[i*len(tokens)+j].String(),
+				Decimals: decimals,
+			})
+		}
+		result = append(result, wb)
+	}
+	return result, nil
+}
+
+func (br *BalanceReader) multicallBalances(calls []balanceCall, block *big.Int) ([]*big.Int, error) {
+	mcCalls := make([]multicallCall, 0, len(calls))
+	for _, call := range calls {
+		var data []byte
+		var err error
+		target := call.token
+		if call.native {
+			target = br.multicall
+			data, err = br.mcAbi.Pack("getEthBalance", call.owner)
+		} else {
+			data, err = br.erc20.Pack("balanceOf", call.owner)
+		}
+		if err != nil {
+			return nil, err
+		}
+		mcCalls = append(mcCalls, multicallCall{Target: target, CallData: data})
+	}
+	input, err := br.mcAbi.Pack("aggregate3", mcCalls)
+	if err != nil {
+		return nil, err
+	}
+	output, err := br.ec.CallContract(context.Background(), ethereum.CallMsg{To: &br.multicall, Data: input}, block)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAggregate3(br.mcAbi, output, len(calls))
+}
+
+func decodeAggregate3(mcAbi abi.ABI, output []byte, n int) ([]*big.Int, error) {
+	out, err := mcAbi.Unpack("aggregate3", output)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) != 1 {
+		return nil, fmt.Errorf("unexpected aggregate3 output")
+	}
+	results := *abi.ConvertType(out[0], new([]multicallResult)).(*[]multicallResult)
+	if len(results) != n {
+		return nil, fmt.Errorf("aggregate3 returned %d results for %d calls", len(results), n)
+	}
+	balances := make([]*big.Int, 0, n)
+	for i, r := range results {
+		if !r.Success || len(r.ReturnData) != 32 {
+			return nil, fmt.Errorf("balance call %d failed", i)
+		}
+		balances = append(balances, new(big.Int).SetBytes(r.ReturnData))
+	}
+	return balances, nil
+}
+
+func (br *BalanceReader) batchBalances(calls []balanceCall, block *big.Int) ([]*big.Int, error) {
+	blockArg := "latest"
+	if block != nil {
+		blockArg = hexutil.EncodeBig(block)
+	}
+	elems := make([]rpc.BatchElem, 0, len(calls))
+	for _, call := range calls {
+		if call.native {
+			elems = append(elems, rpc.BatchElem{
+				Method: "eth_getBalance",
+				Args:   []interface{}{call.owner, blockArg},
+				Result: new(hexutil.Big),
+			})
+			continue
+		}
+		data, err := br.erc20.Pack("balanceOf", call.owner)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, rpc.BatchElem{
+			Method: "eth_call",
+			Args: []interface{}{map[string]interface{}{
+				"to":   call.token,
+				"data": hexutil.Bytes(data),
+			}, blockArg},
+			Result: new(hexutil.Bytes),
+		})
+	}
+	if err := br.rpc.BatchCallContext(context.Background(), elems); err != nil {
+		return nil, err
+	}
+	balances := make([]*big.Int, 0, len(elems))
+	for _, elem := range elems {
+		if elem.Error != nil {
+			return nil, elem.Error
+		}
+		switch r := elem.Result.(type) {
+		case *hexutil.Big:
+			balances = append(balances, r.ToInt())
+		case *hexutil.Bytes:
+			balances = append(balances, new(big.Int).SetBytes(*r))
+		}
+	}
+	return balances, nil
+}
+
+func (bl *BscListener) QueryWalletBalances(c *gin.Context) {
+	var service balancesService
+	if err := c.ShouldBind(&service); err == nil && len(service.Addresses) <= maxBalanceAddresses {
+		res := bl.queryWalletBalances(service)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) queryWalletBalances(service balancesService) serializer.Response {
+	owners := make([]common.Address, 0, len(service.Addresses))
+	for _, addr := range service.Addresses {
+		if !common.IsHexAddress(addr) {
+			return serializer.Response{
+				Code: 500,
+				Msg:  ErrorParam.Error(),
+			}
+		}
+		owners = append(owners, common.HexToAddress(addr))
+	}
+	tokens, err := parseBalanceTokens(service.Tokens)
+	if err != nil {
+		return serializer.Response{
+			Code: 500,
+			Msg:  err.Error(),
+		}
+	}
+	var block *big.Int
+	if service.BlockNumber != 0 {
+		block = new(big.Int).SetUint64(service.BlockNumber)
+	}
+	balances, err := bl.balances.balances(owners, tokens, block)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Msg:   "chain node err ",
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: balances,
+	}
+}
@@ -0,0 +1,55 @@
+package chain
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeAggregate3(t *testing.T) {
+	mcAbi := getABI(Multicall3ABI)
+	word := common.LeftPadBytes(big.NewInt(1500).Bytes(), 32)
+	_, err := mcAbi.Pack("aggregate3", []multicallCall{{Target: common.HexToAddress(defaultMulticall3), CallData: word}})
+	assert.NoError(t, err)
+
+	output, err := mcAbi.Methods["aggregate3"].Outputs.Pack([]multicallResult{
+		{Success: true, ReturnData: word},
+		{Success: true, ReturnData: common.LeftPadBytes(nil, 32)},
+	})
+	assert.NoError(t, err)
+
+	balances, err := decodeAggregate3(mcAbi, output, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "1500", balances[0].String())
+	assert.Equal(t, "0", balances[1].String())
+
+	_, err = decodeAggregate3(mcAbi, output, 3)
+	assert.Error(t, err)
+
+	output, err = mcAbi.Methods["aggregate3"].Outputs.Pack([]multicallResult{{Success: false}})
+	assert.NoError(t, err)
+	_, err = decodeAggregate3(mcAbi, output, 1)
+	assert.Error(t, err)
+}
+
+func TestParseBalanceTokens(t *testing.T) {
+	tokens, err := parseBalanceTokens(nil)
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 4)
+
+	tokens, err = parseBalanceTokens([]string{"usdc", "BNB"})
+	assert.NoError(t, err)
+	assert.Equal(t, []balanceToken{{tp: usdc, symbol: "USDC"}, {tp: bnb, symbol: "BNB"}}, tokens)
+
+	_, err = parseBalanceTokens([]string{"eth"})
+	assert.Error(t, err)
+}
+
+func TestMissingState(t *testing.T) {
+	assert.True(t, missingState(errors.New("missing trie node 1d2f3a (path )")))
+	assert.True(t, missingState(errors.New("historical state is not available")))
+	assert.False(t, missingState(errors.New("context deadline exceeded")))
+}
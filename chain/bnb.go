@@ -5,6 +5,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/go-redis/redis"
 	"math/big"
 	"spike-blockchain-server/config"
@@ -33,14 +34,18 @@ func (t *BNBTarget) Accept(fromAddr, toAddr string) (bool, uint64) {
 
 type BNBListener struct {
 	TxFilter
-	erc20Notify chan ERC20Tx
-	ec          *ethclient.Client
-	rc          *redis.Client
-	chainId     *big.Int
-	errorHandle chan ErrMsg
+	erc20Notify    chan ERC20Tx
+	newBlockNotify DataChannel
+	ec             *ethclient.Client
+	rpc            *rpc.Client
+	rc             *redis.Client
+	chainId        *big.Int
+	errorHandle    chan ErrMsg
+	tracker        *stageTracker
+	calls          *CallWatcher
 }
 
-func newBNBListener(filter TxFilter, ec *ethclient.Client, rc *redis.Client, erc20Notify chan ERC20Tx, errorHandle chan ErrMsg) *BNBListener {
+func newBNBListener(filter TxFilter, ec *ethclient.Client, rpcClient *rpc.Client, rc *redis.Client, erc20Notify chan ERC20Tx, newBlockNotify DataChannel, errorHandle chan ErrMsg, calls *CallWatcher) *BNBListener {
 	chainId, err := ec.NetworkID(context.Background())
 	if err != nil {
 		log.Error("query network id err : ", err)
@@ -49,15 +54,32 @@ func newBNBListener(filter TxFilter, ec *ethclient.Client, rc *redis.Client, erc
 	return &BNBListener{
 		filter,
 		erc20Notify,
+		newBlockNotify,
 		ec,
+		rpcClient,
 		rc,
 		chainId,
 		errorHandle,
+		newStageTracker(bnb),
+		calls,
 	}
 }
 
 func (bl *BNBListener) run() {
 	go bl.NewBlockFilter()
+	go bl.NewEventFilter()
+}
+
+func (bl *BNBListener) NewEventFilter() {
+	for {
+		select {
+		case de := <-bl.newBlockNotify:
+			from, to, ok := bl.tracker.rangeOf(de.Data.(blockEvent))
+			if ok {
+				bl.handlePastBlock(from, to, de.Data.(blockEvent).stage)
+			}
+		}
+	}
 }
 
 func (bl *BNBListener) NewBlockFilter() error {
@@ -75,38 +97,28 @@ func (bl *BNBListener) NewBlockFilter() error {
 			})
 			log.Error("new block subscribe err : ", err)
 		case header := <-newBlockChan:
-			height := new(big.Int).Sub(header.Number, big.NewInt(blockConfirmHeight))
+			height := queryFinalizedHeight(bl.rpc, header.Number)
 			cacheHeight, err := bl.rc.Get(BLOCKNUM + config.Cfg.Redis.MachineId).Int64()
-
-			if height.Int64()-1 > cacheHeight {
-				for i := cacheHeight + 1; i < height.Int64(); i++ {
-					log.Infof("ws node timeout err : height %d", i)
-					bl.errorHandle <- ErrMsg{
-						tp:   bnb,
-						from: big.NewInt(i),
-						to:   big.NewInt(i),
-					}
-					eb.Publish(newBlockTopic, big.NewInt(i))
-				}
+			if err != nil {
+				log.Error("query cache blockNum err : ", err)
+				break
 			}
-			eb.Publish(newBlockTopic, height)
-			log.Infof("new block num : %d, height : %d", header.Number.Int64(), height.Int64())
 
-			err = bl.SingleBlockFilter(height)
-			if err != nil {
-				bl.errorHandle <- ErrMsg{
-					tp:   bnb,
-					from: height,
-					to:   height,
-				}
+			eb.Publish(newBlockTopic, blockEvent{height: header.Number, stage: stageSeen})
+			eb.Publish(newBlockTopic, blockEvent{height: header.Number, stage: stageConfirmed})
+			if height.Int64() <= cacheHeight {
+				break
+			}
+			for i := cacheHeight + 1; i <= height.Int64(); i++ {
+				eb.Publish(newBlockTopic, blockEvent{height: big.NewInt(i), stage: stageFinalized})
 			}
+			log.Infof("new block num : %d, finalized height : %d", header.Number.Int64(), height.Int64())
 			bl.rc.Set(BLOCKNUM+config.Cfg.Redis.MachineId, height.Int64(), 0)
-			log.Infof("bnb listen new block %d finished", height)
 		}
 	}
 }
 
-func (bl *BNBListener) handlePastBlock(blockNum, nowBlockNum *big.Int) error {
+func (bl *BNBListener) handlePastBlock(blockNum, nowBlockNum *big.Int, stage txStage) error {
 	throttle := make(chan struct{}, 30)
 	var wg sync.WaitGroup
 	wg.Add(int(new(big.Int).Sub(nowBlockNum, blockNum).Int64()) + 1)
@@ -118,12 +130,13 @@ func (bl *BNBListener) handlePastBlock(blockNum, nowBlockNum *big.Int) error {
 				<-throttle
 			}()
 			h := big.NewInt(height)
-			err := bl.SingleBlockFilter(h)
+			err := bl.SingleBlockFilter(h, stage)
 			if err != nil {
 				bl.errorHandle <- ErrMsg{
-					tp:   bnb,
-					from: h,
-					to:   h,
+					tp:    bnb,
+					stage: stage,
+					from:  h,
+					to:    h,
 				}
 			}
 		}(i)
@@ -132,7 +145,7 @@ func (bl *BNBListener) handlePastBlock(blockNum, nowBlockNum *big.Int) error {
 	return nil
 }
 
-func (bl *BNBListener) SingleBlockFilter(height *big.Int) error {
+func (bl *BNBListener) SingleBlockFilter(height *big.Int, stage txStage) error {
 	block, err := bl.ec.BlockByNumber(context.Background(), height)
 	if err != nil {
 		log.Errorf("bnb blockByHash heght : %d ,err : %+v", height.Int64(), err)
@@ -147,6 +160,9 @@ func (bl *BNBListener) SingleBlockFilter(height *big.Int) error {
 		if tx.To() == nil {
 			continue
 		}
+		if err := bl.calls.handleTx(tx, fromAddr, block.NumberU64(), stage); err != nil {
+			go bl.calls.retry(tx, fromAddr, block.NumberU64(), stage)
+		}
 		if tx.Value().Int64() == 0 {
 			continue
 		}
@@ -160,13 +176,16 @@ func (bl *BNBListener) SingleBlockFilter(height *big.Int) error {
 			return err
 		}
 		tx := ERC20Tx{
-			From:    fromAddr,
-			To:      tx.To().Hex(),
-			TxType:  txType,
-			TxHash:  tx.Hash().Hex(),
-			Status:  recp.Status,
-			PayTime: int64(block.Time() * 1000),
-			Amount:  tx.Value().String(),
+			From:            fromAddr,
+			To:              tx.To().Hex(),
+			TxType:          txType,
+			TxHash:          tx.Hash().Hex(),
+			Status:          recp.Status,
+			PayTime:         int64(block.Time() * 1000),
+			Amount:          tx.Value().String(),
+			FormattedAmount: ToDecimal(tx.Value(), nativeDecimals).String(),
+			Decimals:        nativeDecimals,
+			Stage:           stage.String(),
 		}
 		bl.erc20Notify <- tx
 	}
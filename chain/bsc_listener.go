@@ -3,6 +3,7 @@ package chain
 import (
 	"context"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/go-redis/redis"
 	logger "github.com/ipfs/go-log"
 	"math/big"
@@ -25,9 +26,10 @@ const (
 )
 
 type ErrMsg struct {
-	tp   TokenType
-	from *big.Int
-	to   *big.Int
+	tp    TokenType
+	stage txStage
+	from  *big.Int
+	to    *big.Int
 }
 
 type BscListener struct {
@@ -35,8 +37,30 @@ type BscListener struct {
 	nlManager   *NftListManager
 	trManager   *TxRecordManager
 	ec          *ethclient.Client
+	rpc         *rpc.Client
 	rc          *redis.Client
 	l           map[TokenType]Listener
+	mempool     *MempoolWatcher
+	tokens      *TokenRegistry
+	balances    *BalanceReader
+	archive     *BalanceReader
+	blockTimes  *BlockTimeIndex
+	snapshots   *Snapshotter
+	gov         *Governance
+	usdc        *UsdcCompliance
+	classifier  *TxClassifier
+	approvals   *ApprovalIndex
+	builder     *TxBuilder
+	gas         *GasOracle
+	tracker     *TxTracker
+	rental      *RentalTracker
+	calls       *CallWatcher
+	royalty     *RoyaltyIndex
+	signer      *Signer
+	minter      *MintManager
+	owners      *OwnershipIndex
+	metadata    *MetadataStore
+	stats       *CollectionStats
 	errorHandle chan ErrMsg
 }
 
@@ -45,11 +69,12 @@ func NewBscListener(speedyNodeAddress string, targetWalletAddr string) (*BscList
 	bl := &BscListener{}
 	bl.nlManager = NewNftListManager()
 	bl.trManager = NewTxRecordManager()
-	client, err := ethclient.Dial(speedyNodeAddress)
+	rpcClient, err := rpc.Dial(speedyNodeAddress)
 	if err != nil {
 		log.Error("eth client dial err : ", err)
 		return nil, err
 	}
+	client := ethclient.NewClient(rpcClient)
 	chainId, err := client.ChainID(context.Background())
 	switch chainId.String() {
 	case "56":
@@ -64,29 +89,61 @@ func NewBscListener(speedyNodeAddress string, targetWalletAddr string) (*BscList
 	bl.errorHandle = errorHandle
 	bl.rc = cache.RedisClient
 	bl.ec = client
+	bl.rpc = rpcClient
 	erc20Notify := make(chan ERC20Tx, 10)
 	erc721Notify := make(chan ERC721Tx, 10)
+	pendingNotify := make(chan PendingTx, 10)
+	decodedNotify := make(chan DecodedEvent, 10)
+	mintNotify := make(chan MintJob, 10)
+	trackNotify := make(chan TrackedTx, 10)
 
-	vaultChan := make(DataChannel, 10)
-	skkChan := make(DataChannel, 10)
-	sksChan := make(DataChannel, 10)
-	usdcChan := make(DataChannel, 10)
-	aunftChan := make(DataChannel, 10)
-	eb.Subscribe(newBlockTopic, vaultChan)
-	eb.Subscribe(newBlockTopic, skkChan)
-	eb.Subscribe(newBlockTopic, sksChan)
-	eb.Subscribe(newBlockTopic, aunftChan)
-	eb.Subscribe(newBlockTopic, usdcChan)
+	bnbChan := eb.Subscribe(newBlockTopic, bnb.String(), defaultSubscribeOptions()).C()
+	vaultChan := eb.Subscribe(newBlockTopic, gameVault.String(), defaultSubscribeOptions()).C()
+	skkChan := eb.Subscribe(newBlockTopic, governanceToken.String(), defaultSubscribeOptions()).C()
+	sksChan := eb.Subscribe(newBlockTopic, gameToken.String(), defaultSubscribeOptions()).C()
+	usdcChan := eb.Subscribe(newBlockTopic, usdc.String(), defaultSubscribeOptions()).C()
+	aunftChan := eb.Subscribe(newBlockTopic, gameNft.String(), defaultSubscribeOptions()).C()
 
+	bl.tokens = newTokenRegistry(bl.ec)
+	bl.balances = newBalanceReader(bl.ec, bl.rpc, bl.tokens)
+	bl.archive = bl.balances
+	if archiveAddress := config.Cfg.Chain.ArchiveNodeAddress; archiveAddress != "" {
+		archiveRpc, err := rpc.Dial(archiveAddress)
+		if err != nil {
+			log.Error("archive node dial err : ", err)
+			return nil, err
+		}
+		bl.archive = newBalanceReader(ethclient.NewClient(archiveRpc), archiveRpc, bl.tokens)
+	}
+	bl.blockTimes = newBlockTimeIndex(bl.ec, bl.rc)
+	bl.snapshots = newSnapshotter(bl.ec, bl.rc, bl.tokens)
+	bl.usdc = newUsdcCompliance(bl.ec, bl.rc)
+	bl.classifier = newTxClassifier(bl.ec, bl.tokens, targetWalletAddr)
+	bl.approvals = newApprovalIndex(bl.ec, bl.rpc, bl.rc, bl.tokens, chainId)
+	bl.gov = newGovernance(bl.rc, bl.tokens, chainId, bl.skkBalancesAt, bl.skkHoldersAt)
+	bl.rental = newRentalTracker(bl.ec, bl.rpc, bl.rc, decodedNotify)
+	bl.calls = newCallWatcher(bl.ec, bl.rc)
+	bl.royalty = newRoyaltyIndex(bl.ec, bl.rpc, bl.rc, bl.calls)
+	if bl.signer, err = newSigner(config.Cfg.Signer.PrivateKey, chainId, bl.ec); err != nil {
+		log.Warnf("admin transactions are disabled : %+v", err)
+	}
+	bl.owners = newOwnershipIndex(bl.ec, bl.rpc, bl.rc)
+	bl.metadata = newMetadataStore(bl.ec, bl.rc, bl.calls)
+	bl.stats = newCollectionStats(bl.rc, bl.owners, bl.metadata)
+	bl.minter = newMintManager(bl.ec, bl.rc, bl.signer, mintNotify)
 	l := make(map[TokenType]Listener)
-	l[bnb] = newBNBListener(newBNBTarget(targetWalletAddr), bl.ec, bl.rc, erc20Notify, errorHandle)
-	l[gameVault] = newGameVaultListener(newGameVaultTarget(targetWalletAddr), config.Cfg.Contract.GameVaultAddress, gameVault, bl.ec, bl.rc, erc20Notify, vaultChan, getABI(GameVaultABI), errorHandle)
-	l[governanceToken] = newERC20Listener(newSKKTarget(targetWalletAddr), config.Cfg.Contract.GovernanceTokenAddress, governanceToken, bl.ec, bl.rc, erc20Notify, skkChan, getABI(GovernanceTokenABI), errorHandle)
-	l[gameToken] = newERC20Listener(newSKSTarget(targetWalletAddr), config.Cfg.Contract.GameTokenAddress, gameToken, bl.ec, bl.rc, erc20Notify, sksChan, getABI(GameTokenABI), errorHandle)
-	l[usdc] = newERC20Listener(newUSDCTarget(targetWalletAddr), config.Cfg.Contract.UsdcAddress, usdc, bl.ec, bl.rc, erc20Notify, usdcChan, getABI(USDCContractABI), errorHandle)
-	l[gameNft] = newAUNFTListener(newAUNFTTarget(targetWalletAddr), config.Cfg.Contract.GameNftAddress, gameNft, bl.ec, bl.rc, erc721Notify, aunftChan, getABI(GameNftABI), errorHandle)
+	l[bnb] = newBNBListener(newBNBTarget(targetWalletAddr), bl.ec, bl.rpc, bl.rc, erc20Notify, bnbChan, errorHandle, bl.calls)
+	l[gameVault] = newEventListener(config.Cfg.Contract.GameVaultAddress, gameVault, getABI(GameVaultABI), gameVaultMappings(newGameVaultTarget(targetWalletAddr), erc20Notify), bl.ec, bl.rc, decodedNotify, vaultChan, errorHandle)
+	l[governanceToken] = newEventListener(config.Cfg.Contract.GovernanceTokenAddress, governanceToken, getABI(GovernanceTokenABI), mergeMappings(erc20Mappings(newSKKTarget(targetWalletAddr), governanceToken, bl.tokens, erc20Notify, nil), bl.approvals.mappings(governanceToken)), bl.ec, bl.rc, decodedNotify, skkChan, errorHandle)
+	l[gameToken] = newEventListener(config.Cfg.Contract.GameTokenAddress, gameToken, getABI(GameTokenABI), mergeMappings(erc20Mappings(newSKSTarget(targetWalletAddr), gameToken, bl.tokens, erc20Notify, nil), bl.approvals.mappings(gameToken)), bl.ec, bl.rc, decodedNotify, sksChan, errorHandle)
+	l[usdc] = newEventListener(config.Cfg.Contract.UsdcAddress, usdc, getABI(USDCContractABI), mergeMappings(erc20Mappings(newUSDCTarget(targetWalletAddr), usdc, bl.tokens, erc20Notify, bl.usdc.flag), bl.usdc.mappings(), bl.approvals.mappings(usdc)), bl.ec, bl.rc, decodedNotify, usdcChan, errorHandle)
+	l[gameNft] = newEventListener(config.Cfg.Contract.GameNftAddress, gameNft, getABI(GameNftABI), mergeMappings(aunftMappings(newAUNFTTarget(targetWalletAddr), bl.rc, erc721Notify, bl.rental, bl.minter, bl.owners, bl.metadata), bl.approvals.mappings(gameNft)), bl.ec, bl.rc, decodedNotify, aunftChan, errorHandle)
 	bl.l = l
-	spikeTxMgr := newSpikeTxMgr(game.NewKafkaClient(config.Cfg.Kafka.Address), erc20Notify, erc721Notify)
+	bl.mempool = newMempoolWatcher(bl.ec, bl.rpc, bl.rc, bl.tokens, chainId, targetWalletAddr, pendingNotify)
+	bl.gas = newGasOracle(bl.ec, bl.rpc, bl.rc)
+	bl.tracker = newTxTracker(bl.ec, bl.rc, chainId, trackNotify)
+	bl.builder = newTxBuilder(bl.ec, bl.rc, bl.tokens, bl.mempool, chainId, targetWalletAddr)
+	spikeTxMgr := newSpikeTxMgr(game.NewKafkaClient(config.Cfg.Kafka.Address), erc20Notify, erc721Notify, pendingNotify, decodedNotify, mintNotify, trackNotify)
 	go spikeTxMgr.run()
 	return bl, nil
 }
@@ -101,9 +158,10 @@ func (bl *BscListener) Run() {
 			log.Error("query now bnb_blockNum err :", err)
 			continue
 		}
+		finalizedNum := queryFinalizedHeight(bl.rpc, new(big.Int).SetUint64(nowBlockNum)).Uint64()
 		if bl.rc.Get(BLOCKNUM+config.Cfg.Redis.MachineId).Err() == redis.Nil {
 			log.Infof("blockNum is not exist")
-			bl.rc.Set(BLOCKNUM+config.Cfg.Redis.MachineId, nowBlockNum-blockConfirmHeight, 0)
+			bl.rc.Set(BLOCKNUM+config.Cfg.Redis.MachineId, finalizedNum, 0)
 			break
 		}
 		cacheBlockNum, err := bl.rc.Get(BLOCKNUM + config.Cfg.Redis.MachineId).Uint64()
@@ -111,7 +169,7 @@ func (bl *BscListener) Run() {
 			log.Error("query cache bnb_blockNum err : ", err)
 			continue
 		}
-		if cacheBlockNum >= nowBlockNum-blockConfirmHeight {
+		if cacheBlockNum >= finalizedNum {
 			log.Infof("sync done")
 			break
 		}
@@ -120,11 +178,11 @@ func (bl *BscListener) Run() {
 			wg.Add(1)
 			go func(l Listener) {
 				defer wg.Done()
-				l.handlePastBlock(big.NewInt(int64(cacheBlockNum+1)), big.NewInt(int64(nowBlockNum-blockConfirmHeight)))
+				l.handlePastBlock(big.NewInt(int64(cacheBlockNum+1)), big.NewInt(int64(finalizedNum)), stageFinalized)
 			}(listener)
 		}
 		wg.Wait()
-		bl.rc.Set(BLOCKNUM+config.Cfg.Redis.MachineId, nowBlockNum-blockConfirmHeight, 0)
+		bl.rc.Set(BLOCKNUM+config.Cfg.Redis.MachineId, finalizedNum, 0)
 	}
 
 	for _, listener := range bl.l {
@@ -132,16 +190,29 @@ func (bl *BscListener) Run() {
 			l.run()
 		}(listener)
 	}
+	go bl.mempool.run()
+	go bl.rental.run()
+	go bl.owners.backfill()
+	go bl.rental.backfill()
+	go bl.approvals.backfill()
+	go bl.royalty.backfill()
+	go bl.calls.run()
+	go bl.tracker.run()
+	bl.metadata.run()
+	go bl.stats.run()
+	if bl.signer != nil {
+		go bl.minter.run()
+	}
 }
 
 func (bl *BscListener) handleError() {
 	for {
 		select {
 		case msg := <-bl.errorHandle:
-			log.Infof("handle err ,type : %s, from : %d, to : %d", msg.tp.String(), msg.from.Int64(), msg.to.Int64())
+			log.Infof("handle err ,type : %s, stage : %s, from : %d, to : %d", msg.tp.String(), msg.stage, msg.from.Int64(), msg.to.Int64())
 			if _, ok := bl.l[msg.tp]; ok {
 				time.Sleep(200 * time.Millisecond)
-				bl.l[msg.tp].handlePastBlock(msg.from, msg.to)
+				bl.l[msg.tp].handlePastBlock(msg.from, msg.to, msg.stage)
 			}
 		}
 	}
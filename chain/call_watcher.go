@@ -0,0 +1,184 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/go-redis/redis"
+	"strings"
+	"time"
+)
+
+const (
+	callFailedKey         = "call_watcher_failed"
+	callRetry             = 3
+	callRetryInterval     = time.Second
+	callReprocessInterval = time.Minute
+)
+
+// CallMapping handles a successful call of a watched contract method, it is
+// used for state changes the contract does not emit an event for.
+type CallMapping func(call *DecodedCall)
+
+type DecodedCall struct {
+	Contract    string
+	Method      string
+	From        string
+	TxHash      string
+	BlockNumber uint64
+	decodedArgs
+}
+
+// failedCall is a finalized tx to a watched contract whose receipt could not
+// be read, it is kept by hash until it is handled.
+type failedCall struct {
+	From        string `json:"from"`
+	BlockNumber uint64 `json:"blockNumber"`
+}
+
+type watchedContract struct {
+	abi      abi.ABI
+	mappings map[string]CallMapping
+}
+
+// CallWatcher decodes the transactions of finalized blocks sent to watched
+// contracts, the bnb listener hands it every transaction it scans.
+type CallWatcher struct {
+	ec        *ethclient.Client
+	rc        *redis.Client
+	contracts map[string]*watchedContract
+}
+
+func newCallWatcher(ec *ethclient.Client, rc *redis.Client) *CallWatcher {
+	return &CallWatcher{
+		ec:        ec,
+		rc:        rc,
+		contracts: make(map[string]*watchedContract),
+	}
+}
+
+func (cw *CallWatcher) watch(contractAddr string, contractAbi abi.ABI, method string, mapping CallMapping) {
+	addr := strings.ToLower(contractAddr)
+	wc, ok := cw.contracts[addr]
+	if !ok {
+		wc = &watchedContract{
+			abi:      contractAbi,
+			mappings: make(map[string]CallMapping),
+		}
+		cw.contracts[addr] = wc
+	}
+	wc.mappings[method] = mapping
+}
+
+func (cw *CallWatcher) handleTx(tx *types.Transaction, from string, blockNumber uint64, stage txStage) error {
+	if cw == nil || stage != stageFinalized || tx.To() == nil || len(tx.Data()) < 4 {
+		return nil
+	}
+	call, mapping, ok := cw.decode(*tx.To(), from, tx.Hash(), blockNumber, tx.Data())
+	if !ok {
+		return nil
+	}
+	recp, err := cw.ec.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		log.Errorf("query txReceipt txHash : %s, err : %+v", tx.Hash(), err)
+		return err
+	}
+	if recp.Status != types.ReceiptStatusSuccessful {
+		return nil
+	}
+	mapping(call)
+	return nil
+}
+
+// retry runs handleTx again for a tx whose receipt could not be read, so the
+// rest of the block is not scanned and published twice for it. A tx still
+// failing is stored and left to run.
+func (cw *CallWatcher) retry(tx *types.Transaction, from string, blockNumber uint64, stage txStage) {
+	for i := 0; i < callRetry; i++ {
+		time.Sleep(callRetryInterval)
+		if err := cw.handleTx(tx, from, blockNumber, stage); err == nil {
+			return
+		}
+	}
+	val, err := json.Marshal(failedCall{From: from, BlockNumber: blockNumber})
+	if err != nil {
+		log.Error("json marshal err : ", err)
+		return
+	}
+	if err := cw.rc.HSet(callFailedKey, tx.Hash().Hex(), string(val)).Err(); err != nil {
+		log.Errorf("call watcher lost txHash : %s, blockNum : %d, err : %+v", tx.Hash(), blockNumber, err)
+		return
+	}
+	log.Warnf("call watcher deferred txHash : %s, blockNum : %d", tx.Hash(), blockNumber)
+}
+
+// run handles the stored failed txs again every callReprocessInterval until
+// their receipts can be read.
+func (cw *CallWatcher) run() {
+	ticker := time.NewTicker(callReprocessInterval)
+	for range ticker.C {
+		failed, err := cw.rc.HGetAll(callFailedKey).Result()
+		if err != nil {
+			log.Error("query failed calls err : ", err)
+			continue
+		}
+		for hash, val := range failed {
+			var fc failedCall
+			if err := json.Unmarshal([]byte(val), &fc); err != nil {
+				cw.rc.HDel(callFailedKey, hash)
+				continue
+			}
+			tx, _, err := cw.ec.TransactionByHash(context.Background(), common.HexToHash(hash))
+			if err != nil {
+				log.Errorf("query tx txHash : %s, err : %+v", hash, err)
+				continue
+			}
+			if err := cw.handleTx(tx, fc.From, fc.BlockNumber, stageFinalized); err != nil {
+				continue
+			}
+			cw.rc.HDel(callFailedKey, hash)
+		}
+	}
+}
+
+// replay runs the mapping of a call known to have succeeded, e.g. one read
+// back from bscscan.
+func (cw *CallWatcher) replay(to common.Address, from string, txHash common.Hash, blockNumber uint64, data []byte) {
+	if call, mapping, ok := cw.decode(to, from, txHash, blockNumber, data); ok {
+		mapping(call)
+	}
+}
+
+func (cw *CallWatcher) decode(to common.Address, from string, txHash common.Hash, blockNumber uint64, data []byte) (*DecodedCall, CallMapping, bool) {
+	if len(data) < 4 {
+		return nil, nil, false
+	}
+	wc, ok := cw.contracts[strings.ToLower(to.Hex())]
+	if !ok {
+		return nil, nil, false
+	}
+	method, err := wc.abi.MethodById(data[:4])
+	if err != nil {
+		return nil, nil, false
+	}
+	mapping, ok := wc.mappings[method.RawName]
+	if !ok {
+		return nil, nil, false
+	}
+	args := make(map[string]interface{})
+	if err := method.Inputs.UnpackIntoMap(args, data[4:]); err != nil {
+		log.Errorf("unpack %s input txHash : %s, err : %+v", method.RawName, txHash, err)
+		return nil, nil, false
+	}
+	return &DecodedCall{
+		Contract:    to.Hex(),
+		Method:      method.RawName,
+		From:        from,
+		TxHash:      txHash.Hex(),
+		BlockNumber: blockNumber,
+		decodedArgs: args,
+	}, mapping, true
+}
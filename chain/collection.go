@@ -0,0 +1,470 @@
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"sort"
+	"spike-blockchain-server/serializer"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	nftSupplyKey       = "nft_supply"
+	nftHoldersKey      = "nft_holders"
+	nftTraitCountKey   = "nft_trait_count"
+	nftTokenTraitsKey  = "nft_token_traits"
+	nftStatsPendingKey = "nft_stats_pending"
+	nftRarityPrefix    = "nft_rarity_"
+	nftRarityDirtyKey  = "nft_rarity_dirty"
+	totalSupplyField   = "_total"
+	statsPendingPeriod = 30 * time.Second
+	statsPendingBatch  = 200
+	defaultTopHolders  = 10
+)
+
+type Holder struct {
+	Address string `json:"address"`
+	Amount  int64  `json:"amount"`
+}
+
+type CollectionSummary struct {
+	TotalSupply int64            `json:"totalSupply"`
+	Supply      map[string]int64 `json:"supply"`
+	Holders     int64            `json:"holders"`
+	TopHolders  []Holder         `json:"topHolders"`
+}
+
+type TraitRarity struct {
+	Trait     string  `json:"trait"`
+	Value     string  `json:"value"`
+	Count     int64   `json:"count"`
+	Frequency float64 `json:"frequency"`
+}
+
+type TokenRarity struct {
+	TokenId string        `json:"tokenId"`
+	Type    string        `json:"type"`
+	Score   float64       `json:"score"`
+	Rank    int           `json:"rank"`
+	Total   int           `json:"total"`
+	Traits  []TraitRarity `json:"traits"`
+}
+
+type tokenTraits struct {
+	Type       string            `json:"type"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+type statsService struct {
+	Limit int64 `form:"limit" json:"limit"`
+}
+
+type traitsService struct {
+	Type string `form:"type" json:"type" binding:"required"`
+}
+
+type rarityService struct {
+	TokenId string `form:"tokenId" json:"tokenId" binding:"required"`
+}
+
+// CollectionStats keeps supply, holder and trait counters of the game nft.
+// Holders follow the ownership index, traits are added once the metadata of
+// a minted token is known and removed when it is burnt.
+type CollectionStats struct {
+	rc       *redis.Client
+	owners   *OwnershipIndex
+	metadata *MetadataStore
+	lk       sync.Mutex
+}
+
+func newCollectionStats(rc *redis.Client, owners *OwnershipIndex, metadata *MetadataStore) *CollectionStats {
+	cs := &CollectionStats{
+		rc:       rc,
+		owners:   owners,
+		metadata: metadata,
+	}
+	owners.onChange = cs.onOwnerChange
+	metadata.onFetched = cs.onMetadata
+	return cs
+}
+
+func (cs *CollectionStats) onOwnerChange(tokenId, prev, owner string) {
+	cs.lk.Lock()
+	defer cs.lk.Unlock()
+	if prev != "" && prev != emptyAddress {
+		cs.addHolder(prev, -1)
+	} else {
+		cs.rc.HIncrBy(nftSupplyKey, totalSupplyField, 1)
+		cs.rc.SAdd(nftStatsPendingKey, tokenId)
+	}
+	if owner != emptyAddress {
+		cs.addHolder(owner, 1)
+		return
+	}
+	cs.rc.HIncrBy(nftSupplyKey, totalSupplyField, -1)
+	cs.rc.SRem(nftStatsPendingKey, tokenId)
+	cs.setTraits(tokenId, nil)
+}
+
+func (cs *CollectionStats) addHolder(addr string, n float64) {
+	addr = strings.ToLower(addr)
+	if count, err := cs.rc.ZIncrBy(nftHoldersKey, n, addr).Result(); err == nil && count <= 0 {
+		cs.rc.ZRem(nftHoldersKey, addr)
+	}
+}
+
+// onMetadata records the traits of a live token, a refreshed metadata
+// replaces the traits counted before.
+func (cs *CollectionStats) onMetadata(sm StoredMetadata) {
+	ownership, ok := cs.owners.get(sm.TokenId)
+	if !ok || ownership.Owner == emptyAddress {
+		return
+	}
+	cds := parseMetadata([]NftResult{{TokenId: sm.TokenId, Metadata: sm.Metadata}})
+	cs.lk.Lock()
+	defer cs.lk.Unlock()
+	cs.rc.SRem(nftStatsPendingKey, sm.TokenId)
+	if len(cds) == 0 {
+		return
+	}
+	traits := &tokenTraits{
+		Type:       cds[0].Type,
+		Attributes: make(map[string]string, len(cds[0].Attributes)),
+	}
+	for trait, v := range cds[0].Attributes {
+		traits.Attributes[trait] = fmt.Sprint(v)
+	}
+	cs.setTraits(sm.TokenId, traits)
+}
+
+// setTraits replaces the traits of tokenId, the rarity ranks of the types it
+// touches are recomputed by run.
+func (cs *CollectionStats) setTraits(tokenId string, traits *tokenTraits) {
+	if prev, ok := cs.traitsOf(tokenId); ok {
+		cs.rc.SAdd(nftRarityDirtyKey, prev.Type)
+		cs.rc.HIncrBy(nftSupplyKey, prev.Type, -1)
+		for trait, value := range prev.Attributes {
+			cs.rc.HIncrBy(nftTraitCountKey, traitField(prev.Type, trait, value), -1)
+		}
+		cs.rc.HDel(nftTokenTraitsKey, tokenId)
+	}
+	if traits == nil {
+		return
+	}
+	val, err := json.Marshal(traits)
+	if err != nil {
+		log.Error("json marshal err : ", err)
+		return
+	}
+	cs.rc.HSet(nftTokenTraitsKey, tokenId, string(val))
+	cs.rc.SAdd(nftRarityDirtyKey, traits.Type)
+	cs.rc.HIncrBy(nftSupplyKey, traits.Type, 1)
+	for trait, value := range traits.Attributes {
+		cs.rc.HIncrBy(nftTraitCountKey, traitField(traits.Type, trait, value), 1)
+	}
+}
+
+func (cs *CollectionStats) traitsOf(tokenId string) (tokenTraits, bool) {
+	var traits tokenTraits
+	val, err := cs.rc.HGet(nftTokenTraitsKey, tokenId).Result()
+	if err != nil {
+		return traits, false
+	}
+	if err := json.Unmarshal([]byte(val), &traits); err != nil {
+		return traits, false
+	}
+	return traits, true
+}
+
+func traitField(tp, trait, value string) string {
+	return tp + "|" + trait + "|" + value
+}
+
+// run loads the metadata of minted tokens whose traits are not counted yet,
+// the backfill mints far more tokens than the refresh queue holds, and ranks
+// the types whose traits changed since the last tick.
+func (cs *CollectionStats) run() {
+	// ranks are rebuilt once at start, they may predate the dirty marks
+	if supply, err := cs.rc.HKeys(nftSupplyKey).Result(); err == nil {
+		for _, tp := range supply {
+			if tp != totalSupplyField {
+				cs.rc.SAdd(nftRarityDirtyKey, tp)
+			}
+		}
+	}
+	cs.rank()
+	ticker := time.NewTicker(statsPendingPeriod)
+	for range ticker.C {
+		cs.rank()
+		tokenIds, err := cs.rc.SRandMemberN(nftStatsPendingKey, statsPendingBatch).Result()
+		if err != nil {
+			log.Error("query pending stats tokens err : ", err)
+			continue
+		}
+		for _, tokenId := range tokenIds {
+			sm, err := cs.metadata.get(tokenId)
+			if err != nil {
+				log.Errorf("query nft metadata tokenId : %s, err : %+v", tokenId, err)
+				continue
+			}
+			cs.onMetadata(sm)
+		}
+	}
+}
+
+func (cs *CollectionStats) summary(limit int64) (CollectionSummary, error) {
+	summary := CollectionSummary{
+		Supply:     make(map[string]int64),
+		TopHolders: make([]Holder, 0),
+	}
+	supply, err := cs.rc.HGetAll(nftSupplyKey).Result()
+	if err != nil {
+		return summary, err
+	}
+	for tp, n := range supply {
+		var count int64
+		fmt.Sscan(n, &count)
+		if tp == totalSupplyField {
+			summary.TotalSupply = count
+		} else if count > 0 {
+			summary.Supply[tp] = count
+		}
+	}
+	if summary.Holders, err = cs.rc.ZCard(nftHoldersKey).Result(); err != nil {
+		return summary, err
+	}
+	top, err := cs.rc.ZRevRangeWithScores(nftHoldersKey, 0, limit-1).Result()
+	if err != nil {
+		return summary, err
+	}
+	for _, z := range top {
+		summary.TopHolders = append(summary.TopHolders, Holder{
+			Address: z.Member.(string),
+			Amount:  int64(z.Score),
+		})
+	}
+	return summary, nil
+}
+
+// traitCounts returns trait -> value -> count for one nft type.
+func (cs *CollectionStats) traitCounts(tp string) (map[string]map[string]int64, error) {
+	counts := make(map[string]map[string]int64)
+	fields, err := cs.rc.HGetAll(nftTraitCountKey).Result()
+	if err != nil {
+		return counts, err
+	}
+	for field, n := range fields {
+		parts := strings.SplitN(field, "|", 3)
+		if len(parts) != 3 || parts[0] != tp {
+			continue
+		}
+		var count int64
+		fmt.Sscan(n, &count)
+		if count <= 0 {
+			continue
+		}
+		if _, ok := counts[parts[1]]; !ok {
+			counts[parts[1]] = make(map[string]int64)
+		}
+		counts[parts[1]][parts[2]] = count
+	}
+	return counts, nil
+}
+
+// rank rebuilds the rarity zset of every type marked dirty. A type is
+// unmarked before it is scored, so a change meanwhile ranks it again.
+func (cs *CollectionStats) rank() {
+	types, err := cs.rc.SMembers(nftRarityDirtyKey).Result()
+	if err != nil {
+		log.Error("query dirty rarity types err : ", err)
+		return
+	}
+	if len(types) == 0 {
+		return
+	}
+	all, err := cs.rc.HGetAll(nftTokenTraitsKey).Result()
+	if err != nil {
+		log.Error("query nft traits err : ", err)
+		return
+	}
+	for _, tp := range types {
+		cs.rc.SRem(nftRarityDirtyKey, tp)
+		counts, err := cs.traitCounts(tp)
+		if err != nil {
+			log.Errorf("query %s trait counts err : %+v", tp, err)
+			cs.rc.SAdd(nftRarityDirtyKey, tp)
+			continue
+		}
+		supply, _ := cs.rc.HGet(nftSupplyKey, tp).Int64()
+		scores := rarityScores(all, tp, counts, supply)
+		key := nftRarityPrefix + tp
+		if len(scores) == 0 {
+			cs.rc.Del(key)
+			continue
+		}
+		// the ranks are swapped in whole, lookups never see a partial set
+		tmp := key + "_tmp"
+		cs.rc.Del(tmp)
+		for i := 0; i < len(scores); i += 1000 {
+			end := i + 1000
+			if end > len(scores) {
+				end = len(scores)
+			}
+			cs.rc.ZAdd(tmp, scores[i:end]...)
+		}
+		if err := cs.rc.Rename(tmp, key).Err(); err != nil {
+			log.Errorf("rank %s rarity err : %+v", tp, err)
+			cs.rc.SAdd(nftRarityDirtyKey, tp)
+		}
+	}
+}
+
+// rarityScores scores the tokens of type tp among the stored traits.
+func rarityScores(all map[string]string, tp string, counts map[string]map[string]int64, supply int64) []redis.Z {
+	scores := make([]redis.Z, 0)
+	for id, val := range all {
+		var traits tokenTraits
+		if json.Unmarshal([]byte(val), &traits) != nil || traits.Type != tp {
+			continue
+		}
+		scores = append(scores, redis.Z{Score: rarityScore(traits, counts, supply), Member: id})
+	}
+	return scores
+}
+
+// rarity scores tokenId by the sum of supply / count over its traits, the
+// rank is its position among the tokens of the same type as last ranked.
+func (cs *CollectionStats) rarity(tokenId string) (TokenRarity, error) {
+	traits, ok := cs.traitsOf(tokenId)
+	if !ok {
+		return TokenRarity{}, fmt.Errorf("no traits indexed for tokenId %s", tokenId)
+	}
+	counts, err := cs.traitCounts(traits.Type)
+	if err != nil {
+		return TokenRarity{}, err
+	}
+	supply, _ := cs.rc.HGet(nftSupplyKey, traits.Type).Int64()
+	key := nftRarityPrefix + traits.Type
+	score, err := cs.rc.ZScore(key, tokenId).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return TokenRarity{}, fmt.Errorf("rarity of tokenId %s is not ranked yet", tokenId)
+		}
+		return TokenRarity{}, err
+	}
+	higher, err := cs.rc.ZCount(key, "("+strconv.FormatFloat(score, 'g', -1, 64), "+inf").Result()
+	if err != nil {
+		return TokenRarity{}, err
+	}
+	total, err := cs.rc.ZCard(key).Result()
+	if err != nil {
+		return TokenRarity{}, err
+	}
+	result := TokenRarity{
+		TokenId: tokenId,
+		Type:    traits.Type,
+		Score:   score,
+		Rank:    int(higher) + 1,
+		Total:   int(total),
+		Traits:  make([]TraitRarity, 0, len(traits.Attributes)),
+	}
+	for trait, value := range traits.Attributes {
+		count := counts[trait][value]
+		tr := TraitRarity{Trait: trait, Value: value, Count: count}
+		if supply > 0 {
+			tr.Frequency = float64(count) / float64(supply)
+		}
+		result.Traits = append(result.Traits, tr)
+	}
+	sort.Slice(result.Traits, func(i, j int) bool {
+		return result.Traits[i].Frequency < result.Traits[j].Frequency
+	})
+	return result, nil
+}
+
+func rarityScore(traits tokenTraits, counts map[string]map[string]int64, supply int64) float64 {
+	var score float64
+	for trait, value := range traits.Attributes {
+		if count := counts[trait][value]; count > 0 {
+			score += float64(supply) / float64(count)
+		}
+	}
+	return score
+}
+
+func (bl *BscListener) QueryNftStats(c *gin.Context) {
+	var service statsService
+	if err := c.ShouldBind(&service); err == nil {
+		if service.Limit <= 0 {
+			service.Limit = defaultTopHolders
+		}
+		summary, err := bl.stats.summary(service.Limit)
+		if err != nil {
+			c.JSON(200, serializer.Response{
+				Code: 500,
+				Msg:  err.Error(),
+			})
+			return
+		}
+		c.JSON(200, serializer.Response{
+			Code: 200,
+			Data: summary,
+		})
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) QueryNftTraits(c *gin.Context) {
+	var service traitsService
+	if err := c.ShouldBind(&service); err == nil {
+		counts, err := bl.stats.traitCounts(service.Type)
+		if err != nil {
+			c.JSON(200, serializer.Response{
+				Code: 500,
+				Msg:  err.Error(),
+			})
+			return
+		}
+		c.JSON(200, serializer.Response{
+			Code: 200,
+			Data: counts,
+		})
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) QueryNftRarity(c *gin.Context) {
+	var service rarityService
+	if err := c.ShouldBind(&service); err == nil {
+		rarity, err := bl.stats.rarity(service.TokenId)
+		if err != nil {
+			c.JSON(200, serializer.Response{
+				Code: 500,
+				Msg:  err.Error(),
+			})
+			return
+		}
+		c.JSON(200, serializer.Response{
+			Code: 200,
+			Data: rarity,
+		})
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
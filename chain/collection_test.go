@@ -0,0 +1,46 @@
+package chain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRarityScore(t *testing.T) {
+	counts := map[string]map[string]int64{
+		"rarity": {"rare": 1, "common": 3},
+		"level":  {"1": 2, "2": 2},
+	}
+	rare := tokenTraits{Type: "Soul", Attributes: map[string]string{"rarity": "rare", "level": "1"}}
+	common := tokenTraits{Type: "Soul", Attributes: map[string]string{"rarity": "common", "level": "2"}}
+
+	assert.Equal(t, float64(4)/1+float64(4)/2, rarityScore(rare, counts, 4))
+	assert.Equal(t, float64(4)/3+float64(4)/2, rarityScore(common, counts, 4))
+	assert.Greater(t, rarityScore(rare, counts, 4), rarityScore(common, counts, 4))
+	assert.Equal(t, "Soul|level|1", traitField("Soul", "level", "1"))
+}
+
+func TestRarityScores(t *testing.T) {
+	counts := map[string]map[string]int64{
+		"rarity": {"rare": 1, "common": 1},
+	}
+	stored := func(traits tokenTraits) string {
+		b, err := json.Marshal(traits)
+		assert.NoError(t, err)
+		return string(b)
+	}
+	all := map[string]string{
+		"1": stored(tokenTraits{Type: "Soul", Attributes: map[string]string{"rarity": "rare"}}),
+		"2": stored(tokenTraits{Type: "Soul", Attributes: map[string]string{"rarity": "common"}}),
+		"3": stored(tokenTraits{Type: "Land", Attributes: map[string]string{"rarity": "rare"}}),
+		"4": "{",
+	}
+	scores := rarityScores(all, "Soul", counts, 2)
+	assert.ElementsMatch(t, []redis.Z{
+		{Score: 2, Member: "1"},
+		{Score: 2, Member: "2"},
+	}, scores)
+	assert.Empty(t, rarityScores(all, "Sword", counts, 2))
+}
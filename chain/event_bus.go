@@ -1,11 +1,53 @@
 package chain
 
-import "sync"
+import (
+	"github.com/gin-gonic/gin"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+	"sync"
+	"sync/atomic"
+)
 
 const newBlockTopic = "newBlockTopic"
 
-var eb = &EventBus{
-	subscribers: map[string]DataChannelSlice{},
+const defaultQueueSize = 1024
+
+var eb = newEventBus()
+
+// OverflowPolicy decides what Publish does when a subscriber queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the publisher wait until the subscriber catches up.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest queued event to make room.
+	OverflowDropOldest
+	// OverflowSpill parks the event in an unbounded retry list that is moved
+	// back into the queue, in order, as soon as there is room.
+	OverflowSpill
+)
+
+var policyNames = map[OverflowPolicy]string{
+	OverflowBlock:      "block",
+	OverflowDropOldest: "drop-oldest",
+	OverflowSpill:      "spill",
+}
+
+func (p OverflowPolicy) String() string {
+	n, ok := policyNames[p]
+	if !ok {
+		return "unknown"
+	}
+	return n
+}
+
+func parseOverflowPolicy(name string) OverflowPolicy {
+	for p, n := range policyNames {
+		if n == name {
+			return p
+		}
+	}
+	return OverflowBlock
 }
 
 type DataEvent struct {
@@ -15,32 +57,243 @@ type DataEvent struct {
 
 type DataChannel chan DataEvent
 
-type DataChannelSlice []DataChannel
+type SubscribeOptions struct {
+	QueueSize int
+	Policy    OverflowPolicy
+}
+
+func defaultSubscribeOptions() SubscribeOptions {
+	opts := SubscribeOptions{
+		QueueSize: config.Cfg.EventBus.QueueSize,
+		Policy:    parseOverflowPolicy(config.Cfg.EventBus.Overflow),
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	return opts
+}
+
+// Subscription is one consumer of a topic. Events are delivered on C in the
+// order they were published, by a pump goroutine owned by the subscription.
+type Subscription struct {
+	// counters first to keep them 64-bit aligned for atomic access
+	published uint64
+	delivered uint64
+	dropped   uint64
+	spilled   uint64
+
+	topic  string
+	name   string
+	opts   SubscribeOptions
+	ch     DataChannel
+	done   chan struct{}
+	lk     sync.Mutex
+	cond   *sync.Cond
+	queue  []DataEvent
+	spill  []DataEvent
+	closed bool
+}
+
+type SubscriberMetrics struct {
+	Topic     string `json:"topic"`
+	Name      string `json:"name"`
+	Policy    string `json:"policy"`
+	QueueSize int    `json:"queueSize"`
+	Queued    int    `json:"queued"`
+	Spilled   int    `json:"spilled"`
+	Published uint64 `json:"published"`
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"`
+	Spills    uint64 `json:"spills"`
+}
+
+type EventBusMetrics struct {
+	Topics      map[string]uint64   `json:"topics"`
+	Subscribers []SubscriberMetrics `json:"subscribers"`
+}
 
 type EventBus struct {
-	subscribers map[string]DataChannelSlice
+	subscribers map[string][]*Subscription
+	published   map[string]*uint64
 	rm          sync.RWMutex
 }
 
-func (eb *EventBus) Subscribe(topic string, ch DataChannel) {
+func newEventBus() *EventBus {
+	return &EventBus{
+		subscribers: map[string][]*Subscription{},
+		published:   map[string]*uint64{},
+	}
+}
+
+func (eb *EventBus) Subscribe(topic, name string, opts SubscribeOptions) *Subscription {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	s := &Subscription{
+		topic: topic,
+		name:  name,
+		opts:  opts,
+		ch:    make(DataChannel),
+		done:  make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.lk)
+	go s.pump()
+
 	eb.rm.Lock()
-	if prev, found := eb.subscribers[topic]; found {
-		eb.subscribers[topic] = append(prev, ch)
-	} else {
-		eb.subscribers[topic] = append([]DataChannel{}, ch)
+	eb.subscribers[topic] = append(eb.subscribers[topic], s)
+	if _, found := eb.published[topic]; !found {
+		eb.published[topic] = new(uint64)
 	}
 	eb.rm.Unlock()
+	return s
+}
+
+// Unsubscribe stops delivery to s. Events still queued are discarded and C is
+// left open so that a consumer blocked on it does not read a zero event.
+func (eb *EventBus) Unsubscribe(s *Subscription) {
+	s.lk.Lock()
+	if s.closed {
+		s.lk.Unlock()
+		return
+	}
+	s.closed = true
+	s.queue = nil
+	s.spill = nil
+	close(s.done)
+	s.cond.Broadcast()
+	s.lk.Unlock()
+
+	eb.rm.Lock()
+	defer eb.rm.Unlock()
+	subs := eb.subscribers[s.topic]
+	for i, sub := range subs {
+		if sub == s {
+			eb.subscribers[s.topic] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
 }
 
+// Publish enqueues data for every subscriber of topic before returning, so
+// two publishes from the same goroutine are always delivered in order.
 func (eb *EventBus) Publish(topic string, data interface{}) {
 	eb.rm.RLock()
-	if chans, found := eb.subscribers[topic]; found {
-		channels := append(DataChannelSlice{}, chans...)
-		go func(data DataEvent, dataChannelSlices DataChannelSlice) {
-			for _, ch := range dataChannelSlices {
-				ch <- data
-			}
-		}(DataEvent{Data: data, Topic: topic}, channels)
+	subs := append([]*Subscription{}, eb.subscribers[topic]...)
+	if counter, found := eb.published[topic]; found {
+		atomic.AddUint64(counter, 1)
 	}
 	eb.rm.RUnlock()
+
+	de := DataEvent{Data: data, Topic: topic}
+	for _, s := range subs {
+		s.enqueue(de)
+	}
+}
+
+func (eb *EventBus) Metrics() EventBusMetrics {
+	eb.rm.RLock()
+	defer eb.rm.RUnlock()
+	m := EventBusMetrics{
+		Topics:      map[string]uint64{},
+		Subscribers: make([]SubscriberMetrics, 0),
+	}
+	for topic, counter := range eb.published {
+		m.Topics[topic] = atomic.LoadUint64(counter)
+	}
+	for _, subs := range eb.subscribers {
+		for _, s := range subs {
+			m.Subscribers = append(m.Subscribers, s.Metrics())
+		}
+	}
+	return m
+}
+
+// C returns the channel the subscriber reads events from.
+func (s *Subscription) C() DataChannel {
+	return s.ch
+}
+
+func (s *Subscription) Metrics() SubscriberMetrics {
+	s.lk.Lock()
+	queued, spilled := len(s.queue), len(s.spill)
+	s.lk.Unlock()
+	return SubscriberMetrics{
+		Topic:     s.topic,
+		Name:      s.name,
+		Policy:    s.opts.Policy.String(),
+		QueueSize: s.opts.QueueSize,
+		Queued:    queued,
+		Spilled:   spilled,
+		Published: atomic.LoadUint64(&s.published),
+		Delivered: atomic.LoadUint64(&s.delivered),
+		Dropped:   atomic.LoadUint64(&s.dropped),
+		Spills:    atomic.LoadUint64(&s.spilled),
+	}
+}
+
+func (s *Subscription) enqueue(de DataEvent) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.closed {
+		return
+	}
+	atomic.AddUint64(&s.published, 1)
+	if len(s.queue) < s.opts.QueueSize && len(s.spill) == 0 {
+		s.queue = append(s.queue, de)
+		s.cond.Broadcast()
+		return
+	}
+	switch s.opts.Policy {
+	case OverflowDropOldest:
+		s.queue = append(s.queue[1:], de)
+		atomic.AddUint64(&s.dropped, 1)
+		log.Warnf("event bus subscriber %s/%s is full, drop oldest event", s.topic, s.name)
+	case OverflowSpill:
+		s.spill = append(s.spill, de)
+		atomic.AddUint64(&s.spilled, 1)
+	default:
+		for len(s.queue) >= s.opts.QueueSize && !s.closed {
+			s.cond.Wait()
+		}
+		if s.closed {
+			return
+		}
+		s.queue = append(s.queue, de)
+		s.cond.Broadcast()
+	}
+}
+
+func (s *Subscription) pump() {
+	for {
+		s.lk.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.closed {
+			s.lk.Unlock()
+			return
+		}
+		de := s.queue[0]
+		s.queue = s.queue[1:]
+		if len(s.spill) > 0 {
+			s.queue = append(s.queue, s.spill[0])
+			s.spill = s.spill[1:]
+		}
+		s.cond.Broadcast()
+		s.lk.Unlock()
+
+		select {
+		case s.ch <- de:
+			atomic.AddUint64(&s.delivered, 1)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (bl *BscListener) QueryEventBusMetrics(c *gin.Context) {
+	c.JSON(200, serializer.Response{
+		Code: 200,
+		Data: eb.Metrics(),
+	})
 }
@@ -0,0 +1,59 @@
+package chain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func receive(t *testing.T, ch DataChannel) DataEvent {
+	select {
+	case de := <-ch:
+		return de
+	case <-time.After(time.Second):
+		t.Fatal("no event delivered")
+		return DataEvent{}
+	}
+}
+
+func TestEventBusOrderedDelivery(t *testing.T) {
+	bus := newEventBus()
+	sub := bus.Subscribe("topic", "ordered", SubscribeOptions{QueueSize: 4, Policy: OverflowSpill})
+	for i := 0; i < 10; i++ {
+		bus.Publish("topic", i)
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, i, receive(t, sub.C()).Data)
+	}
+	assert.Equal(t, uint64(10), bus.Metrics().Topics["topic"])
+	assert.Eventually(t, func() bool { return sub.Metrics().Delivered == 10 }, time.Second, time.Millisecond)
+}
+
+func TestEventBusDropOldest(t *testing.T) {
+	bus := newEventBus()
+	sub := bus.Subscribe("topic", "lossy", SubscribeOptions{QueueSize: 2, Policy: OverflowDropOldest})
+	bus.Publish("topic", 0)
+	// wait for the pump to hold event 0 so the queue itself is empty
+	assert.Eventually(t, func() bool { return sub.Metrics().Queued == 0 }, time.Second, time.Millisecond)
+	for i := 1; i <= 4; i++ {
+		bus.Publish("topic", i)
+	}
+	assert.Equal(t, 0, receive(t, sub.C()).Data)
+	assert.Equal(t, 3, receive(t, sub.C()).Data)
+	assert.Equal(t, 4, receive(t, sub.C()).Data)
+	assert.Equal(t, uint64(2), sub.Metrics().Dropped)
+}
+
+func TestEventBusUnsubscribe(t *testing.T) {
+	bus := newEventBus()
+	sub := bus.Subscribe("topic", "gone", SubscribeOptions{QueueSize: 1, Policy: OverflowBlock})
+	bus.Unsubscribe(sub)
+	bus.Publish("topic", 1)
+	assert.Empty(t, bus.Metrics().Subscribers)
+	select {
+	case <-sub.C():
+		t.Fatal("event delivered after unsubscribe")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,280 @@
+package chain
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/go-redis/redis"
+	"math/big"
+	"spike-blockchain-server/config"
+)
+
+// EventMapping declares how one contract event is turned into an output
+// message. Arguments are decoded by name, indexed ones from the topics and
+// the others from the log data.
+type EventMapping struct {
+	// Topic is the kafka topic the DecodedEvent is published on, leave it
+	// empty to only run Handle.
+	Topic string
+	// FinalizedOnly publishes on Topic only once the block is finalized,
+	// otherwise the event is published at every stage.
+	FinalizedOnly bool
+	// Fields renames ABI argument names in the published event, arguments
+	// not listed keep their ABI name.
+	Fields map[string]string
+	// Accept filters events before the receipt and block are queried.
+	Accept func(ev *DecodedEvent) bool
+	// Handle receives every accepted event, e.g. to translate it into an ERC20Tx.
+	Handle func(ev *DecodedEvent)
+}
+
+type DecodedEvent struct {
+	Contract    string                 `json:"contract"`
+	TokenType   string                 `json:"tokenType"`
+	Event       string                 `json:"event"`
+	TxHash      string                 `json:"txHash"`
+	LogIndex    uint                   `json:"logIndex"`
+	BlockNumber uint64                 `json:"blockNumber"`
+	Status      uint64                 `json:"status"`
+	PayTime     int64                  `json:"payTime"`
+	Stage       string                 `json:"stage"`
+	Fields      map[string]interface{} `json:"fields"`
+	decodedArgs
+	topic string
+}
+
+// decodedArgs holds ABI arguments by name, shared by events and calls.
+type decodedArgs map[string]interface{}
+
+func (a decodedArgs) Arg(name string) interface{} {
+	return a[name]
+}
+
+func (a decodedArgs) Address(name string) common.Address {
+	addr, _ := a[name].(common.Address)
+	return addr
+}
+
+func (a decodedArgs) BigInt(name string) *big.Int {
+	if v, ok := a[name].(*big.Int); ok {
+		return v
+	}
+	return new(big.Int)
+}
+
+// EventListener filters the logs of one contract and decodes the events
+// listed in its mappings, the listeners of every contract are built on it.
+type EventListener struct {
+	contractAddr   string
+	tokenType      TokenType
+	abi            abi.ABI
+	mappings       map[string]EventMapping
+	decodedNotify  chan DecodedEvent
+	newBlockNotify DataChannel
+	ec             *ethclient.Client
+	rc             *redis.Client
+	errorHandle    chan ErrMsg
+	tracker        *stageTracker
+}
+
+func newEventListener(contractAddr string, tokenType TokenType, contractAbi abi.ABI, mappings map[string]EventMapping, ec *ethclient.Client, rc *redis.Client, decodedNotify chan DecodedEvent, newBlockNotify DataChannel, errorHandle chan ErrMsg) *EventListener {
+	addConfiguredEvents(tokenType, contractAbi, mappings)
+	return &EventListener{
+		contractAddr:   contractAddr,
+		tokenType:      tokenType,
+		abi:            contractAbi,
+		mappings:       mappings,
+		decodedNotify:  decodedNotify,
+		newBlockNotify: newBlockNotify,
+		ec:             ec,
+		rc:             rc,
+		errorHandle:    errorHandle,
+		tracker:        newStageTracker(tokenType),
+	}
+}
+
+// addConfiguredEvents adds the [[events]] of the config that belong to the
+// contract, so publishing another event needs no code.
+func addConfiguredEvents(tokenType TokenType, contractAbi abi.ABI, mappings map[string]EventMapping) {
+	for _, e := range config.Cfg.Events {
+		if e.Contract != tokenType.String() {
+			continue
+		}
+		if _, ok := contractAbi.Events[e.Event]; !ok {
+			log.Errorf("configured event %s not found in %s abi", e.Event, e.Contract)
+			continue
+		}
+		m := mappings[e.Event]
+		m.Topic = e.Topic
+		if len(e.Fields) != 0 {
+			m.Fields = e.Fields
+		}
+		mappings[e.Event] = m
+	}
+}
+
+// mergeMappings adds the mappings of the other features listening on the
+// same contract, a later mapping replaces an earlier one of the same event.
+func mergeMappings(mappings ...map[string]EventMapping) map[string]EventMapping {
+	merged := make(map[string]EventMapping)
+	for _, m := range mappings {
+		for name, mapping := range m {
+			merged[name] = mapping
+		}
+	}
+	return merged
+}
+
+func (el *EventListener) run() {
+	go el.NewEventFilter()
+}
+
+func (el *EventListener) NewEventFilter() {
+	for {
+		select {
+		case de := <-el.newBlockNotify:
+			from, to, ok := el.tracker.rangeOf(de.Data.(blockEvent))
+			if ok {
+				el.handlePastBlock(from, to, de.Data.(blockEvent).stage)
+			}
+		}
+	}
+}
+
+func (el *EventListener) handlePastBlock(fromBlockNum, toBlockNum *big.Int, stage txStage) error {
+	log.Infof("event filter, type : %s, stage : %s, fromBlock : %d, toBlock : %d ", el.tokenType.String(), stage, fromBlockNum, toBlockNum)
+	ids := make([]common.Hash, 0, len(el.mappings))
+	for name := range el.mappings {
+		if event, ok := el.abi.Events[name]; ok {
+			ids = append(ids, event.ID)
+		}
+	}
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{common.HexToAddress(el.contractAddr)},
+		FromBlock: fromBlockNum,
+		ToBlock:   toBlockNum,
+		Topics:    [][]common.Hash{ids},
+	}
+
+	sub, err := el.ec.FilterLogs(context.Background(), query)
+	if err != nil {
+		el.errorHandle <- ErrMsg{
+			tp:    el.tokenType,
+			stage: stage,
+			from:  fromBlockNum,
+			to:    toBlockNum,
+		}
+		log.Errorf("event filter err : %+v, from : %d, to : %d, type : %s", err, fromBlockNum.Int64(), toBlockNum.Int64(), el.tokenType.String())
+		return err
+	}
+	blockTime := make(map[uint64]uint64)
+	for _, l := range sub {
+		msg := ErrMsg{
+			tp:    el.tokenType,
+			stage: stage,
+			from:  big.NewInt(int64(l.BlockNumber)),
+			to:    big.NewInt(int64(l.BlockNumber)),
+		}
+		event, err := el.abi.EventByID(l.Topics[0])
+		if err != nil {
+			continue
+		}
+		mapping, ok := el.mappings[event.Name]
+		if !ok {
+			continue
+		}
+		args, err := decodeLog(*event, l)
+		if err != nil {
+			log.Errorf("%s %s unpack err : %+v", el.tokenType.String(), event.Name, err)
+			el.errorHandle <- msg
+			continue
+		}
+		ev := &DecodedEvent{
+			Contract:    l.Address.Hex(),
+			TokenType:   el.tokenType.String(),
+			Event:       event.Name,
+			TxHash:      l.TxHash.Hex(),
+			LogIndex:    l.Index,
+			BlockNumber: l.BlockNumber,
+			Stage:       stage.String(),
+			Fields:      jsonFields(args, mapping.Fields),
+			decodedArgs: args,
+			topic:       mapping.Topic,
+		}
+		if mapping.Accept != nil && !mapping.Accept(ev) {
+			continue
+		}
+		recp, err := el.ec.TransactionReceipt(context.Background(), l.TxHash)
+		if err != nil {
+			el.errorHandle <- msg
+			log.Errorf("query txReceipt txHash : %s, err : %+v", l.TxHash, err)
+			continue
+		}
+		if _, ok := blockTime[l.BlockNumber]; !ok {
+			header, err := el.ec.HeaderByNumber(context.Background(), big.NewInt(int64(l.BlockNumber)))
+			if err != nil {
+				el.errorHandle <- msg
+				log.Errorf("query HeaderByNumber blockNum : %d, err : %+v", l.BlockNumber, err)
+				continue
+			}
+			blockTime[l.BlockNumber] = header.Time
+		}
+		ev.Status = recp.Status
+		ev.PayTime = int64(blockTime[l.BlockNumber] * 1000)
+
+		if mapping.Handle != nil {
+			mapping.Handle(ev)
+		}
+		if mapping.Topic != "" && (!mapping.FinalizedOnly || stage == stageFinalized) {
+			el.decodedNotify <- *ev
+		}
+	}
+	return nil
+}
+
+func decodeLog(event abi.Event, l types.Log) (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	if len(event.Inputs.NonIndexed()) != 0 {
+		if err := event.Inputs.UnpackIntoMap(args, l.Data); err != nil {
+			return nil, err
+		}
+	}
+	var indexed abi.Arguments
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(args, indexed, l.Topics[1:]); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+func jsonFields(args map[string]interface{}, rename map[string]string) map[string]interface{} {
+	fields := make(map[string]interface{}, len(args))
+	for name, v := range args {
+		if n, ok := rename[name]; ok {
+			name = n
+		}
+		switch t := v.(type) {
+		case *big.Int:
+			fields[name] = t.String()
+		case common.Address:
+			fields[name] = t.Hex()
+		case common.Hash:
+			fields[name] = t.Hex()
+		case [32]byte:
+			fields[name] = hexutil.Encode(t[:])
+		case []byte:
+			fields[name] = hexutil.Encode(t)
+		default:
+			fields[name] = v
+		}
+	}
+	return fields
+}
@@ -0,0 +1,48 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeLog(t *testing.T) {
+	nftAbi := getABI(GameNftABI)
+	from := common.HexToAddress("0x43a0D6FcD600f061B38e80D6580Ab900Ed67dFF1")
+	user := common.HexToAddress("0x33AD388F713f7A043504f9c0b717841aC5a34e0B")
+
+	transfer := types.Log{
+		Topics: []common.Hash{
+			nftAbi.Events["Transfer"].ID,
+			common.BytesToHash(from.Bytes()),
+			common.BytesToHash(user.Bytes()),
+			common.BigToHash(big.NewInt(42)),
+		},
+	}
+	args, err := decodeLog(nftAbi.Events["Transfer"], transfer)
+	assert.NoError(t, err)
+	ev := &DecodedEvent{decodedArgs: args}
+	assert.Equal(t, from, ev.Address("from"))
+	assert.Equal(t, user, ev.Address("to"))
+	assert.Equal(t, int64(42), ev.BigInt("tokenId").Int64())
+
+	data, err := nftAbi.Events["UpdateUser"].Inputs.NonIndexed().Pack(uint64(1700000000))
+	assert.NoError(t, err)
+	updateUser := types.Log{
+		Topics: []common.Hash{
+			nftAbi.Events["UpdateUser"].ID,
+			common.BigToHash(big.NewInt(7)),
+			common.BytesToHash(user.Bytes()),
+		},
+		Data: data,
+	}
+	args, err = decodeLog(nftAbi.Events["UpdateUser"], updateUser)
+	assert.NoError(t, err)
+	fields := jsonFields(args, map[string]string{"user": "renter"})
+	assert.Equal(t, "7", fields["tokenId"])
+	assert.Equal(t, user.Hex(), fields["renter"])
+	assert.Equal(t, uint64(1700000000), fields["expires"])
+}
@@ -0,0 +1,289 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/shopspring/decimal"
+	"math/big"
+	"sort"
+	"spike-blockchain-server/serializer"
+	"spike-blockchain-server/service/price"
+	"sync"
+)
+
+const (
+	gasOracleKey    = "gas_oracle"
+	gasSampleBlocks = 20
+)
+
+// gasPercentiles are the slow, standard and fast levels.
+var gasPercentiles = []float64{25, 50, 90}
+
+type GasPrices struct {
+	BlockNumber uint64 `json:"blockNumber"`
+	BaseFee     string `json:"baseFee"`
+	Slow        string `json:"slow"`
+	Standard    string `json:"standard"`
+	Fast        string `json:"fast"`
+}
+
+type GasFee struct {
+	GasPrice string `json:"gasPrice"`
+	Gwei     string `json:"gwei"`
+	// Fee and FeeUsd are only set when a call was estimated.
+	Fee    string  `json:"fee,omitempty"`
+	FeeUsd float64 `json:"feeUsd,omitempty"`
+}
+
+type GasQuote struct {
+	BlockNumber uint64  `json:"blockNumber"`
+	BaseFee     string  `json:"baseFee"`
+	Gas         uint64  `json:"gas,omitempty"`
+	BnbUsd      float64 `json:"bnbUsd,omitempty"`
+	Slow        GasFee  `json:"slow"`
+	Standard    GasFee  `json:"standard"`
+	Fast        GasFee  `json:"fast"`
+}
+
+type gasService struct {
+	From  string `form:"from" json:"from"`
+	To    string `form:"to" json:"to"`
+	Data  string `form:"data" json:"data"`
+	Value string `form:"value" json:"value"`
+}
+
+type feeHistory struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	Reward       [][]*hexutil.Big `json:"reward"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+}
+
+// GasOracle samples the gas prices paid in the recent blocks. It asks the
+// node for eth_feeHistory and reads the transactions of the blocks when the
+// node has no fee history, as legacy bsc nodes. The prices are cached per
+// block.
+type GasOracle struct {
+	ec  *ethclient.Client
+	rpc *rpc.Client
+	rc  *redis.Client
+	lk  sync.Mutex
+}
+
+func newGasOracle(ec *ethclient.Client, rpcClient *rpc.Client, rc *redis.Client) *GasOracle {
+	return &GasOracle{
+		ec:  ec,
+		rpc: rpcClient,
+		rc:  rc,
+	}
+}
+
+func (g *GasOracle) prices() (GasPrices, error) {
+	head, err := g.ec.BlockNumber(context.Background())
+	if err != nil {
+		return GasPrices{}, err
+	}
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	var cached GasPrices
+	if val, err := g.rc.Get(gasOracleKey).Result(); err == nil && json.Unmarshal([]byte(val), &cached) == nil && cached.BlockNumber == head {
+		return cached, nil
+	}
+	levels, baseFee, err := g.fromFeeHistory(head)
+	if err != nil {
+		log.Warnf("gas oracle fee history err : %+v, sampling blocks", err)
+		baseFee = new(big.Int)
+		if levels, err = g.fromBlocks(head); err != nil {
+			return GasPrices{}, err
+		}
+	}
+	if levels[0].Sign() == 0 {
+		// the sampled blocks were empty
+		suggested, err := g.ec.SuggestGasPrice(context.Background())
+		if err != nil {
+			return GasPrices{}, err
+		}
+		for i := range levels {
+			if levels[i].Sign() == 0 {
+				levels[i] = suggested
+			}
+		}
+	}
+	prices := GasPrices{
+		BlockNumber: head,
+		BaseFee:     baseFee.String(),
+		Slow:        levels[0].String(),
+		Standard:    levels[1].String(),
+		Fast:        levels[2].String(),
+	}
+	if b, err := json.Marshal(prices); err == nil {
+		g.rc.Set(gasOracleKey, string(b), 0)
+	}
+	return prices, nil
+}
+
+// fromFeeHistory returns the levels as the next base fee plus the median of
+// the tips paid at each percentile by the non empty blocks.
+func (g *GasOracle) fromFeeHistory(head uint64) ([]*big.Int, *big.Int, error) {
+	var fh feeHistory
+	err := g.rpc.CallContext(context.Background(), &fh, "eth_feeHistory", hexutil.Uint(gasSampleBlocks), hexutil.Uint64(head), gasPercentiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(fh.Reward) == 0 || len(fh.BaseFee) == 0 {
+		return nil, nil, ethereum.NotFound
+	}
+	baseFee := fh.BaseFee[len(fh.BaseFee)-1].ToInt()
+	levels := make([]*big.Int, len(gasPercentiles))
+	for i := range gasPercentiles {
+		tips := make([]*big.Int, 0, len(fh.Reward))
+		for b, reward := range fh.Reward {
+			if (b < len(fh.GasUsedRatio) && fh.GasUsedRatio[b] == 0) || len(reward) <= i {
+				continue
+			}
+			tips = append(tips, reward[i].ToInt())
+		}
+		if len(tips) == 0 {
+			return nil, nil, ethereum.NotFound
+		}
+		sortBig(tips)
+		levels[i] = new(big.Int).Add(baseFee, percentile(tips, 50))
+	}
+	return levels, baseFee, nil
+}
+
+// fromBlocks returns the percentiles of the gas prices of the transactions
+// in the recent blocks, the zero priced system transactions left out.
+func (g *GasOracle) fromBlocks(head uint64) ([]*big.Int, error) {
+	gasPrices := make([]*big.Int, 0)
+	for n := head; n+gasSampleBlocks > head && n > 0; n-- {
+		block, err := g.ec.BlockByNumber(context.Background(), new(big.Int).SetUint64(n))
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Transactions() {
+			if tx.GasPrice().Sign() > 0 {
+				gasPrices = append(gasPrices, tx.GasPrice())
+			}
+		}
+	}
+	sortBig(gasPrices)
+	levels := make([]*big.Int, len(gasPercentiles))
+	for i, p := range gasPercentiles {
+		levels[i] = percentile(gasPrices, p)
+	}
+	return levels, nil
+}
+
+func sortBig(values []*big.Int) {
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Cmp(values[j]) < 0
+	})
+}
+
+// percentile is the nearest rank percentile of sorted values, zero when
+// there are none.
+func percentile(sorted []*big.Int, p float64) *big.Int {
+	if len(sorted) == 0 {
+		return new(big.Int)
+	}
+	i := int(p / 100 * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func (g *GasOracle) quote(call *ethereum.CallMsg) (GasQuote, error) {
+	prices, err := g.prices()
+	if err != nil {
+		return GasQuote{}, err
+	}
+	q := GasQuote{
+		BlockNumber: prices.BlockNumber,
+		BaseFee:     prices.BaseFee,
+	}
+	if call != nil {
+		if q.Gas, err = g.ec.EstimateGas(context.Background(), *call); err != nil {
+			return GasQuote{}, err
+		}
+		if p, err := price.GetPrice("bnb"); err != nil {
+			log.Errorf("query bnb price err : %+v", err)
+		} else {
+			q.BnbUsd = p.UsdPrice
+		}
+	}
+	q.Slow = q.fee(prices.Slow)
+	q.Standard = q.fee(prices.Standard)
+	q.Fast = q.fee(prices.Fast)
+	return q, nil
+}
+
+func (q GasQuote) fee(gasPrice string) GasFee {
+	f := GasFee{
+		GasPrice: gasPrice,
+		Gwei:     ToDecimal(gasPrice, 9).String(),
+	}
+	if q.Gas == 0 {
+		return f
+	}
+	wei, _ := new(big.Int).SetString(gasPrice, 10)
+	fee := ToDecimal(new(big.Int).Mul(wei, new(big.Int).SetUint64(q.Gas)), nativeDecimals)
+	f.Fee = fee.String()
+	f.FeeUsd, _ = fee.Mul(decimal.NewFromFloat(q.BnbUsd)).Float64()
+	return f
+}
+
+func (bl *BscListener) QueryGas(c *gin.Context) {
+	var service gasService
+	if err := c.ShouldBind(&service); err == nil && (service.To == "" || common.IsHexAddress(service.To)) && (service.From == "" || common.IsHexAddress(service.From)) {
+		res := bl.queryGas(service)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) queryGas(service gasService) serializer.Response {
+	var call *ethereum.CallMsg
+	if service.To != "" {
+		to := common.HexToAddress(service.To)
+		call = &ethereum.CallMsg{
+			From: common.HexToAddress(service.From),
+			To:   &to,
+			Data: common.FromHex(service.Data),
+		}
+		if service.Value != "" {
+			value, ok := new(big.Int).SetString(service.Value, 10)
+			if !ok {
+				return serializer.Response{
+					Code: 500,
+					Msg:  ErrorParam.Error(),
+				}
+			}
+			call.Value = value
+		}
+	}
+	q, err := bl.gas.quote(call)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Msg:   "chain node err ",
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: q,
+	}
+}
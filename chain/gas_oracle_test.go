@@ -0,0 +1,33 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGasPercentile(t *testing.T) {
+	values := make([]*big.Int, 0, 10)
+	for _, v := range []int64{10, 3, 7, 1, 5, 9, 2, 8, 4, 6} {
+		values = append(values, big.NewInt(v))
+	}
+	sortBig(values)
+	assert.Equal(t, int64(3), percentile(values, 25).Int64())
+	assert.Equal(t, int64(6), percentile(values, 50).Int64())
+	assert.Equal(t, int64(10), percentile(values, 90).Int64())
+	assert.Equal(t, int64(10), percentile(values, 100).Int64())
+	assert.Equal(t, int64(0), percentile(nil, 50).Int64())
+}
+
+func TestGasQuoteFee(t *testing.T) {
+	q := GasQuote{Gas: 21000, BnbUsd: 300}
+	f := q.fee("5000000000")
+	assert.Equal(t, "5", f.Gwei)
+	assert.Equal(t, "0.000105", f.Fee)
+	assert.InDelta(t, 0.0315, f.FeeUsd, 1e-9)
+
+	f = GasQuote{}.fee("3000000000")
+	assert.Equal(t, "3", f.Gwei)
+	assert.Empty(t, f.Fee)
+}
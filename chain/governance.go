@@ -0,0 +1,831 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"math/big"
+	"sort"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	govProposalsKey        = "gov_proposals"
+	govProposalPrefix      = "gov_proposal_"
+	govVotesPrefix         = "gov_votes_"
+	govPowerPrefix         = "gov_power_"
+	govSnapshotPrefix      = "gov_snapshot_"
+	govDelegationKey       = "gov_delegation"
+	govDelegationPrefix    = "gov_delegation_"
+	govDelegationTimeKey   = "gov_delegation_time"
+	govDomainName          = "Spike Governance"
+	govDomainVersion       = "1"
+	govSignatureMaxAge     = 10 * time.Minute
+	holdersReplayRetry     = 5
+	defaultProposalsLimit  = 20
+	maxProposalChoices     = 10
+	proposalVotingDuration = 7 * 24 * time.Hour
+)
+
+var govTypes = apitypes.Types{
+	"EIP712Domain": {
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "chainId", Type: "uint256"},
+	},
+	"Vote": {
+		{Name: "proposalId", Type: "string"},
+		{Name: "choice", Type: "uint32"},
+		{Name: "voter", Type: "address"},
+		{Name: "timestamp", Type: "uint64"},
+	},
+	"Delegation": {
+		{Name: "delegator", Type: "address"},
+		{Name: "delegate", Type: "address"},
+		{Name: "timestamp", Type: "uint64"},
+	},
+}
+
+type Proposal struct {
+	Id            string   `json:"id"`
+	Title         string   `json:"title"`
+	Body          string   `json:"body"`
+	Choices       []string `json:"choices"`
+	SnapshotBlock uint64   `json:"snapshotBlock"`
+	Start         int64    `json:"start"`
+	End           int64    `json:"end"`
+	CreateTime    int64    `json:"createTime"`
+}
+
+// Vote is signed by Voter as the EIP-712 Vote type, Choice starts at 1.
+type Vote struct {
+	ProposalId string `json:"proposalId" binding:"required"`
+	Choice     uint32 `json:"choice" binding:"required"`
+	Voter      string `json:"voter" binding:"required"`
+	Timestamp  uint64 `json:"timestamp" binding:"required"`
+	Signature  string `json:"signature" binding:"required"`
+}
+
+// Delegation is signed by Delegator as the EIP-712 Delegation type, the
+// zero address as Delegate clears it.
+type Delegation struct {
+	Delegator string `json:"delegator" binding:"required"`
+	Delegate  string `json:"delegate" binding:"required"`
+	Timestamp uint64 `json:"timestamp" binding:"required"`
+	Signature string `json:"signature" binding:"required"`
+}
+
+type ChoiceTally struct {
+	Choice  uint32 `json:"choice"`
+	Name    string `json:"name"`
+	Power   string `json:"power"`
+	Amount  string `json:"amount"`
+	Voters  int    `json:"voters"`
+	Percent string `json:"percent"`
+}
+
+type Tally struct {
+	ProposalId string        `json:"proposalId"`
+	Choices    []ChoiceTally `json:"choices"`
+	TotalPower string        `json:"totalPower"`
+	Voters     int           `json:"voters"`
+	Final      bool          `json:"final"`
+}
+
+type proposalService struct {
+	Title         string   `json:"title" binding:"required"`
+	Body          string   `json:"body"`
+	Choices       []string `json:"choices" binding:"required"`
+	SnapshotBlock uint64   `json:"snapshotBlock"`
+	Start         int64    `json:"start"`
+	End           int64    `json:"end"`
+}
+
+type proposalListService struct {
+	Offset int64 `form:"offset" json:"offset"`
+	Limit  int64 `form:"limit" json:"limit"`
+}
+
+type proposalQueryService struct {
+	Id string `form:"id" json:"id" binding:"required"`
+}
+
+type votingPowerService struct {
+	ProposalId string `form:"proposalId" json:"proposalId" binding:"required"`
+	Address    string `form:"address" json:"address" binding:"required"`
+}
+
+// Governance stores proposals and EIP-712 signed votes and delegations. The
+// voting power of an address is its SKK balance at the proposal snapshot
+// block plus the balance of those delegating to it who did not vote. The
+// balances of every holder are taken once when the proposal is created,
+// until then they are read from the archive node.
+type Governance struct {
+	rc        *redis.Client
+	tokens    *TokenRegistry
+	domain    apitypes.TypedDataDomain
+	balanceAt func(owners []common.Address, block uint64) ([]*big.Int, error)
+	holdersAt func(block uint64) (map[string]*big.Int, error)
+	lk        sync.Mutex
+}
+
+func newGovernance(rc *redis.Client, tokens *TokenRegistry, chainId *big.Int, balanceAt func([]common.Address, uint64) ([]*big.Int, error), holdersAt func(uint64) (map[string]*big.Int, error)) *Governance {
+	return &Governance{
+		rc:     rc,
+		tokens: tokens,
+		domain: apitypes.TypedDataDomain{
+			Name:    govDomainName,
+			Version: govDomainVersion,
+			ChainId: (*math.HexOrDecimal256)(chainId),
+		},
+		balanceAt: balanceAt,
+		holdersAt: holdersAt,
+	}
+}
+
+func (g *Governance) typedDataHash(primaryType string, message apitypes.TypedDataMessage) ([]byte, error) {
+	td := apitypes.TypedData{
+		Types:       govTypes,
+		PrimaryType: primaryType,
+		Domain:      g.domain,
+		Message:     message,
+	}
+	domainSeparator, err := td.HashStruct("EIP712Domain", td.Domain.Map())
+	if err != nil {
+		return nil, err
+	}
+	messageHash, err := td.HashStruct(primaryType, message)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256([]byte("\x19\x01"), domainSeparator, messageHash), nil
+}
+
+func (g *Governance) voteHash(v Vote) ([]byte, error) {
+	return g.typedDataHash("Vote", apitypes.TypedDataMessage{
+		"proposalId": v.ProposalId,
+		"choice":     strconv.FormatUint(uint64(v.Choice), 10),
+		"voter":      v.Voter,
+		"timestamp":  strconv.FormatUint(v.Timestamp, 10),
+	})
+}
+
+func (g *Governance) delegationHash(d Delegation) ([]byte, error) {
+	return g.typedDataHash("Delegation", apitypes.TypedDataMessage{
+		"delegator": d.Delegator,
+		"delegate":  d.Delegate,
+		"timestamp": strconv.FormatUint(d.Timestamp, 10),
+	})
+}
+
+// verifySigned checks that sign over hash comes from signer and that it was
+// made recently, the timestamps also order repeated votes.
+func verifySigned(hash []byte, sign, signer string, timestamp uint64) error {
+	if !common.IsHexAddress(signer) {
+		return ErrorParam
+	}
+	age := time.Since(time.Unix(int64(timestamp), 0))
+	if age > govSignatureMaxAge || age < -govSignatureMaxAge {
+		return errors.New("signature timestamp is out of range")
+	}
+	sig, err := hexutil.Decode(sign)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return errors.New("invalid signature")
+	}
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return errors.New("invalid signature")
+	}
+	if crypto.PubkeyToAddress(*pub) != common.HexToAddress(signer) {
+		return errors.New("signature does not match the signer")
+	}
+	return nil
+}
+
+func (g *Governance) createProposal(service proposalService, head uint64) (*Proposal, error) {
+	if len(service.Choices) < 2 || len(service.Choices) > maxProposalChoices {
+		return nil, fmt.Errorf("a proposal needs 2 to %d choices", maxProposalChoices)
+	}
+	now := time.Now()
+	p := &Proposal{
+		Id:            uuid.New().String(),
+		Title:         service.Title,
+		Body:          service.Body,
+		Choices:       service.Choices,
+		SnapshotBlock: service.SnapshotBlock,
+		Start:         service.Start,
+		End:           service.End,
+		CreateTime:    now.UnixMilli(),
+	}
+	if p.SnapshotBlock == 0 || p.SnapshotBlock > head {
+		p.SnapshotBlock = head
+	}
+	if p.Start == 0 {
+		p.Start = now.Unix()
+	}
+	if p.End == 0 {
+		p.End = time.Unix(p.Start, 0).Add(proposalVotingDuration).Unix()
+	}
+	if p.End <= p.Start {
+		return nil, errors.New("proposal end is before its start")
+	}
+	// delegations are frozen with the proposal like its balances
+	delegation, err := g.rc.HGetAll(govDelegationKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(delegation) != 0 {
+		fields := make(map[string]interface{}, len(delegation))
+		for k, v := range delegation {
+			fields[k] = v
+		}
+		if err := g.rc.HMSet(govDelegationPrefix+p.Id, fields).Err(); err != nil {
+			return nil, err
+		}
+	}
+	val, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.rc.Set(govProposalPrefix+p.Id, string(val), 0).Err(); err != nil {
+		return nil, err
+	}
+	g.rc.ZAdd(govProposalsKey, redis.Z{Score: float64(p.CreateTime), Member: p.Id})
+	go g.snapshot(p)
+	return p, nil
+}
+
+// snapshot stores the balance of every holder at the snapshot block, votes
+// then never read balances again. The marker is only set once every balance
+// is stored, until then votes read the missing balances from the node.
+func (g *Governance) snapshot(p *Proposal) {
+	if g.holdersAt == nil {
+		return
+	}
+	holders, err := g.holdersAt(p.SnapshotBlock)
+	if err != nil {
+		log.Errorf("governance snapshot of %s err : %+v", p.Id, err)
+		return
+	}
+	fields := make(map[string]interface{}, len(holders))
+	for addr, balance := range holders {
+		fields[addr] = balance.String()
+		if len(fields) == 1000 {
+			if err := g.rc.HMSet(govPowerPrefix+p.Id, fields).Err(); err != nil {
+				log.Errorf("governance snapshot of %s err : %+v", p.Id, err)
+				return
+			}
+			fields = make(map[string]interface{}, len(holders))
+		}
+	}
+	if len(fields) != 0 {
+		if err := g.rc.HMSet(govPowerPrefix+p.Id, fields).Err(); err != nil {
+			log.Errorf("governance snapshot of %s err : %+v", p.Id, err)
+			return
+		}
+	}
+	if err := g.rc.Set(govSnapshotPrefix+p.Id, len(holders), 0).Err(); err != nil {
+		log.Errorf("governance snapshot of %s err : %+v", p.Id, err)
+		return
+	}
+	log.Infof("governance snapshot of %s done, holders : %d", p.Id, len(holders))
+}
+
+func (g *Governance) proposal(id string) (*Proposal, error) {
+	val, err := g.rc.Get(govProposalPrefix + id).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("proposal %s not found", id)
+		}
+		return nil, err
+	}
+	var p Proposal
+	err = json.Unmarshal([]byte(val), &p)
+	return &p, err
+}
+
+func (g *Governance) proposals(offset, limit int64) ([]Proposal, error) {
+	ids, err := g.rc.ZRevRange(govProposalsKey, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	proposals := make([]Proposal, 0, len(ids))
+	for _, id := range ids {
+		p, err := g.proposal(id)
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, *p)
+	}
+	return proposals, nil
+}
+
+func (g *Governance) delegate(d Delegation) error {
+	hash, err := g.delegationHash(d)
+	if err != nil {
+		return err
+	}
+	if err := verifySigned(hash, d.Signature, d.Delegator, d.Timestamp); err != nil {
+		return err
+	}
+	delegator := strings.ToLower(common.HexToAddress(d.Delegator).Hex())
+	delegate := common.HexToAddress(d.Delegate)
+	if strings.EqualFold(delegate.Hex(), delegator) {
+		return errors.New("can not delegate to yourself")
+	}
+	// a signed delegation is only accepted once and never after a newer one
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	if last, err := g.rc.HGet(govDelegationTimeKey, delegator).Uint64(); err == nil && last >= d.Timestamp {
+		return errors.New("a newer delegation is already recorded")
+	}
+	if delegate == (common.Address{}) {
+		err = g.rc.HDel(govDelegationKey, delegator).Err()
+	} else {
+		err = g.rc.HSet(govDelegationKey, delegator, strings.ToLower(delegate.Hex())).Err()
+	}
+	if err != nil {
+		return err
+	}
+	return g.rc.HSet(govDelegationTimeKey, delegator, d.Timestamp).Err()
+}
+
+func (g *Governance) vote(v Vote) error {
+	p, err := g.proposal(v.ProposalId)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	if now < p.Start || now > p.End {
+		return errors.New("proposal is not open for voting")
+	}
+	if v.Choice < 1 || int(v.Choice) > len(p.Choices) {
+		return ErrorParam
+	}
+	hash, err := g.voteHash(v)
+	if err != nil {
+		return err
+	}
+	if err := verifySigned(hash, v.Signature, v.Voter, v.Timestamp); err != nil {
+		return err
+	}
+	voter := strings.ToLower(common.HexToAddress(v.Voter).Hex())
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	if prev, err := g.votes(p.Id); err == nil {
+		if last, ok := prev[voter]; ok && last.Timestamp >= v.Timestamp {
+			return errors.New("a newer vote is already recorded")
+		}
+	}
+	power, err := g.votingPower(p, voter)
+	if err != nil {
+		return err
+	}
+	if power.Sign() == 0 {
+		return errors.New("no voting power at the snapshot block")
+	}
+	val, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return g.rc.HSet(govVotesPrefix+p.Id, voter, string(val)).Err()
+}
+
+func (g *Governance) votes(id string) (map[string]Vote, error) {
+	fields, err := g.rc.HGetAll(govVotesPrefix + id).Result()
+	if err != nil {
+		return nil, err
+	}
+	votes := make(map[string]Vote, len(fields))
+	for voter, val := range fields {
+		var v Vote
+		if err := json.Unmarshal([]byte(val), &v); err != nil {
+			return nil, err
+		}
+		votes[voter] = v
+	}
+	return votes, nil
+}
+
+// powers returns the snapshot balances of addrs, balances at a past block
+// never change so they are kept per proposal. Once the snapshot is done an
+// address it does not hold had no balance.
+func (g *Governance) powers(p *Proposal, addrs []string) (map[string]*big.Int, error) {
+	powers := make(map[string]*big.Int, len(addrs))
+	if len(addrs) == 0 {
+		return powers, nil
+	}
+	cached, err := g.rc.HMGet(govPowerPrefix+p.Id, addrs...).Result()
+	if err != nil {
+		return nil, err
+	}
+	snapshotted := g.rc.Exists(govSnapshotPrefix+p.Id).Val() == 1
+	missing := make([]common.Address, 0)
+	for i, addr := range addrs {
+		if s, ok := cached[i].(string); ok {
+			if n, ok := new(big.Int).SetString(s, 10); ok {
+				powers[addr] = n
+				continue
+			}
+		}
+		if snapshotted {
+			powers[addr] = new(big.Int)
+			continue
+		}
+		missing = append(missing, common.HexToAddress(addr))
+	}
+	if len(missing) == 0 {
+		return powers, nil
+	}
+	balances, err := g.balanceAt(missing, p.SnapshotBlock)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{}, len(missing))
+	for i, addr := range missing {
+		key := strings.ToLower(addr.Hex())
+		powers[key] = balances[i]
+		fields[key] = balances[i].String()
+	}
+	g.rc.HMSet(govPowerPrefix+p.Id, fields)
+	return powers, nil
+}
+
+func (g *Governance) delegation(id string) (map[string]string, error) {
+	return g.rc.HGetAll(govDelegationPrefix + id).Result()
+}
+
+// votingPower is what voter would add to a choice if it voted now.
+func (g *Governance) votingPower(p *Proposal, voter string) (*big.Int, error) {
+	delegation, err := g.delegation(p.Id)
+	if err != nil {
+		return nil, err
+	}
+	votes, err := g.votes(p.Id)
+	if err != nil {
+		return nil, err
+	}
+	votes[voter] = Vote{Voter: voter}
+	addrs := powerAddresses(votes, delegation)
+	powers, err := g.powers(p, addrs)
+	if err != nil {
+		return nil, err
+	}
+	return effectivePower(voter, votes, delegation, powers), nil
+}
+
+func (g *Governance) tally(p *Proposal) (*Tally, error) {
+	delegation, err := g.delegation(p.Id)
+	if err != nil {
+		return nil, err
+	}
+	votes, err := g.votes(p.Id)
+	if err != nil {
+		return nil, err
+	}
+	powers, err := g.powers(p, powerAddresses(votes, delegation))
+	if err != nil {
+		return nil, err
+	}
+	t := tallyVotes(p, votes, delegation, powers, g.tokens.decimalsOf(governanceToken))
+	t.Final = time.Now().Unix() > p.End
+	return t, nil
+}
+
+// powerAddresses lists the voters and everyone delegating to a voter.
+func powerAddresses(votes map[string]Vote, delegation map[string]string) []string {
+	addrs := make([]string, 0, len(votes))
+	for voter := range votes {
+		addrs = append(addrs, voter)
+	}
+	for delegator, delegate := range delegation {
+		if _, ok := votes[delegate]; !ok {
+			continue
+		}
+		if _, ok := votes[delegator]; !ok {
+			addrs = append(addrs, delegator)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// effectivePower is the own power of voter plus the power delegated to it
+// by addresses that did not vote themselves, a direct vote overrides the
+// delegation.
+func effectivePower(voter string, votes map[string]Vote, delegation map[string]string, powers map[string]*big.Int) *big.Int {
+	power := new(big.Int)
+	if own, ok := powers[voter]; ok {
+		power.Add(power, own)
+	}
+	for delegator, delegate := range delegation {
+		if delegate != voter {
+			continue
+		}
+		if _, voted := votes[delegator]; voted {
+			continue
+		}
+		if p, ok := powers[delegator]; ok {
+			power.Add(power, p)
+		}
+	}
+	return power
+}
+
+func tallyVotes(p *Proposal, votes map[string]Vote, delegation map[string]string, powers map[string]*big.Int, decimals uint8) *Tally {
+	sums := make([]*big.Int, len(p.Choices))
+	voters := make([]int, len(p.Choices))
+	for i := range sums {
+		sums[i] = new(big.Int)
+	}
+	total := new(big.Int)
+	for voter, v := range votes {
+		if v.Choice < 1 || int(v.Choice) > len(p.Choices) {
+			continue
+		}
+		power := effectivePower(voter, votes, delegation, powers)
+		sums[v.Choice-1].Add(sums[v.Choice-1], power)
+		voters[v.Choice-1]++
+		total.Add(total, power)
+	}
+	t := &Tally{
+		ProposalId: p.Id,
+		Choices:    make([]ChoiceTally, 0, len(p.Choices)),
+		TotalPower: total.String(),
+		Voters:     len(votes),
+	}
+	for i, name := range p.Choices {
+		percent := "0"
+		if total.Sign() > 0 {
+			percent = decimal.NewFromBigInt(sums[i], 2).Div(decimal.NewFromBigInt(total, 0)).StringFixed(2)
+		}
+		t.Choices = append(t.Choices, ChoiceTally{
+			Choice:  uint32(i + 1),
+			Name:    name,
+			Power:   sums[i].String(),
+			Amount:  ToDecimal(sums[i], int(decimals)).String(),
+			Voters:  voters[i],
+			Percent: percent,
+		})
+	}
+	return t
+}
+
+// skkBalancesAt reads SKK balances at block from the archive node in one
+// batch, it serves the votes cast before the proposal snapshot is done.
+func (bl *BscListener) skkBalancesAt(owners []common.Address, block uint64) ([]*big.Int, error) {
+	skk := []balanceToken{{tp: governanceToken, symbol: "SKK"}}
+	balances, err := bl.archive.balances(owners, skk, new(big.Int).SetUint64(block))
+	if err != nil {
+		log.Errorf("query skk balances at %d err : %+v", block, err)
+		return nil, errors.New("voting power snapshot is not ready, retry later")
+	}
+	result := make([]*big.Int, 0, len(owners))
+	for _, wb := range balances {
+		raw, _ := new(big.Int).SetString(wb.Balances[0].Raw, 10)
+		result = append(result, raw)
+	}
+	return result, nil
+}
+
+// skkHoldersAt replays the SKK Transfer logs from the deploy block and
+// returns the nonzero balances at block. A window the node fails to return
+// holdersReplayRetry times fails the replay.
+func (bl *BscListener) skkHoldersAt(block uint64) (map[string]*big.Int, error) {
+	from := config.Cfg.Contract.GovernanceTokenDeployBlock
+	if from == 0 {
+		return nil, errors.New("no governance token deploy block")
+	}
+	transfer := common.HexToHash(EventSignHash(TransferTopic))
+	ht := make(holderTable)
+	failures := 0
+	for from <= block {
+		end := from + snapshotStep - 1
+		if end > block {
+			end = block
+		}
+		logs, err := bl.ec.FilterLogs(context.Background(), ethereum.FilterQuery{
+			Addresses: []common.Address{common.HexToAddress(bl.tokens.configs[governanceToken])},
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Topics:    [][]common.Hash{{transfer}},
+		})
+		if err != nil {
+			log.Errorf("skk holders replay err : %+v, from : %d, to : %d", err, from, end)
+			failures++
+			if failures == holdersReplayRetry {
+				return nil, err
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		failures = 0
+		for _, l := range logs {
+			ht.apply(l)
+		}
+		from = end + 1
+	}
+	holders := make(map[string]*big.Int, len(ht))
+	for addr, balance := range ht {
+		if addr != emptyAddr && balance.Sign() > 0 {
+			holders[strings.ToLower(addr.Hex())] = balance
+		}
+	}
+	return holders, nil
+}
+
+func (bl *BscListener) CreateProposal(c *gin.Context) {
+	var service proposalService
+	if err := c.ShouldBind(&service); err == nil {
+		res := bl.createProposal(service)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) createProposal(service proposalService) serializer.Response {
+	head, err := bl.ec.BlockNumber(context.Background())
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Msg:   "chain node err ",
+			Error: err.Error(),
+		}
+	}
+	p, err := bl.gov.createProposal(service, head)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: p,
+	}
+}
+
+func (bl *BscListener) QueryProposals(c *gin.Context) {
+	var service proposalListService
+	if err := c.ShouldBind(&service); err == nil {
+		if service.Limit <= 0 {
+			service.Limit = defaultProposalsLimit
+		}
+		proposals, err := bl.gov.proposals(service.Offset, service.Limit)
+		if err != nil {
+			c.JSON(200, serializer.Response{
+				Code:  500,
+				Error: err.Error(),
+			})
+			return
+		}
+		c.JSON(200, serializer.Response{
+			Code: 200,
+			Data: proposals,
+		})
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) QueryProposalTally(c *gin.Context) {
+	var service proposalQueryService
+	if err := c.ShouldBind(&service); err == nil {
+		res := bl.queryProposalTally(service.Id)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) queryProposalTally(id string) serializer.Response {
+	p, err := bl.gov.proposal(id)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	tally, err := bl.gov.tally(p)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: tally,
+	}
+}
+
+func (bl *BscListener) QueryVotingPower(c *gin.Context) {
+	var service votingPowerService
+	if err := c.ShouldBind(&service); err == nil && common.IsHexAddress(service.Address) {
+		res := bl.queryVotingPower(service)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) queryVotingPower(service votingPowerService) serializer.Response {
+	p, err := bl.gov.proposal(service.ProposalId)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	power, err := bl.gov.votingPower(p, strings.ToLower(common.HexToAddress(service.Address).Hex()))
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	formatted, decimals := bl.tokens.formatAmount(governanceToken, power)
+	return serializer.Response{
+		Code: 200,
+		Data: balanceShow{
+			Symbol:   "SKK",
+			Balance:  formatted,
+			Raw:      power.String(),
+			Decimals: decimals,
+		},
+	}
+}
+
+func (bl *BscListener) SubmitVote(c *gin.Context) {
+	var service Vote
+	if err := c.ShouldBind(&service); err == nil {
+		if err := bl.gov.vote(service); err != nil {
+			c.JSON(200, serializer.Response{
+				Code:  500,
+				Error: err.Error(),
+			})
+			return
+		}
+		c.JSON(200, serializer.Response{
+			Code: 200,
+		})
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) SubmitDelegation(c *gin.Context) {
+	var service Delegation
+	if err := c.ShouldBind(&service); err == nil {
+		if err := bl.gov.delegate(service); err != nil {
+			c.JSON(200, serializer.Response{
+				Code:  500,
+				Error: err.Error(),
+			})
+			return
+		}
+		c.JSON(200, serializer.Response{
+			Code: 200,
+		})
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
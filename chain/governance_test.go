@@ -0,0 +1,57 @@
+package chain
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVoteSignature(t *testing.T) {
+	g := newGovernance(nil, nil, big.NewInt(97), nil, nil)
+	key, _ := crypto.GenerateKey()
+	v := Vote{
+		ProposalId: "p1",
+		Choice:     2,
+		Voter:      crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		Timestamp:  uint64(time.Now().Unix()),
+	}
+	hash, err := g.voteHash(v)
+	assert.NoError(t, err)
+	sig, err := crypto.Sign(hash, key)
+	assert.NoError(t, err)
+	sig[crypto.RecoveryIDOffset] += 27
+	assert.NoError(t, verifySigned(hash, hexutil.Encode(sig), v.Voter, v.Timestamp))
+
+	v.Choice = 1
+	other, _ := g.voteHash(v)
+	assert.Error(t, verifySigned(other, hexutil.Encode(sig), v.Voter, v.Timestamp))
+	assert.Error(t, verifySigned(hash, hexutil.Encode(sig), v.Voter, v.Timestamp-uint64(time.Hour.Seconds())))
+}
+
+func TestTallyVotes(t *testing.T) {
+	addr := func(n string) string { return "0x" + strings.Repeat("0", 40-len(n)) + n }
+	a, b, c, d := addr("a"), addr("b"), addr("c"), addr("d")
+	p := &Proposal{Id: "p1", Choices: []string{"yes", "no"}}
+	votes := map[string]Vote{
+		a: {Choice: 1},
+		b: {Choice: 2},
+		c: {Choice: 2},
+	}
+	// d delegates to a without voting, c delegated to a but voted itself
+	delegation := map[string]string{c: a, d: a}
+	assert.ElementsMatch(t, []string{a, b, c, d}, powerAddresses(votes, delegation))
+
+	powers := map[string]*big.Int{a: big.NewInt(100), b: big.NewInt(300), c: big.NewInt(50), d: big.NewInt(50)}
+	tally := tallyVotes(p, votes, delegation, powers, 0)
+	assert.Equal(t, "500", tally.TotalPower)
+	assert.Equal(t, "150", tally.Choices[0].Power)
+	assert.Equal(t, 1, tally.Choices[0].Voters)
+	assert.Equal(t, "30.00", tally.Choices[0].Percent)
+	assert.Equal(t, "350", tally.Choices[1].Power)
+	assert.Equal(t, "70.00", tally.Choices[1].Percent)
+}
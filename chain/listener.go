@@ -4,5 +4,5 @@ import "math/big"
 
 type Listener interface {
 	run()
-	handlePastBlock(fromBlock, toBlock *big.Int) error
+	handlePastBlock(fromBlock, toBlock *big.Int, stage txStage) error
 }
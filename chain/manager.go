@@ -23,14 +23,12 @@ type NftListManager struct {
 }
 
 func NewNftListManager() *NftListManager {
-	var counter Counter
-	counter.Set(12, time.Second)
 	m := &NftListManager{
-		counter: counter,
 		nlq:     &nftListQueue{},
 		callRes: map[uuid.UUID]chan result{},
 		notify:  make(chan struct{}),
 	}
+	m.counter.Set(12, time.Second)
 	go m.RunSched()
 	return m
 }
@@ -134,14 +132,12 @@ type TxRecordManager struct {
 }
 
 func NewTxRecordManager() *TxRecordManager {
-	var counter Counter
-	counter.Set(12, time.Second)
 	m := &TxRecordManager{
-		counter: counter,
 		trq:     &txRecordQueue{},
 		callRes: map[uuid.UUID]chan result{},
 		notify:  make(chan struct{}),
 	}
+	m.counter.Set(12, time.Second)
 	go m.RunSched()
 	return m
 }
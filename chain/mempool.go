@@ -0,0 +1,271 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"math/big"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+	"strings"
+	"time"
+)
+
+const (
+	pendingTxSuffix   = "_pendingTx"
+	pendingTxDuration = 10 * time.Minute
+)
+
+var rechargeTypes = map[TokenType]uint64{
+	governanceToken: SKK_RECHARGE,
+	gameToken:       SKS_RECHARGE,
+	usdc:            USDC_RECHARGE,
+	bnb:             BNB_RECHARGE,
+}
+
+type PendingTx struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Token  string `json:"token"`
+	TxType uint64 `json:"txType"`
+	TxHash string `json:"txHash"`
+	Amount string `json:"amount"`
+	// FormattedAmount is Amount in whole token units.
+	FormattedAmount string `json:"formattedAmount"`
+	Decimals        uint8  `json:"decimals"`
+	SeenTime        int64  `json:"seenTime"`
+}
+
+type pendingTxService struct {
+	Address string `form:"address" json:"address" binding:"required"`
+}
+
+// MempoolWatcher follows newPendingTransactions and reports native and ERC20
+// transfers whose recipient is one of the watched addresses.
+type MempoolWatcher struct {
+	ec            *ethclient.Client
+	rpc           *rpc.Client
+	rc            *redis.Client
+	signer        types.Signer
+	erc20         abi.ABI
+	watched       map[string]struct{}
+	tokens        map[string]TokenType
+	registry      *TokenRegistry
+	pendingNotify chan PendingTx
+}
+
+func newMempoolWatcher(ec *ethclient.Client, rpcClient *rpc.Client, rc *redis.Client, registry *TokenRegistry, chainId *big.Int, targetWalletAddr string, pendingNotify chan PendingTx) *MempoolWatcher {
+	watched := map[string]struct{}{
+		strings.ToLower(targetWalletAddr): {},
+	}
+	for _, addr := range config.Cfg.Chain.WatchAddresses {
+		watched[strings.ToLower(addr)] = struct{}{}
+	}
+	return &MempoolWatcher{
+		ec:      ec,
+		rpc:     rpcClient,
+		rc:      rc,
+		signer:  types.LatestSignerForChainID(chainId),
+		erc20:   getABI(GameTokenABI),
+		watched: watched,
+		tokens: map[string]TokenType{
+			strings.ToLower(config.Cfg.Contract.GovernanceTokenAddress): governanceToken,
+			strings.ToLower(config.Cfg.Contract.GameTokenAddress):       gameToken,
+			strings.ToLower(config.Cfg.Contract.UsdcAddress):            usdc,
+		},
+		registry:      registry,
+		pendingNotify: pendingNotify,
+	}
+}
+
+func (mw *MempoolWatcher) run() {
+	for {
+		err := mw.watchFullTx()
+		log.Warnf("pending tx subscription with full body err : %+v, fallback to hash subscription", err)
+		err = mw.watchTxHash()
+		log.Error("pending tx subscribe err : ", err)
+		time.Sleep(time.Second)
+	}
+}
+
+// watchFullTx asks the node for full transaction bodies, nodes that only
+// support hashes fail the first notification and we fall back.
+func (mw *MempoolWatcher) watchFullTx() error {
+	txChan := make(chan *types.Transaction, 100)
+	sub, err := mw.rpc.EthSubscribe(context.Background(), txChan, "newPendingTransactions", true)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case err := <-sub.Err():
+			return err
+		case tx := <-txChan:
+			mw.handleTx(tx)
+		}
+	}
+}
+
+func (mw *MempoolWatcher) watchTxHash() error {
+	hashChan := make(chan common.Hash, 100)
+	sub, err := mw.rpc.EthSubscribe(context.Background(), hashChan, "newPendingTransactions")
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case err := <-sub.Err():
+			return err
+		case hash := <-hashChan:
+			tx, isPending, err := mw.ec.TransactionByHash(context.Background(), hash)
+			if err != nil || !isPending {
+				continue
+			}
+			mw.handleTx(tx)
+		}
+	}
+}
+
+func (mw *MempoolWatcher) handleTx(tx *types.Transaction) {
+	if tx.To() == nil {
+		return
+	}
+	from, err := types.Sender(mw.signer, tx)
+	if err != nil {
+		return
+	}
+	ptx, ok := mw.decode(from, tx)
+	if !ok {
+		return
+	}
+	ptx.TxHash = tx.Hash().Hex()
+	ptx.SeenTime = time.Now().UnixMilli()
+	mw.save(ptx)
+	mw.pendingNotify <- ptx
+}
+
+func (mw *MempoolWatcher) decode(from common.Address, tx *types.Transaction) (PendingTx, bool) {
+	if tp, ok := mw.tokens[strings.ToLower(tx.To().Hex())]; ok {
+		return mw.decodeERC20(tp, from, tx.Data())
+	}
+	if tx.Value().Sign() == 0 || !mw.isWatched(tx.To().Hex()) {
+		return PendingTx{}, false
+	}
+	return PendingTx{
+		From:            from.Hex(),
+		To:              tx.To().Hex(),
+		Token:           bnb.String(),
+		TxType:          rechargeTypes[bnb],
+		Amount:          tx.Value().String(),
+		FormattedAmount: ToDecimal(tx.Value(), nativeDecimals).String(),
+		Decimals:        nativeDecimals,
+	}, true
+}
+
+func (mw *MempoolWatcher) decodeERC20(tp TokenType, from common.Address, data []byte) (PendingTx, bool) {
+	if len(data) < 4 {
+		return PendingTx{}, false
+	}
+	method, err := mw.erc20.MethodById(data[:4])
+	if err != nil {
+		return PendingTx{}, false
+	}
+	input, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return PendingTx{}, false
+	}
+	var to common.Address
+	var amount *big.Int
+	switch method.Name {
+	case "transfer":
+		to, amount = input[0].(common.Address), input[1].(*big.Int)
+	case "transferFrom":
+		from, to, amount = input[0].(common.Address), input[1].(common.Address), input[2].(*big.Int)
+	default:
+		return PendingTx{}, false
+	}
+	if !mw.isWatched(to.Hex()) {
+		return PendingTx{}, false
+	}
+	formatted, decimals := mw.registry.formatAmount(tp, amount)
+	return PendingTx{
+		From:            from.Hex(),
+		To:              to.Hex(),
+		Token:           tp.String(),
+		TxType:          rechargeTypes[tp],
+		Amount:          amount.String(),
+		FormattedAmount: formatted,
+		Decimals:        decimals,
+	}, true
+}
+
+func (mw *MempoolWatcher) isWatched(addr string) bool {
+	_, ok := mw.watched[strings.ToLower(addr)]
+	return ok
+}
+
+func (mw *MempoolWatcher) save(ptx PendingTx) {
+	txByte, err := json.Marshal(ptx)
+	if err != nil {
+		log.Errorf("json marshal err : %+v, tx : %+v", err, ptx)
+		return
+	}
+	key := strings.ToLower(ptx.To) + pendingTxSuffix
+	mw.rc.HSet(key, ptx.TxHash, string(txByte))
+	mw.rc.Expire(key, pendingTxDuration)
+}
+
+func (bl *BscListener) QueryPendingTx(c *gin.Context) {
+	var service pendingTxService
+	if err := c.ShouldBind(&service); err == nil {
+		res := bl.queryPendingTx(service.Address)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+// queryPendingTx returns the pending deposits seen for an address, dropping
+// the ones that have been mined or evicted from the mempool in the meantime.
+func (bl *BscListener) queryPendingTx(address string) serializer.Response {
+	key := strings.ToLower(address) + pendingTxSuffix
+	entries, err := bl.rc.HGetAll(key).Result()
+	if err != nil {
+		return serializer.Response{
+			Code: 500,
+			Msg:  err.Error(),
+		}
+	}
+	pending := make([]PendingTx, 0)
+	for hash, entry := range entries {
+		var ptx PendingTx
+		if err := json.Unmarshal([]byte(entry), &ptx); err != nil {
+			bl.rc.HDel(key, hash)
+			continue
+		}
+		_, isPending, err := bl.ec.TransactionByHash(context.Background(), common.HexToHash(hash))
+		if err != nil && err != ethereum.NotFound {
+			log.Errorf("query pending tx txHash : %s, err : %+v", hash, err)
+		} else if err == ethereum.NotFound || !isPending || time.Since(time.UnixMilli(ptx.SeenTime)) > pendingTxDuration {
+			bl.rc.HDel(key, hash)
+			continue
+		}
+		pending = append(pending, ptx)
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: pending,
+	}
+}
@@ -0,0 +1,63 @@
+package chain
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMempoolDecodeERC20(t *testing.T) {
+	watched := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	other := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	sender := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	owner := common.HexToAddress("0x4444444444444444444444444444444444444444")
+	mw := &MempoolWatcher{
+		erc20:   getABI(GameTokenABI),
+		watched: map[string]struct{}{strings.ToLower(watched.Hex()): {}},
+		registry: &TokenRegistry{
+			tokens: map[TokenType]TokenInfo{
+				usdc: {Type: usdc.String(), Symbol: "USDC", Decimals: 6},
+			},
+		},
+	}
+	pack := func(method string, args ...interface{}) []byte {
+		data, err := mw.erc20.Pack(method, args...)
+		assert.NoError(t, err)
+		return data
+	}
+	transfer := pack("transfer", watched, big.NewInt(1500000))
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		ok   bool
+		from common.Address
+	}{
+		{"transfer to watched", transfer, true, sender},
+		{"transferFrom to watched", pack("transferFrom", owner, watched, big.NewInt(1500000)), true, owner},
+		{"transfer to unwatched", pack("transfer", other, big.NewInt(1500000)), false, sender},
+		{"transferFrom to unwatched", pack("transferFrom", owner, other, big.NewInt(1500000)), false, owner},
+		{"approve of watched", pack("approve", watched, big.NewInt(1500000)), false, sender},
+		{"empty", nil, false, sender},
+		{"short selector", transfer[:3], false, sender},
+		{"selector only", transfer[:4], false, sender},
+		{"truncated args", transfer[:40], false, sender},
+		{"unknown selector", append([]byte{0xde, 0xad, 0xbe, 0xef}, transfer[4:]...), false, sender},
+	} {
+		ptx, ok := mw.decodeERC20(usdc, sender, tc.data)
+		assert.Equal(t, tc.ok, ok, tc.name)
+		if !tc.ok {
+			continue
+		}
+		assert.Equal(t, tc.from.Hex(), ptx.From, tc.name)
+		assert.Equal(t, watched.Hex(), ptx.To, tc.name)
+		assert.Equal(t, usdc.String(), ptx.Token, tc.name)
+		assert.Equal(t, uint64(USDC_RECHARGE), ptx.TxType, tc.name)
+		assert.Equal(t, "1500000", ptx.Amount, tc.name)
+		assert.Equal(t, "1.5", ptx.FormattedAmount, tc.name)
+		assert.Equal(t, uint8(6), ptx.Decimals, tc.name)
+	}
+}
@@ -0,0 +1,75 @@
+package chain
+
+import (
+	"bytes"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+)
+
+// MerkleTree hashes each pair of nodes in sorted order, as OpenZeppelin
+// MerkleProof.verify expects, and carries an odd node up unchanged.
+type MerkleTree struct {
+	layers [][]common.Hash
+}
+
+func newMerkleTree(leaves []common.Hash) *MerkleTree {
+	t := &MerkleTree{layers: [][]common.Hash{leaves}}
+	for layer := leaves; len(layer) > 1; {
+		next := make([]common.Hash, 0, (len(layer)+1)/2)
+		for i := 0; i < len(layer); i += 2 {
+			if i+1 == len(layer) {
+				next = append(next, layer[i])
+				continue
+			}
+			next = append(next, hashPair(layer[i], layer[i+1]))
+		}
+		t.layers = append(t.layers, next)
+		layer = next
+	}
+	return t
+}
+
+func (t *MerkleTree) Root() common.Hash {
+	top := t.layers[len(t.layers)-1]
+	if len(top) == 0 {
+		return common.Hash{}
+	}
+	return top[0]
+}
+
+func (t *MerkleTree) Proof(index int) []common.Hash {
+	proof := make([]common.Hash, 0, len(t.layers))
+	for _, layer := range t.layers[:len(t.layers)-1] {
+		sibling := index ^ 1
+		if sibling < len(layer) {
+			proof = append(proof, layer[sibling])
+		}
+		index /= 2
+	}
+	return proof
+}
+
+func hashPair(a, b common.Hash) common.Hash {
+	if bytes.Compare(a.Bytes(), b.Bytes()) > 0 {
+		a, b = b, a
+	}
+	return crypto.Keccak256Hash(a.Bytes(), b.Bytes())
+}
+
+func verifyMerkleProof(root, leaf common.Hash, proof []common.Hash) bool {
+	for _, p := range proof {
+		leaf = hashPair(leaf, p)
+	}
+	return leaf == root
+}
+
+// airdropLeaf is keccak256(abi.encodePacked(index, account, amount)), the
+// leaf of the Uniswap MerkleDistributor claim contract.
+func airdropLeaf(index uint64, account common.Address, amount *big.Int) common.Hash {
+	return crypto.Keccak256Hash(
+		common.LeftPadBytes(new(big.Int).SetUint64(index).Bytes(), 32),
+		account.Bytes(),
+		common.LeftPadBytes(amount.Bytes(), 32),
+	)
+}
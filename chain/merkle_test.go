@@ -0,0 +1,66 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerkleTreeProof(t *testing.T) {
+	for n := 1; n <= 7; n++ {
+		leaves := make([]common.Hash, 0, n)
+		for i := 0; i < n; i++ {
+			leaves = append(leaves, airdropLeaf(uint64(i), common.BigToAddress(big.NewInt(int64(i+1))), big.NewInt(int64(100*i))))
+		}
+		tree := newMerkleTree(leaves)
+		for i, leaf := range leaves {
+			assert.True(t, verifyMerkleProof(tree.Root(), leaf, tree.Proof(i)), "n %d leaf %d", n, i)
+		}
+		if n > 1 {
+			assert.False(t, verifyMerkleProof(tree.Root(), leaves[0], tree.Proof(1)))
+		}
+	}
+}
+
+func transferLog(from, to common.Address, value int64) types.Log {
+	transfer := common.HexToHash(EventSignHash(TransferTopic))
+	return types.Log{
+		Topics: []common.Hash{transfer, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())},
+		Data:   common.LeftPadBytes(big.NewInt(value).Bytes(), 32),
+	}
+}
+
+func TestHolderTableEntries(t *testing.T) {
+	zero := common.HexToAddress(emptyAddress)
+	alice := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	bob := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+	pool := common.HexToAddress("0x00000000000000000000000000000000000000c3")
+
+	ht := make(holderTable)
+	ht.apply(transferLog(zero, alice, 1000))
+	ht.apply(transferLog(alice, bob, 300))
+	ht.apply(transferLog(alice, pool, 100))
+	ht.apply(transferLog(bob, alice, 300))
+	nft := transferLog(zero, bob, 0)
+	nft.Topics = append(nft.Topics, common.BigToHash(big.NewInt(7)))
+	nft.Data = nil
+	ht.apply(nft)
+
+	entries, balances, root := ht.entries(map[common.Address]struct{}{zero: {}, pool: {}})
+	assert.Len(t, entries, 2)
+	assert.Equal(t, alice.Hex(), entries[0].Address)
+	assert.Equal(t, "900", entries[0].Balance)
+	assert.Equal(t, bob.Hex(), entries[1].Address)
+	assert.Equal(t, "1", entries[1].Balance)
+	for i, entry := range entries {
+		proof := make([]common.Hash, 0, len(entry.Proof))
+		for _, p := range entry.Proof {
+			proof = append(proof, common.HexToHash(p))
+		}
+		leaf := airdropLeaf(entry.Index, common.HexToAddress(entry.Address), balances[i])
+		assert.True(t, verifyMerkleProof(root, leaf, proof))
+	}
+}
@@ -0,0 +1,221 @@
+package chain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/go-redis/redis"
+	"math/big"
+	"spike-blockchain-server/chain/contract"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/resolver"
+	"sync"
+	"time"
+)
+
+const (
+	nftMetadataKey = "nft_metadata"
+	// nftMetadataStaleKey is the time of the last setBaseTokenURI, every copy
+	// fetched before it is stale.
+	nftMetadataStaleKey = "nft_metadata_stale_before"
+	metadataMaxAge      = time.Hour
+	metadataFetchLimit  = 30 * time.Second
+	metadataMaxSize     = 1 << 20
+	metadataWorkers     = 4
+)
+
+type StoredMetadata struct {
+	TokenId   string `json:"tokenId"`
+	Uri       string `json:"uri"`
+	Metadata  string `json:"metadata"`
+	Hash      string `json:"hash"`
+	FetchTime int64  `json:"fetchTime"`
+}
+
+func (sm StoredMetadata) stale(staleBefore int64) bool {
+	return sm.FetchTime < staleBefore || time.Since(time.UnixMilli(sm.FetchTime)) > metadataMaxAge
+}
+
+// MetadataStore caches the metadata of the game nft by tokenId. Reads return
+// the stored copy, even a stale one, and leave refreshing to the workers.
+type MetadataStore struct {
+	ec       *ethclient.Client
+	rc       *redis.Client
+	refresh  chan string
+	lk       sync.Mutex
+	inflight map[string]struct{}
+	// onFetched is called with every metadata fetched from the token uri.
+	onFetched func(sm StoredMetadata)
+}
+
+func newMetadataStore(ec *ethclient.Client, rc *redis.Client, calls *CallWatcher) *MetadataStore {
+	ms := &MetadataStore{
+		ec:       ec,
+		rc:       rc,
+		refresh:  make(chan string, 1000),
+		inflight: make(map[string]struct{}),
+	}
+	nftAbi, err := contract.GameNftMetaData.GetAbi()
+	if err != nil {
+		log.Error("parse gameNft abi err : ", err)
+		return ms
+	}
+	calls.watch(config.Cfg.Contract.GameNftAddress, *nftAbi, "setTokenURI", func(call *DecodedCall) {
+		tokenId := call.BigInt("tokenId").String()
+		if !ms.enqueue(tokenId) {
+			ms.markStale(tokenId)
+		}
+	})
+	// a new base uri may change every token, the copies are revalidated as
+	// they are read instead of being queued all at once
+	calls.watch(config.Cfg.Contract.GameNftAddress, *nftAbi, "setBaseTokenURI", func(call *DecodedCall) {
+		if err := ms.rc.Set(nftMetadataStaleKey, time.Now().UnixMilli(), 0).Err(); err != nil {
+			log.Error("mark metadata stale err : ", err)
+		}
+	})
+	return ms
+}
+
+func (ms *MetadataStore) run() {
+	for i := 0; i < metadataWorkers; i++ {
+		go func() {
+			for tokenId := range ms.refresh {
+				if _, err := ms.fetch(tokenId); err != nil {
+					log.Errorf("refresh metadata tokenId : %s, err : %+v", tokenId, err)
+				}
+				ms.lk.Lock()
+				delete(ms.inflight, tokenId)
+				ms.lk.Unlock()
+			}
+		}()
+	}
+}
+
+// onTransfer fetches the metadata of newly minted tokens and of transferred
+// tokens the store does not know yet.
+func (ms *MetadataStore) onTransfer(ev *DecodedEvent) {
+	if ev.Stage != stageFinalized.String() {
+		return
+	}
+	tokenId := ev.BigInt("tokenId").String()
+	if ev.Address("from").String() != emptyAddress {
+		if _, ok := ms.load(tokenId); ok {
+			return
+		}
+	}
+	ms.enqueue(tokenId)
+}
+
+// enqueue reports whether tokenId is queued for a refresh, false when the
+// queue is full.
+func (ms *MetadataStore) enqueue(tokenId string) bool {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+	if _, ok := ms.inflight[tokenId]; ok {
+		return true
+	}
+	select {
+	case ms.refresh <- tokenId:
+		ms.inflight[tokenId] = struct{}{}
+		return true
+	default:
+		log.Warnf("metadata refresh queue is full, tokenId : %s", tokenId)
+		return false
+	}
+}
+
+// markStale makes the next read of tokenId refresh its stored copy.
+func (ms *MetadataStore) markStale(tokenId string) {
+	sm, ok := ms.load(tokenId)
+	if !ok {
+		return
+	}
+	sm.FetchTime = 0
+	if val, err := json.Marshal(sm); err == nil {
+		ms.rc.HSet(nftMetadataKey, tokenId, string(val))
+	}
+}
+
+// get returns the metadata of tokenId, fetching it only when it was never
+// stored. A stale copy is returned as is and refreshed in the background.
+func (ms *MetadataStore) get(tokenId string) (StoredMetadata, error) {
+	if sm, ok := ms.load(tokenId); ok {
+		staleBefore, _ := ms.rc.Get(nftMetadataStaleKey).Int64()
+		return ms.serve(tokenId, sm, staleBefore), nil
+	}
+	return ms.fetch(tokenId)
+}
+
+// serve returns the stored copy of tokenId and queues a refresh when it was
+// fetched before staleBefore or is too old.
+func (ms *MetadataStore) serve(tokenId string, sm StoredMetadata, staleBefore int64) StoredMetadata {
+	if sm.stale(staleBefore) {
+		ms.enqueue(tokenId)
+	}
+	return sm
+}
+
+func (ms *MetadataStore) load(tokenId string) (StoredMetadata, bool) {
+	var sm StoredMetadata
+	val, err := ms.rc.HGet(nftMetadataKey, tokenId).Result()
+	if err != nil {
+		return sm, false
+	}
+	if err := json.Unmarshal([]byte(val), &sm); err != nil {
+		return sm, false
+	}
+	return sm, true
+}
+
+func (ms *MetadataStore) fetch(tokenId string) (StoredMetadata, error) {
+	var sm StoredMetadata
+	id, ok := new(big.Int).SetString(tokenId, 10)
+	if !ok {
+		return sm, ErrorParam
+	}
+	aunft, err := contract.NewGameNft(common.HexToAddress(config.Cfg.Contract.GameNftAddress), ms.ec)
+	if err != nil {
+		return sm, err
+	}
+	uri, err := aunft.TokenURI(nil, id)
+	if err != nil {
+		return sm, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), metadataFetchLimit)
+	defer cancel()
+	res, err := resolver.Default().Resolve(ctx, uri, resolver.Limits{
+		MaxSize:      metadataMaxSize,
+		ContentTypes: resolver.JSONTypes,
+	})
+	if err != nil {
+		return sm, err
+	}
+	var m Metadata
+	if err := json.Unmarshal(res.Body, &m); err != nil {
+		return sm, err
+	}
+	metadata, err := json.Marshal(m)
+	if err != nil {
+		return sm, err
+	}
+	hash := sha256.Sum256(res.Body)
+	sm = StoredMetadata{
+		TokenId:   tokenId,
+		Uri:       uri,
+		Metadata:  string(metadata),
+		Hash:      hex.EncodeToString(hash[:]),
+		FetchTime: time.Now().UnixMilli(),
+	}
+	val, err := json.Marshal(sm)
+	if err != nil {
+		return sm, err
+	}
+	ms.rc.HSet(nftMetadataKey, tokenId, string(val))
+	if ms.onFetched != nil {
+		ms.onFetched(sm)
+	}
+	return sm, nil
+}
@@ -0,0 +1,77 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMetadataStore(queue int) *MetadataStore {
+	return &MetadataStore{
+		refresh:  make(chan string, queue),
+		inflight: make(map[string]struct{}),
+	}
+}
+
+func TestMetadataServeStale(t *testing.T) {
+	now := time.Now()
+	cutoff := now.Add(-time.Minute).UnixMilli()
+	for _, tc := range []struct {
+		name      string
+		fetchTime int64
+		queued    bool
+	}{
+		{"fetched before the base uri changed", now.Add(-2 * time.Minute).UnixMilli(), true},
+		{"fetched after the base uri changed", now.UnixMilli(), false},
+		{"marked stale by setTokenURI", 0, true},
+		{"older than the max age", now.Add(-metadataMaxAge - time.Minute).UnixMilli(), true},
+	} {
+		ms := newTestMetadataStore(1)
+		sm := StoredMetadata{TokenId: "7", Metadata: `{"name":"Soul"}`, FetchTime: tc.fetchTime}
+		assert.Equal(t, sm, ms.serve("7", sm, cutoff), tc.name)
+		if tc.queued {
+			assert.Equal(t, "7", <-ms.refresh, tc.name)
+		} else {
+			assert.Empty(t, ms.refresh, tc.name)
+		}
+	}
+
+	// a stale copy is still served while the queue is full
+	ms := newTestMetadataStore(1)
+	assert.True(t, ms.enqueue("1"))
+	sm := StoredMetadata{TokenId: "7", Metadata: `{"name":"Soul"}`}
+	assert.Equal(t, sm, ms.serve("7", sm, cutoff))
+	assert.Len(t, ms.refresh, 1)
+}
+
+func TestMetadataFullQueue(t *testing.T) {
+	ms := newTestMetadataStore(2)
+	assert.True(t, ms.enqueue("1"))
+	assert.True(t, ms.enqueue("2"))
+	// a token already queued does not take another slot
+	assert.True(t, ms.enqueue("1"))
+	assert.False(t, ms.enqueue("3"))
+
+	done := make(chan struct{})
+	go func() {
+		ms.onTransfer(&DecodedEvent{
+			Stage: stageFinalized.String(),
+			decodedArgs: decodedArgs{
+				"from":    common.Address{},
+				"to":      common.HexToAddress("0x1111111111111111111111111111111111111111"),
+				"tokenId": big.NewInt(4),
+			},
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("onTransfer blocked on a full refresh queue")
+	}
+	assert.Len(t, ms.refresh, 2)
+	assert.NotContains(t, ms.inflight, "4")
+}
@@ -0,0 +1,445 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"math/big"
+	"net/http"
+	"os"
+	"spike-blockchain-server/chain/contract"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/model"
+	"spike-blockchain-server/serializer"
+	"spike-blockchain-server/service/ipfs"
+	"sync"
+	"time"
+)
+
+const (
+	mintJobPrefix    = "mint_job_"
+	mintTokenPrefix  = "mint_token_"
+	mintActiveKey    = "mint_job_active"
+	mintJobDuration  = 7 * 24 * time.Hour
+	mintMinedTimeout = 5 * time.Minute
+	mintPollInterval = 3 * time.Second
+	maxMintBatch     = 100
+)
+
+var ErrorMintBusy = errors.New("mint queue is full, retry later")
+
+const (
+	mintPending   = "pending"
+	mintRunning   = "running"
+	mintSent      = "sent"
+	mintMinted    = "minted"
+	mintCompleted = "completed"
+	mintFailed    = "failed"
+)
+
+type MintItem struct {
+	TokenId  string              `json:"tokenId"`
+	To       string              `json:"to"`
+	Metadata model.SpikeMetadata `json:"metadata"`
+	TokenUri string              `json:"tokenUri"`
+	TxHash   string              `json:"txHash"`
+	Status   string              `json:"status"`
+	Error    string              `json:"error,omitempty"`
+}
+
+type MintJob struct {
+	Id         string     `json:"id"`
+	Status     string     `json:"status"`
+	Items      []MintItem `json:"items"`
+	CreateTime int64      `json:"createTime"`
+	UpdateTime int64      `json:"updateTime"`
+}
+
+func (job *MintJob) done() bool {
+	for _, item := range job.Items {
+		if item.Status != mintMinted && item.Status != mintFailed {
+			return false
+		}
+	}
+	return true
+}
+
+type mintService struct {
+	Items []MintItem `json:"items" binding:"required"`
+}
+
+type mintJobService struct {
+	JobId string `form:"jobId" json:"jobId" binding:"required"`
+}
+
+// MintManager runs mint jobs one item at a time: pin the metadata to ipfs,
+// send mint with the signer, then wait for the Transfer from the zero address.
+type MintManager struct {
+	ec         *ethclient.Client
+	rc         *redis.Client
+	signer     *Signer
+	jobs       chan string
+	mintNotify chan MintJob
+	lk         sync.Mutex
+}
+
+func newMintManager(ec *ethclient.Client, rc *redis.Client, signer *Signer, mintNotify chan MintJob) *MintManager {
+	return &MintManager{
+		ec:         ec,
+		rc:         rc,
+		signer:     signer,
+		jobs:       make(chan string, maxMintBatch),
+		mintNotify: mintNotify,
+	}
+}
+
+// run resumes the jobs left unfinished by a restart and then serves new ones.
+// The sent items of a resumed job are followed again from their tx hash.
+func (mm *MintManager) run() {
+	ids, err := mm.rc.SMembers(mintActiveKey).Result()
+	if err != nil {
+		log.Error("query active mint jobs err : ", err)
+	}
+	for _, id := range ids {
+		job, err := mm.load(id)
+		if err != nil {
+			continue
+		}
+		for i, item := range job.Items {
+			if item.Status == mintSent {
+				go mm.waitMined(id, i, common.HexToHash(item.TxHash))
+			}
+		}
+	}
+	go func() {
+		for _, id := range ids {
+			mm.jobs <- id
+		}
+	}()
+	for id := range mm.jobs {
+		mm.process(id)
+	}
+}
+
+func (mm *MintManager) submit(items []MintItem) (*MintJob, error) {
+	now := time.Now().UnixMilli()
+	job := &MintJob{
+		Id:         uuid.New().String(),
+		Status:     mintPending,
+		Items:      items,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	for i := range job.Items {
+		tokenId, _ := new(big.Int).SetString(job.Items[i].TokenId, 10)
+		job.Items[i].TokenId = tokenId.String()
+		job.Items[i].Status = mintPending
+		job.Items[i].TxHash, job.Items[i].Error = "", ""
+	}
+	if err := mm.save(job); err != nil {
+		return nil, err
+	}
+	select {
+	case mm.jobs <- job.Id:
+	default:
+		mm.rc.Del(mintJobPrefix + job.Id)
+		return nil, ErrorMintBusy
+	}
+	mm.rc.SAdd(mintActiveKey, job.Id)
+	return job, nil
+}
+
+func (mm *MintManager) process(id string) {
+	job, err := mm.load(id)
+	if err != nil {
+		log.Errorf("load mint job %s err : %+v", id, err)
+		mm.rc.SRem(mintActiveKey, id)
+		return
+	}
+	mm.update(id, func(job *MintJob) {
+		job.Status = mintRunning
+	})
+	for i, item := range job.Items {
+		if item.Status != mintPending {
+			continue
+		}
+		tx, tokenUri, err := mm.mint(item)
+		mm.update(id, func(job *MintJob) {
+			if tokenUri != "" {
+				job.Items[i].TokenUri = tokenUri
+			}
+			if err != nil {
+				job.Items[i].Status = mintFailed
+				job.Items[i].Error = err.Error()
+				return
+			}
+			job.Items[i].Status = mintSent
+			job.Items[i].TxHash = tx.Hash().Hex()
+		})
+		if err != nil {
+			log.Errorf("mint job %s tokenId : %s, err : %+v", id, item.TokenId, err)
+			continue
+		}
+		mm.rc.Set(mintTokenPrefix+item.TokenId, id, mintJobDuration)
+		go mm.waitMined(id, i, tx.Hash())
+	}
+}
+
+func (mm *MintManager) mint(item MintItem) (*types.Transaction, string, error) {
+	tokenId, _ := new(big.Int).SetString(item.TokenId, 10)
+	aunft, err := contract.NewGameNft(common.HexToAddress(config.Cfg.Contract.GameNftAddress), mm.ec)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := aunft.OwnerOf(nil, tokenId); err == nil {
+		return nil, "", fmt.Errorf("tokenId %s already minted", item.TokenId)
+	}
+	tokenUri := item.TokenUri
+	if tokenUri == "" {
+		if tokenUri, err = pinMetadata(item.Metadata); err != nil {
+			return nil, "", err
+		}
+	}
+	tx, err := mm.signer.Transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return aunft.Mint0(opts, tokenId, common.HexToAddress(item.To), tokenUri)
+	})
+	return tx, tokenUri, err
+}
+
+func pinMetadata(metadata model.SpikeMetadata) (string, error) {
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	service := ipfs.PinJsonService{
+		Json: string(content),
+		Name: metadata.Name,
+	}
+	res := service.PinJson()
+	if res.Code != 200 {
+		return "", fmt.Errorf("pin metadata err : %s", res.Error)
+	}
+	return ipfs.PROTOCOL + "://" + os.Getenv("PINATA_GATEWAY") + "/ipfs/" + res.Data.(serializer.Pin).IpfsHash, nil
+}
+
+// waitMined fails the item when its transaction reverts, a successful mint is
+// completed by the Transfer event once its block is finalized. A tx the node
+// no longer knows after mintMinedTimeout was dropped and the item is sent
+// again, minting an existing tokenId reverts so it is never minted twice.
+func (mm *MintManager) waitMined(id string, i int, hash common.Hash) {
+	deadline := time.Now().Add(mintMinedTimeout)
+	for {
+		recp, err := mm.ec.TransactionReceipt(context.Background(), hash)
+		if err == nil {
+			if recp.Status != types.ReceiptStatusSuccessful {
+				mm.update(id, func(job *MintJob) {
+					job.Items[i].Status = mintFailed
+					job.Items[i].Error = "mint tx reverted"
+				})
+			}
+			return
+		}
+		if time.Now().Before(deadline) {
+			time.Sleep(mintPollInterval)
+			continue
+		}
+		_, _, err = mm.ec.TransactionByHash(context.Background(), hash)
+		if err == ethereum.NotFound {
+			log.Errorf("mint tx %s dropped, job : %s", hash, id)
+			mm.update(id, func(job *MintJob) {
+				if job.Items[i].Status == mintSent {
+					job.Items[i].Status = mintPending
+					job.Items[i].TxHash = ""
+				}
+			})
+			go func() {
+				mm.jobs <- id
+			}()
+			return
+		}
+		if err != nil {
+			log.Errorf("query mint tx %s err : %+v", hash, err)
+		}
+		deadline = time.Now().Add(mintMinedTimeout)
+	}
+}
+
+// onTransfer marks the item of a mint job minted, it is called with the game
+// nft Transfer events from the zero address.
+func (mm *MintManager) onTransfer(ev *DecodedEvent) {
+	if ev.Stage != stageFinalized.String() || ev.Address("from").String() != emptyAddress {
+		return
+	}
+	tokenId := ev.BigInt("tokenId").String()
+	id, err := mm.rc.Get(mintTokenPrefix + tokenId).Result()
+	if err != nil {
+		return
+	}
+	mm.update(id, func(job *MintJob) {
+		for i, item := range job.Items {
+			if item.TokenId == tokenId && item.Status != mintMinted {
+				job.Items[i].Status = mintMinted
+				job.Items[i].TxHash = ev.TxHash
+				job.Items[i].Error = ""
+			}
+		}
+	})
+	mm.rc.Del(mintTokenPrefix + tokenId)
+}
+
+// update applies fn to the stored job and publishes it once every item is
+// either minted or failed.
+func (mm *MintManager) update(id string, fn func(job *MintJob)) {
+	mm.lk.Lock()
+	defer mm.lk.Unlock()
+	job, err := mm.load(id)
+	if err != nil {
+		log.Errorf("load mint job %s err : %+v", id, err)
+		return
+	}
+	if job.Status == mintCompleted || job.Status == mintFailed {
+		return
+	}
+	fn(job)
+	job.UpdateTime = time.Now().UnixMilli()
+	if job.done() {
+		job.Status = mintCompleted
+		for _, item := range job.Items {
+			if item.Status == mintFailed {
+				job.Status = mintFailed
+			}
+		}
+	}
+	if err := mm.save(job); err != nil {
+		log.Errorf("save mint job %s err : %+v", id, err)
+		return
+	}
+	if job.Status == mintCompleted || job.Status == mintFailed {
+		mm.rc.SRem(mintActiveKey, id)
+		mm.mintNotify <- *job
+	}
+}
+
+func (mm *MintManager) load(id string) (*MintJob, error) {
+	val, err := mm.rc.Get(mintJobPrefix + id).Result()
+	if err != nil {
+		return nil, err
+	}
+	var job MintJob
+	if err := json.Unmarshal([]byte(val), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (mm *MintManager) save(job *MintJob) error {
+	val, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return mm.rc.Set(mintJobPrefix+job.Id, string(val), mintJobDuration).Err()
+}
+
+func validMintItems(items []MintItem) error {
+	if len(items) == 0 || len(items) > maxMintBatch {
+		return ErrorParam
+	}
+	seen := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		tokenId, ok := new(big.Int).SetString(item.TokenId, 10)
+		if !ok || tokenId.Sign() < 0 || !common.IsHexAddress(item.To) || item.To == emptyAddress {
+			return ErrorParam
+		}
+		if _, ok := seen[tokenId.String()]; ok {
+			return fmt.Errorf("duplicate tokenId %s", item.TokenId)
+		}
+		seen[tokenId.String()] = struct{}{}
+		if item.TokenUri == "" {
+			if err := item.Metadata.ValidateMetaData(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (bl *BscListener) MintNft(c *gin.Context) {
+	var service mintService
+	if err := c.ShouldBind(&service); err == nil {
+		res := bl.mintNft(service.Items)
+		if res.Code == http.StatusServiceUnavailable {
+			c.JSON(http.StatusServiceUnavailable, res)
+			return
+		}
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) mintNft(items []MintItem) serializer.Response {
+	if bl.signer == nil {
+		return serializer.Response{
+			Code:  500,
+			Error: ErrorNoSigner.Error(),
+		}
+	}
+	if err := validMintItems(items); err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	job, err := bl.minter.submit(items)
+	if err == ErrorMintBusy {
+		return serializer.Response{
+			Code:  http.StatusServiceUnavailable,
+			Error: err.Error(),
+		}
+	}
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: job,
+	}
+}
+
+func (bl *BscListener) QueryMintJob(c *gin.Context) {
+	var service mintJobService
+	if err := c.ShouldBind(&service); err == nil {
+		job, err := bl.minter.load(service.JobId)
+		if err != nil {
+			c.JSON(200, serializer.Response{
+				Code:  500,
+				Error: err.Error(),
+			})
+			return
+		}
+		c.JSON(200, serializer.Response{
+			Code: 200,
+			Data: job,
+		})
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
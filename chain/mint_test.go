@@ -0,0 +1,40 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"spike-blockchain-server/model"
+)
+
+func TestValidMintItems(t *testing.T) {
+	to := "0x33AD388F713f7A043504f9c0b717841aC5a34e0B"
+	metadata := model.SpikeMetadata{
+		Name:        "Soul",
+		Description: "spike soul",
+		SpikeInfo: model.SpikeInfo{
+			Version:        "1",
+			SpikeModelURL:  "https://spike.game/model/1",
+			SpikeModelType: "soul",
+		},
+	}
+
+	assert.NoError(t, validMintItems([]MintItem{{TokenId: "1", To: to, Metadata: metadata}}))
+	assert.NoError(t, validMintItems([]MintItem{{TokenId: "2", To: to, TokenUri: "https://gateway/ipfs/Qm"}}))
+	assert.Error(t, validMintItems(nil))
+	assert.Error(t, validMintItems([]MintItem{{TokenId: "x", To: to, Metadata: metadata}}))
+	assert.Error(t, validMintItems([]MintItem{{TokenId: "1", To: emptyAddress, Metadata: metadata}}))
+	assert.Error(t, validMintItems([]MintItem{{TokenId: "1", To: to}}))
+	assert.Error(t, validMintItems([]MintItem{
+		{TokenId: "1", To: to, Metadata: metadata},
+		{TokenId: "01", To: to, Metadata: metadata},
+	}))
+}
+
+func TestMintJobDone(t *testing.T) {
+	job := MintJob{Items: []MintItem{{Status: mintMinted}, {Status: mintSent}}}
+	assert.False(t, job.done())
+	job.Items[1].Status = mintFailed
+	assert.True(t, job.done())
+}
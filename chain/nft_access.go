@@ -0,0 +1,152 @@
+package chain
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"spike-blockchain-server/chain/contract"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/middleware"
+	"spike-blockchain-server/serializer"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	accessOwner  = "owner"
+	accessRenter = "renter"
+	accessNone   = "none"
+
+	signNoncePrefix  = "sign_nonce_"
+	nftAccessPurpose = "Spike NFT metadata access"
+	signNonceMaxAge  = 5 * time.Minute
+	// signNonceDuration keeps a used nonce until no clock skew makes it
+	// valid again.
+	signNonceDuration = 2 * signNonceMaxAge
+)
+
+type VerifiedMetadata struct {
+	TokenId     string `json:"tokenId"`
+	Address     string `json:"address"`
+	Access      string `json:"access"`
+	Owner       string `json:"owner"`
+	User        string `json:"user"`
+	UserExpires uint64 `json:"userExpires"`
+	Signed      bool   `json:"signed"`
+	Metadata    string `json:"metadata"`
+}
+
+// queryVerifiedNftMetadata returns the metadata together with the rights of
+// the address on the token, read from ownerOf and userOf on chain.
+func (bl *BscListener) queryVerifiedNftMetadata(tokenId *big.Int, service metadataService) serializer.Response {
+	if !common.IsHexAddress(service.Address) {
+		return serializer.Response{
+			Code:  500,
+			Error: ErrorParam.Error(),
+		}
+	}
+	signed := service.Sign != ""
+	if signed {
+		msg := nftAccessMessage(config.Cfg.Contract.GameNftAddress, tokenId, service.Nonce)
+		if !middleware.VerifySignature(service.Address, msg, service.Sign) {
+			return serializer.Response{
+				Code:  101,
+				Error: "Invalid signature",
+			}
+		}
+		if !freshNonce(service.Nonce, time.Now()) {
+			return serializer.Response{
+				Code:  101,
+				Error: "nonce expired",
+			}
+		}
+		// a signature proves the address only once
+		key := signNoncePrefix + strings.ToLower(service.Address) + "_" + service.Nonce
+		if ok, err := bl.rc.SetNX(key, 1, signNonceDuration).Result(); err != nil || !ok {
+			return serializer.Response{
+				Code:  101,
+				Error: "nonce already used",
+			}
+		}
+	}
+	aunft, err := contract.NewGameNft(common.HexToAddress(config.Cfg.Contract.GameNftAddress), bl.ec)
+	if err != nil {
+		log.Error("new auNft err : ", err)
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	owner, err := aunft.OwnerOf(nil, tokenId)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	user, err := aunft.UserOf(nil, tokenId)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	expires, err := aunft.UserExpires(nil, tokenId)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	sm, err := bl.metadata.get(tokenId.String())
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: VerifiedMetadata{
+			TokenId:     tokenId.String(),
+			Address:     service.Address,
+			Access:      accessOf(service.Address, owner, user),
+			Owner:       owner.Hex(),
+			User:        user.Hex(),
+			UserExpires: expires.Uint64(),
+			Signed:      signed,
+			Metadata:    sm.Metadata,
+		},
+	}
+}
+
+// nftAccessMessage is the text the address personal_signs to prove it holds
+// tokenId, a signature for another purpose, contract or token does not verify.
+func nftAccessMessage(contractAddr string, tokenId *big.Int, nonce string) string {
+	return fmt.Sprintf("%s\nContract: %s\nToken: %s\nNonce: %s", nftAccessPurpose, common.HexToAddress(contractAddr).Hex(), tokenId.String(), nonce)
+}
+
+// freshNonce reports whether nonce is a unix time in seconds within
+// signNonceMaxAge of now.
+func freshNonce(nonce string, now time.Time) bool {
+	ts, err := strconv.ParseInt(nonce, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	return age <= signNonceMaxAge && age >= -signNonceMaxAge
+}
+
+// accessOf relies on userOf returning the zero address once a rental expired.
+func accessOf(address string, owner, user common.Address) string {
+	addr := common.HexToAddress(address)
+	switch {
+	case addr == owner:
+		return accessOwner
+	case addr == user && user != (common.Address{}):
+		return accessRenter
+	default:
+		return accessNone
+	}
+}
@@ -0,0 +1,77 @@
+package chain
+
+import (
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"spike-blockchain-server/middleware"
+)
+
+func TestFreshNonce(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, tc := range []struct {
+		nonce string
+		fresh bool
+	}{
+		{strconv.FormatInt(now.Unix(), 10), true},
+		{strconv.FormatInt(now.Add(-signNonceMaxAge).Unix(), 10), true},
+		{strconv.FormatInt(now.Add(-signNonceMaxAge-time.Second).Unix(), 10), false},
+		{strconv.FormatInt(now.Add(signNonceMaxAge).Unix(), 10), true},
+		{strconv.FormatInt(now.Add(signNonceMaxAge+time.Second).Unix(), 10), false},
+		{strconv.FormatInt(now.UnixMilli(), 10), false},
+		{"", false},
+		{"nonce", false},
+	} {
+		assert.Equal(t, tc.fresh, freshNonce(tc.nonce, now), tc.nonce)
+	}
+}
+
+func TestAccessOf(t *testing.T) {
+	owner := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	renter := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	for _, tc := range []struct {
+		address string
+		user    common.Address
+		access  string
+	}{
+		{owner.Hex(), renter, accessOwner},
+		{"0x1111111111111111111111111111111111111111", common.Address{}, accessOwner},
+		{renter.Hex(), renter, accessRenter},
+		// the owner renting to itself is still the owner
+		{owner.Hex(), owner, accessOwner},
+		{renter.Hex(), common.Address{}, accessNone},
+		{"0x3333333333333333333333333333333333333333", renter, accessNone},
+		{emptyAddress, common.Address{}, accessNone},
+	} {
+		assert.Equal(t, tc.access, accessOf(tc.address, owner, tc.user), tc.address)
+	}
+}
+
+func TestNftAccessMessage(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	addr := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	contractAddr := "0x4444444444444444444444444444444444444444"
+	nonce := strconv.FormatInt(time.Now().Unix(), 10)
+
+	msg := nftAccessMessage(contractAddr, big.NewInt(7), nonce)
+	sig, err := crypto.Sign(accounts.TextHash([]byte(msg)), key)
+	assert.NoError(t, err)
+	sign := hexutil.Encode(sig)
+
+	assert.True(t, middleware.VerifySignature(addr, msg, sign))
+	assert.False(t, middleware.VerifySignature(addr, nftAccessMessage(contractAddr, big.NewInt(8), nonce), sign))
+	assert.False(t, middleware.VerifySignature(addr, nftAccessMessage("0x5555555555555555555555555555555555555555", big.NewInt(7), nonce), sign))
+	// a bare nonce signed for login does not grant access
+	bare, err := crypto.Sign(accounts.TextHash([]byte(nonce)), key)
+	assert.NoError(t, err)
+	assert.False(t, middleware.VerifySignature(addr, msg, hexutil.Encode(bare)))
+}
@@ -0,0 +1,228 @@
+package chain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const sortByBlock = "block"
+
+// AttrFilter matches CacheData.Attributes[Trait], by equality when Eq is set
+// and by numeric range with Min and Max.
+type AttrFilter struct {
+	Trait string      `json:"trait"`
+	Eq    interface{} `json:"eq"`
+	Min   *float64    `json:"min"`
+	Max   *float64    `json:"max"`
+}
+
+type NftQuery struct {
+	GameId     string       `json:"gameId"`
+	SpikeType  string       `json:"spikeType"`
+	Search     string       `json:"search"`
+	Attributes []AttrFilter `json:"attributes"`
+	// SortBy is block, the acquisition block, or an attribute trait.
+	SortBy string `json:"sortBy"`
+	Desc   bool   `json:"desc"`
+	Cursor string `json:"cursor"`
+}
+
+type NftPage struct {
+	Total      int         `json:"total"`
+	NextCursor string      `json:"next_cursor"`
+	Result     []CacheData `json:"result"`
+}
+
+// sortKey orders numbers before strings and puts missing values last.
+type sortKey struct {
+	Missing bool    `json:"m,omitempty"`
+	IsNum   bool    `json:"n,omitempty"`
+	Num     float64 `json:"f,omitempty"`
+	Str     string  `json:"s,omitempty"`
+}
+
+type nftCursor struct {
+	Key     sortKey `json:"k"`
+	TokenId string  `json:"id"`
+}
+
+func (q *NftQuery) match(cd CacheData) bool {
+	if q.GameId != "" && cd.GameId != q.GameId {
+		return false
+	}
+	if q.SpikeType != "" && !strings.EqualFold(cd.SpikeInfo.Tp, q.SpikeType) {
+		return false
+	}
+	if q.Search != "" {
+		search := strings.ToLower(q.Search)
+		name := strings.ToLower(cd.Type + " #" + cd.GameId)
+		if !strings.Contains(name, search) && !strings.Contains(strings.ToLower(cd.Description), search) {
+			return false
+		}
+	}
+	for _, f := range q.Attributes {
+		v, ok := cd.Attributes[f.Trait]
+		if !ok {
+			return false
+		}
+		if f.Eq != nil && !strings.EqualFold(fmt.Sprint(v), fmt.Sprint(f.Eq)) {
+			return false
+		}
+		if f.Min != nil || f.Max != nil {
+			n, ok := toFloat(v)
+			if !ok || (f.Min != nil && n < *f.Min) || (f.Max != nil && n > *f.Max) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (q *NftQuery) keyOf(cd CacheData) sortKey {
+	if q.SortBy == "" || q.SortBy == sortByBlock {
+		n, err := strconv.ParseFloat(cd.BlockNumber, 64)
+		if err != nil {
+			return sortKey{Missing: true}
+		}
+		return sortKey{IsNum: true, Num: n}
+	}
+	v, ok := cd.Attributes[q.SortBy]
+	if !ok || v == nil {
+		return sortKey{Missing: true}
+	}
+	if n, ok := toFloat(v); ok {
+		return sortKey{IsNum: true, Num: n}
+	}
+	return sortKey{Str: fmt.Sprint(v)}
+}
+
+// less orders a before b, Desc reverses the values but keeps missing ones last
+// and ties are broken by tokenId so that cursors are stable.
+func (q *NftQuery) less(a sortKey, aId string, b sortKey, bId string) bool {
+	if a.Missing != b.Missing {
+		return b.Missing
+	}
+	if c := compareKey(a, b); c != 0 {
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return compareTokenId(aId, bId) < 0
+}
+
+func compareKey(a, b sortKey) int {
+	switch {
+	case a.Missing || b.Missing:
+		return 0
+	case a.IsNum != b.IsNum:
+		if a.IsNum {
+			return -1
+		}
+		return 1
+	case a.IsNum:
+		if a.Num < b.Num {
+			return -1
+		} else if a.Num > b.Num {
+			return 1
+		}
+		return 0
+	default:
+		return strings.Compare(a.Str, b.Str)
+	}
+}
+
+func compareTokenId(a, b string) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// filtered reports whether any filter or sort field is set.
+func (q *NftQuery) filtered() bool {
+	return q.GameId != "" || q.SpikeType != "" || q.Search != "" || len(q.Attributes) > 0 || q.SortBy != "" || q.Desc
+}
+
+// apply filters and sorts dataList and returns the page after the cursor.
+func (q *NftQuery) apply(dataList []CacheData, pageSize int) (NftPage, error) {
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	matched := make([]CacheData, 0, len(dataList))
+	for _, cd := range dataList {
+		if q.match(cd) {
+			matched = append(matched, cd)
+		}
+	}
+	keys := make(map[string]sortKey, len(matched))
+	for _, cd := range matched {
+		keys[cd.TokenId] = q.keyOf(cd)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return q.less(keys[matched[i].TokenId], matched[i].TokenId, keys[matched[j].TokenId], matched[j].TokenId)
+	})
+
+	start := 0
+	if q.Cursor != "" {
+		cursor, err := decodeNftCursor(q.Cursor)
+		if err != nil {
+			return NftPage{}, err
+		}
+		start = sort.Search(len(matched), func(i int) bool {
+			return q.less(cursor.Key, cursor.TokenId, keys[matched[i].TokenId], matched[i].TokenId)
+		})
+	}
+	end := start + pageSize
+	if end > len(matched) {
+		end = len(matched)
+	}
+	page := NftPage{
+		Total:  len(matched),
+		Result: matched[start:end],
+	}
+	if end < len(matched) {
+		last := matched[end-1]
+		page.NextCursor = encodeNftCursor(nftCursor{Key: keys[last.TokenId], TokenId: last.TokenId})
+	}
+	return page, nil
+}
+
+func encodeNftCursor(c nftCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeNftCursor(s string) (nftCursor, error) {
+	var c nftCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrorParam
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrorParam
+	}
+	return c, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case string:
+		n, err := strconv.ParseFloat(t, 64)
+		return n, err == nil
+	case json.Number:
+		n, err := t.Float64()
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
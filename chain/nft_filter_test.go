@@ -0,0 +1,73 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSouls() []CacheData {
+	return []CacheData{
+		{Type: "Soul", GameId: "1", TokenId: "1", BlockNumber: "900", Description: "fire soul", SpikeInfo: SpikeInfo{Tp: "soul"}, Attributes: map[string]interface{}{"level": float64(3), "rarity": "rare"}},
+		{Type: "Soul", GameId: "2", TokenId: "2", BlockNumber: "1000", Description: "water soul", SpikeInfo: SpikeInfo{Tp: "soul"}, Attributes: map[string]interface{}{"level": "10", "rarity": "common"}},
+		{Type: "Soul", GameId: "3", TokenId: "10", BlockNumber: "950", Description: "fire soul", SpikeInfo: SpikeInfo{Tp: "soul"}, Attributes: map[string]interface{}{"level": float64(7), "rarity": "Rare"}},
+		{Type: "Soul", GameId: "4", TokenId: "4", BlockNumber: "800", Description: "earth soul", SpikeInfo: SpikeInfo{Tp: "soul"}, Attributes: map[string]interface{}{"rarity": "common"}},
+	}
+}
+
+func tokenIds(cds []CacheData) []string {
+	ids := make([]string, 0, len(cds))
+	for _, cd := range cds {
+		ids = append(ids, cd.TokenId)
+	}
+	return ids
+}
+
+func TestNftQueryFilter(t *testing.T) {
+	min := float64(5)
+	q := NftQuery{Attributes: []AttrFilter{{Trait: "rarity", Eq: "rare"}}}
+	page, err := q.apply(testSouls(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "10"}, tokenIds(page.Result))
+
+	q = NftQuery{Attributes: []AttrFilter{{Trait: "level", Min: &min}}, SortBy: "level", Desc: true}
+	page, err = q.apply(testSouls(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "10"}, tokenIds(page.Result))
+
+	q = NftQuery{Search: "FIRE"}
+	page, err = q.apply(testSouls(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "10"}, tokenIds(page.Result))
+
+	q = NftQuery{Search: "soul #4"}
+	page, err = q.apply(testSouls(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4"}, tokenIds(page.Result))
+}
+
+func TestNftQueryCursor(t *testing.T) {
+	q := NftQuery{SortBy: "level"}
+	assert.True(t, q.filtered())
+	page, err := q.apply(testSouls(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, page.Total)
+	assert.Equal(t, []string{"1", "10"}, tokenIds(page.Result))
+	assert.NotEmpty(t, page.NextCursor)
+
+	q.Cursor = page.NextCursor
+	page, err = q.apply(testSouls(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "4"}, tokenIds(page.Result))
+	assert.Empty(t, page.NextCursor)
+
+	q = NftQuery{}
+	assert.False(t, q.filtered())
+	page, err = q.apply(testSouls(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4", "1", "10", "2"}, tokenIds(page.Result))
+
+	q.Cursor = "not a cursor"
+	_, err = q.apply(testSouls(), 10)
+	assert.Error(t, err)
+}
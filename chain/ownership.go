@@ -0,0 +1,194 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/go-redis/redis"
+	"math/big"
+	"spike-blockchain-server/config"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	nftOwnerKey         = "nft_owner"
+	nftOwnedSuffix      = "_nftOwned"
+	nftOwnerBackfillKey = "nft_owner_backfill"
+	ownerBackfillStep   = 5000
+)
+
+type Ownership struct {
+	TokenId     string `json:"tokenId"`
+	Owner       string `json:"owner"`
+	BlockNumber uint64 `json:"blockNumber"`
+	LogIndex    uint   `json:"logIndex"`
+}
+
+func (o Ownership) after(blockNumber uint64, logIndex uint) bool {
+	return o.BlockNumber > blockNumber || (o.BlockNumber == blockNumber && o.LogIndex >= logIndex)
+}
+
+// transferred returns the ownership after a transfer of tokenId to owner, ok
+// is false when prev already reflects the same or a later transfer.
+func transferred(prev *Ownership, tokenId, owner string, blockNumber uint64, logIndex uint) (Ownership, bool) {
+	if prev != nil && prev.after(blockNumber, logIndex) {
+		return *prev, false
+	}
+	return Ownership{
+		TokenId:     tokenId,
+		Owner:       owner,
+		BlockNumber: blockNumber,
+		LogIndex:    logIndex,
+	}, true
+}
+
+// OwnershipIndex keeps tokenId -> owner of the game nft from its Transfer
+// events. It is filled by a backfill from the deploy block and then by the
+// finalized events of the nft listener.
+type OwnershipIndex struct {
+	ec    *ethclient.Client
+	rpc   *rpc.Client
+	rc    *redis.Client
+	lk    sync.Mutex
+	ready int32
+	// onChange is called after tokenId moved from prev to owner, prev is
+	// empty for the first transfer the index sees.
+	onChange func(tokenId, prev, owner string)
+}
+
+func newOwnershipIndex(ec *ethclient.Client, rpcClient *rpc.Client, rc *redis.Client) *OwnershipIndex {
+	return &OwnershipIndex{
+		ec:  ec,
+		rpc: rpcClient,
+		rc:  rc,
+	}
+}
+
+// Ready reports whether the backfill has reached the chain, before that the
+// index misses tokens and wallets are served from moralis.
+func (oi *OwnershipIndex) Ready() bool {
+	return atomic.LoadInt32(&oi.ready) == 1
+}
+
+func (oi *OwnershipIndex) onTransfer(ev *DecodedEvent) {
+	if ev.Stage != stageFinalized.String() {
+		return
+	}
+	oi.apply(ev.BigInt("tokenId").String(), ev.Address("from").Hex(), ev.Address("to").Hex(), ev.BlockNumber, ev.LogIndex)
+}
+
+// apply moves tokenId to its new owner unless a later transfer is already
+// indexed, so the backfill and the live listener may overlap.
+func (oi *OwnershipIndex) apply(tokenId, from, to string, blockNumber uint64, logIndex uint) {
+	oi.lk.Lock()
+	defer oi.lk.Unlock()
+	var prev *Ownership
+	if saved, ok := oi.get(tokenId); ok {
+		prev = &saved
+	}
+	next, ok := transferred(prev, tokenId, to, blockNumber, logIndex)
+	if !ok {
+		return
+	}
+	var prevOwner string
+	if prev != nil {
+		prevOwner = prev.Owner
+		oi.rc.SRem(strings.ToLower(prev.Owner)+nftOwnedSuffix, tokenId)
+	}
+	oi.rc.SRem(strings.ToLower(from)+nftOwnedSuffix, tokenId)
+	ownership, err := json.Marshal(next)
+	if err != nil {
+		log.Error("json marshal err : ", err)
+		return
+	}
+	oi.rc.HSet(nftOwnerKey, tokenId, string(ownership))
+	if to != emptyAddress {
+		oi.rc.SAdd(strings.ToLower(to)+nftOwnedSuffix, tokenId)
+	}
+	if oi.onChange != nil {
+		oi.onChange(tokenId, prevOwner, to)
+	}
+}
+
+func (oi *OwnershipIndex) get(tokenId string) (Ownership, bool) {
+	var ownership Ownership
+	val, err := oi.rc.HGet(nftOwnerKey, tokenId).Result()
+	if err != nil {
+		return ownership, false
+	}
+	if err := json.Unmarshal([]byte(val), &ownership); err != nil {
+		return ownership, false
+	}
+	return ownership, true
+}
+
+// tokensOf returns the tokens owned by addr with the block they were acquired in.
+func (oi *OwnershipIndex) tokensOf(addr string) ([]Ownership, error) {
+	tokenIds, err := oi.rc.SMembers(strings.ToLower(addr) + nftOwnedSuffix).Result()
+	if err != nil {
+		return nil, err
+	}
+	owned := make([]Ownership, 0, len(tokenIds))
+	for _, tokenId := range tokenIds {
+		ownership, ok := oi.get(tokenId)
+		if !ok || !strings.EqualFold(ownership.Owner, addr) {
+			continue
+		}
+		owned = append(owned, ownership)
+	}
+	return owned, nil
+}
+
+// backfill replays the Transfer logs from the deploy block, or from where an
+// interrupted backfill stopped, up to the finalized block.
+func (oi *OwnershipIndex) backfill() {
+	transfer := getABI(GameNftABI).Events["Transfer"]
+	head, err := oi.ec.BlockNumber(context.Background())
+	for err != nil {
+		log.Error("query now blockNum err : ", err)
+		time.Sleep(time.Second)
+		head, err = oi.ec.BlockNumber(context.Background())
+	}
+	to := queryFinalizedHeight(oi.rpc, new(big.Int).SetUint64(head)).Uint64()
+	from := config.Cfg.Contract.GameNftDeployBlock
+	if cursor, err := oi.rc.Get(nftOwnerBackfillKey).Uint64(); err == nil {
+		from = cursor + 1
+	}
+	for from <= to {
+		end := from + ownerBackfillStep - 1
+		if end > to {
+			end = to
+		}
+		logs, err := oi.ec.FilterLogs(context.Background(), ethereum.FilterQuery{
+			Addresses: []common.Address{common.HexToAddress(config.Cfg.Contract.GameNftAddress)},
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Topics:    [][]common.Hash{{transfer.ID}},
+		})
+		if err != nil {
+			log.Errorf("nft owner backfill err : %+v, from : %d, to : %d", err, from, end)
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, l := range logs {
+			args, err := decodeLog(transfer, l)
+			if err != nil {
+				log.Errorf("nft owner backfill unpack err : %+v, txHash : %s", err, l.TxHash)
+				continue
+			}
+			ev := &DecodedEvent{decodedArgs: args}
+			oi.apply(ev.BigInt("tokenId").String(), ev.Address("from").Hex(), ev.Address("to").Hex(), l.BlockNumber, l.Index)
+		}
+		oi.rc.Set(nftOwnerBackfillKey, strconv.FormatUint(end, 10), 0)
+		from = end + 1
+	}
+	log.Infof("nft owner backfill done, blockNum : %d", to)
+	atomic.StoreInt32(&oi.ready, 1)
+}
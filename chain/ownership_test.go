@@ -0,0 +1,82 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnershipTransferred(t *testing.T) {
+	const (
+		alice = "0x1111111111111111111111111111111111111111"
+		bob   = "0x2222222222222222222222222222222222222222"
+		carol = "0x3333333333333333333333333333333333333333"
+	)
+	type transfer struct {
+		to          string
+		blockNumber uint64
+		logIndex    uint
+	}
+	for _, tc := range []struct {
+		name      string
+		transfers []transfer
+		owner     string
+		applied   []bool
+	}{
+		{
+			name:      "in order",
+			transfers: []transfer{{alice, 10, 0}, {bob, 11, 3}, {carol, 12, 1}},
+			owner:     carol,
+			applied:   []bool{true, true, true},
+		},
+		{
+			name:      "older log after a newer one",
+			transfers: []transfer{{alice, 10, 0}, {carol, 12, 1}, {bob, 11, 3}},
+			owner:     carol,
+			applied:   []bool{true, true, false},
+		},
+		{
+			name:      "same block ordered by log index",
+			transfers: []transfer{{alice, 10, 0}, {bob, 11, 2}, {carol, 11, 5}},
+			owner:     carol,
+			applied:   []bool{true, true, true},
+		},
+		{
+			name:      "same block lower log index late",
+			transfers: []transfer{{alice, 10, 0}, {carol, 11, 5}, {bob, 11, 2}},
+			owner:     carol,
+			applied:   []bool{true, true, false},
+		},
+		{
+			name:      "same log seen twice",
+			transfers: []transfer{{alice, 10, 0}, {bob, 11, 2}, {bob, 11, 2}},
+			owner:     bob,
+			applied:   []bool{true, true, false},
+		},
+		{
+			// the live listener indexed block 20 while the backfill still
+			// replays the blocks before it
+			name:      "backfill overlapping live events",
+			transfers: []transfer{{carol, 20, 0}, {alice, 10, 0}, {bob, 15, 1}, {carol, 20, 0}, {alice, 21, 0}},
+			owner:     alice,
+			applied:   []bool{true, false, false, false, true},
+		},
+		{
+			name:      "burn is a transfer too",
+			transfers: []transfer{{alice, 10, 0}, {emptyAddress, 12, 0}, {bob, 11, 0}},
+			owner:     emptyAddress,
+			applied:   []bool{true, true, false},
+		},
+	} {
+		var prev *Ownership
+		applied := make([]bool, 0, len(tc.transfers))
+		for _, tr := range tc.transfers {
+			next, ok := transferred(prev, "7", tr.to, tr.blockNumber, tr.logIndex)
+			applied = append(applied, ok)
+			prev = &next
+		}
+		assert.Equal(t, tc.applied, applied, tc.name)
+		assert.Equal(t, tc.owner, prev.Owner, tc.name)
+		assert.Equal(t, "7", prev.TokenId, tc.name)
+	}
+}
@@ -0,0 +1,166 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"math/big"
+	"spike-blockchain-server/chain/contract"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+	"spike-blockchain-server/service/price"
+	"sync"
+)
+
+type Holding struct {
+	Symbol    string  `json:"symbol"`
+	Token     string  `json:"token"`
+	Balance   string  `json:"balance"`
+	Amount    string  `json:"amount"`
+	Decimals  uint8   `json:"decimals"`
+	UsdPrice  float64 `json:"usdPrice"`
+	UsdValue  float64 `json:"usdValue"`
+	Change24h float64 `json:"change24h"`
+	// Error is set when the price could not be queried, the holding is then
+	// left out of the total value.
+	Error string `json:"error,omitempty"`
+}
+
+type Portfolio struct {
+	Address       string    `json:"address"`
+	Holdings      []Holding `json:"holdings"`
+	Nfts          []NftType `json:"nfts"`
+	TotalUsdValue float64   `json:"totalUsdValue"`
+}
+
+type portfolioToken struct {
+	tp      TokenType
+	symbol  string
+	price   string
+	address string
+}
+
+func portfolioTokens() []portfolioToken {
+	return []portfolioToken{
+		{tp: governanceToken, symbol: "SKK", price: "skk", address: config.Cfg.Contract.GovernanceTokenAddress},
+		{tp: gameToken, symbol: "SKS", price: "sks", address: config.Cfg.Contract.GameTokenAddress},
+		{tp: usdc, symbol: "USDC", price: "usdc", address: config.Cfg.Contract.UsdcAddress},
+		{tp: bnb, symbol: "BNB", price: "bnb"},
+	}
+}
+
+func (bl *BscListener) QueryWalletPortfolio(c *gin.Context) {
+	var service balanceService
+	if err := c.ShouldBind(&service); err == nil && common.IsHexAddress(service.Address) {
+		res := bl.queryWalletPortfolio(service.Address)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) queryWalletPortfolio(address string) serializer.Response {
+	tokens := portfolioTokens()
+	holdings := make([]Holding, len(tokens))
+	errs := make([]error, len(tokens))
+	var wg sync.WaitGroup
+	for i, token := range tokens {
+		wg.Add(1)
+		go func(i int, token portfolioToken) {
+			defer wg.Done()
+			holdings[i], errs[i] = bl.queryHolding(address, token)
+		}(i, token)
+	}
+	var nfts []NftType
+	var nftErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		nfts, nftErr = bl.walletNftTypes(address)
+	}()
+	wg.Wait()
+	for _, err := range append(errs, nftErr) {
+		if err != nil {
+			return serializer.Response{
+				Code:  500,
+				Msg:   "chain node err ",
+				Error: err.Error(),
+			}
+		}
+	}
+
+	total := decimal.Zero
+	for _, h := range holdings {
+		if h.Error == "" {
+			total = total.Add(decimal.NewFromFloat(h.UsdValue))
+		}
+	}
+	totalValue, _ := total.Float64()
+	return serializer.Response{
+		Code: 200,
+		Data: Portfolio{
+			Address:       address,
+			Holdings:      holdings,
+			Nfts:          nfts,
+			TotalUsdValue: totalValue,
+		},
+	}
+}
+
+// queryHolding reads the balance of one token, a token without address is
+// the native bnb.
+func (bl *BscListener) queryHolding(address string, token portfolioToken) (Holding, error) {
+	addr := common.HexToAddress(address)
+	var balance *big.Int
+	if token.address == "" {
+		b, err := bl.ec.BalanceAt(context.Background(), addr, nil)
+		if err != nil {
+			return Holding{}, err
+		}
+		balance = b
+	} else {
+		erc20, err := contract.NewGameToken(common.HexToAddress(token.address), bl.ec)
+		if err != nil {
+			return Holding{}, err
+		}
+		if balance, err = erc20.BalanceOf(nil, addr); err != nil {
+			return Holding{}, err
+		}
+	}
+	formatted, decimals := bl.tokens.formatAmount(token.tp, balance)
+	amount := ToDecimal(balance, int(decimals))
+	h := Holding{
+		Symbol:   token.symbol,
+		Token:    token.address,
+		Balance:  balance.String(),
+		Amount:   formatted,
+		Decimals: decimals,
+	}
+	p, err := price.GetPrice(token.price)
+	if err != nil {
+		log.Errorf("query %s price err : %+v", token.price, err)
+		h.Error = err.Error()
+		return h, nil
+	}
+	h.UsdPrice = p.UsdPrice
+	h.Change24h = p.Change24h
+	h.UsdValue, _ = amount.Mul(decimal.NewFromFloat(p.UsdPrice)).Float64()
+	return h, nil
+}
+
+// walletNftTypes returns the nft count by type from the wallet cache, the
+// same data /chain/nft/type serves.
+func (bl *BscListener) walletNftTypes(address string) ([]NftType, error) {
+	t := bl.GetJson(address + nftTypeSuffix)
+	if t == "" {
+		return bl.queryWalletNft(address, bl.network)
+	}
+	nftType := make([]NftType, 0)
+	err := json.Unmarshal([]byte(t), &nftType)
+	return nftType, err
+}
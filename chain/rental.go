@@ -0,0 +1,325 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"math/big"
+	"spike-blockchain-server/chain/contract"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/game"
+	"spike-blockchain-server/serializer"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	nftRentalKey         = "nft_rental"
+	nftRentalExpiryKey   = "nft_rental_expiry"
+	nftRentalBackfillKey = "nft_rental_backfill"
+	rentedSuffix         = "_rented"
+	rentalExpiryInterval = 30 * time.Second
+)
+
+type Rental struct {
+	TokenId string `json:"tokenId"`
+	User    string `json:"user"`
+	Expires uint64 `json:"expires"`
+	Expired bool   `json:"expired"`
+	// BlockNumber and LogIndex locate the UpdateUser event the rental was
+	// read from, they are empty for rentals read from the contract.
+	BlockNumber uint64 `json:"blockNumber,omitempty"`
+	LogIndex    uint   `json:"logIndex,omitempty"`
+}
+
+func (r Rental) after(blockNumber uint64, logIndex uint) bool {
+	return r.BlockNumber > blockNumber || (r.BlockNumber == blockNumber && r.LogIndex >= logIndex)
+}
+
+type rentalService struct {
+	TokenId string `form:"tokenId" json:"tokenId" binding:"required"`
+}
+
+type rentedService struct {
+	User string `form:"user" json:"user" binding:"required"`
+}
+
+// RentalTracker indexes ERC-4907 UpdateUser events of the game nft and
+// notifies when a rental expires. It is filled by a backfill from the deploy
+// block and then by the finalized events of the nft listener.
+type RentalTracker struct {
+	ec            *ethclient.Client
+	rpc           *rpc.Client
+	rc            *redis.Client
+	lk            sync.Mutex
+	decodedNotify chan DecodedEvent
+}
+
+func newRentalTracker(ec *ethclient.Client, rpcClient *rpc.Client, rc *redis.Client, decodedNotify chan DecodedEvent) *RentalTracker {
+	return &RentalTracker{
+		ec:            ec,
+		rpc:           rpcClient,
+		rc:            rc,
+		decodedNotify: decodedNotify,
+	}
+}
+
+func (rt *RentalTracker) mapping() EventMapping {
+	return EventMapping{
+		Topic:         game.NFTRENTALTOPIC,
+		FinalizedOnly: true,
+		Handle: func(ev *DecodedEvent) {
+			if ev.Stage != stageFinalized.String() {
+				return
+			}
+			rt.apply(ev.BlockNumber, ev.LogIndex, ev.decodedArgs)
+		},
+	}
+}
+
+// apply indexes the decoded args of an UpdateUser event, events with
+// unexpected args are logged and skipped.
+func (rt *RentalTracker) apply(blockNumber uint64, logIndex uint, args decodedArgs) {
+	expires, ok := args.Arg("expires").(uint64)
+	if !ok {
+		log.Errorf("nft rental unexpected expires : %v, blockNum : %d, logIndex : %d", args.Arg("expires"), blockNumber, logIndex)
+		return
+	}
+	rt.update(args.BigInt("tokenId").String(), args.Address("user").String(), expires, blockNumber, logIndex)
+}
+
+// update records the rental unless a later UpdateUser is already indexed, so
+// the backfill and the live listener may overlap. Ended rentals stay in the
+// hash to keep their position but leave the rented set and expiry queue.
+func (rt *RentalTracker) update(tokenId, user string, expires, blockNumber uint64, logIndex uint) {
+	rt.lk.Lock()
+	defer rt.lk.Unlock()
+	if prev, ok := rt.get(tokenId); ok {
+		if prev.after(blockNumber, logIndex) {
+			return
+		}
+		rt.rc.SRem(strings.ToLower(prev.User)+rentedSuffix, tokenId)
+	}
+	rental, err := json.Marshal(Rental{
+		TokenId:     tokenId,
+		User:        user,
+		Expires:     expires,
+		BlockNumber: blockNumber,
+		LogIndex:    logIndex,
+	})
+	if err != nil {
+		log.Error("json marshal err : ", err)
+		return
+	}
+	rt.rc.HSet(nftRentalKey, tokenId, string(rental))
+	if user == emptyAddress || expires <= uint64(time.Now().Unix()) {
+		rt.rc.ZRem(nftRentalExpiryKey, tokenId)
+		return
+	}
+	rt.rc.SAdd(strings.ToLower(user)+rentedSuffix, tokenId)
+	rt.rc.ZAdd(nftRentalExpiryKey, redis.Z{Score: float64(expires), Member: tokenId})
+}
+
+func (rt *RentalTracker) get(tokenId string) (Rental, bool) {
+	var rental Rental
+	val, err := rt.rc.HGet(nftRentalKey, tokenId).Result()
+	if err != nil {
+		return rental, false
+	}
+	if err := json.Unmarshal([]byte(val), &rental); err != nil {
+		return rental, false
+	}
+	return rental, true
+}
+
+// run publishes an expired event for every rental whose expiry has passed.
+func (rt *RentalTracker) run() {
+	ticker := time.NewTicker(rentalExpiryInterval)
+	for range ticker.C {
+		now := time.Now().Unix()
+		tokenIds, err := rt.rc.ZRangeByScore(nftRentalExpiryKey, redis.ZRangeBy{
+			Min: "-inf",
+			Max: strconv.FormatInt(now, 10),
+		}).Result()
+		if err != nil {
+			log.Error("query expired rentals err : ", err)
+			continue
+		}
+		for _, tokenId := range tokenIds {
+			rt.lk.Lock()
+			rental, ok := rt.get(tokenId)
+			if ok && rental.Expires > uint64(now) {
+				// renewed since the range query
+				rt.lk.Unlock()
+				continue
+			}
+			rt.rc.ZRem(nftRentalExpiryKey, tokenId)
+			if ok {
+				rt.rc.SRem(strings.ToLower(rental.User)+rentedSuffix, tokenId)
+			}
+			rt.lk.Unlock()
+			if !ok {
+				continue
+			}
+			rt.decodedNotify <- DecodedEvent{
+				Contract:  config.Cfg.Contract.GameNftAddress,
+				TokenType: gameNft.String(),
+				Event:     "UserExpired",
+				PayTime:   now * 1000,
+				Stage:     stageFinalized.String(),
+				Fields: map[string]interface{}{
+					"tokenId": rental.TokenId,
+					"user":    rental.User,
+					"expires": rental.Expires,
+				},
+				topic: game.NFTRENTALEXPIREDTOPIC,
+			}
+		}
+	}
+}
+
+// backfill replays the UpdateUser logs from the deploy block, or from where
+// an interrupted backfill stopped, up to the finalized block, so rentals that
+// started before the listener are listed too.
+func (rt *RentalTracker) backfill() {
+	updateUser := getABI(GameNftABI).Events["UpdateUser"]
+	head, err := rt.ec.BlockNumber(context.Background())
+	for err != nil {
+		log.Error("query now blockNum err : ", err)
+		time.Sleep(time.Second)
+		head, err = rt.ec.BlockNumber(context.Background())
+	}
+	to := queryFinalizedHeight(rt.rpc, new(big.Int).SetUint64(head)).Uint64()
+	from := config.Cfg.Contract.GameNftDeployBlock
+	if cursor, err := rt.rc.Get(nftRentalBackfillKey).Uint64(); err == nil {
+		from = cursor + 1
+	}
+	for from <= to {
+		end := from + ownerBackfillStep - 1
+		if end > to {
+			end = to
+		}
+		logs, err := rt.ec.FilterLogs(context.Background(), ethereum.FilterQuery{
+			Addresses: []common.Address{common.HexToAddress(config.Cfg.Contract.GameNftAddress)},
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Topics:    [][]common.Hash{{updateUser.ID}},
+		})
+		if err != nil {
+			log.Errorf("nft rental backfill err : %+v, from : %d, to : %d", err, from, end)
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, l := range logs {
+			args, err := decodeLog(updateUser, l)
+			if err != nil {
+				log.Errorf("nft rental backfill unpack err : %+v, txHash : %s", err, l.TxHash)
+				continue
+			}
+			rt.apply(l.BlockNumber, l.Index, args)
+		}
+		rt.rc.Set(nftRentalBackfillKey, strconv.FormatUint(end, 10), 0)
+		from = end + 1
+	}
+	log.Infof("nft rental backfill done, blockNum : %d", to)
+}
+
+func (bl *BscListener) QueryNftRental(c *gin.Context) {
+	var service rentalService
+	if err := c.ShouldBind(&service); err == nil {
+		tokenId, ok := new(big.Int).SetString(service.TokenId, 10)
+		if !ok {
+			c.JSON(500, serializer.Response{
+				Code: 500,
+				Msg:  ErrorParam.Error(),
+			})
+			return
+		}
+		res := bl.queryNftRental(tokenId)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+// queryNftRental reads the current user from the contract, userOf already
+// returns the zero address once the rental expired.
+func (bl *BscListener) queryNftRental(tokenId *big.Int) serializer.Response {
+	aunft, err := contract.NewGameNft(common.HexToAddress(config.Cfg.Contract.GameNftAddress), bl.ec)
+	if err != nil {
+		log.Error("new auNft err : ", err)
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	user, err := aunft.UserOf(nil, tokenId)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	expires, err := aunft.UserExpires(nil, tokenId)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: Rental{
+			TokenId: tokenId.String(),
+			User:    user.String(),
+			Expires: expires.Uint64(),
+			Expired: expires.Uint64() != 0 && expires.Uint64() <= uint64(time.Now().Unix()),
+		},
+	}
+}
+
+func (bl *BscListener) QueryNftRented(c *gin.Context) {
+	var service rentedService
+	if err := c.ShouldBind(&service); err == nil {
+		res := bl.queryNftRented(service.User)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) queryNftRented(user string) serializer.Response {
+	tokenIds, err := bl.rc.SMembers(strings.ToLower(user) + rentedSuffix).Result()
+	if err != nil {
+		return serializer.Response{
+			Code: 500,
+			Msg:  err.Error(),
+		}
+	}
+	now := uint64(time.Now().Unix())
+	rentals := make([]Rental, 0)
+	for _, tokenId := range tokenIds {
+		rental, ok := bl.rental.get(tokenId)
+		if !ok || rental.Expires <= now || !strings.EqualFold(rental.User, user) {
+			continue
+		}
+		rentals = append(rentals, rental)
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: rentals,
+	}
+}
@@ -0,0 +1,370 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/xerrors"
+	"math/big"
+	"spike-blockchain-server/chain/contract"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+	"strconv"
+	"time"
+)
+
+const (
+	nftRoyaltyKey         = "nft_royalty"
+	nftRoyaltyBackfillKey = "nft_royalty_backfill"
+	defaultRoyaltyField   = "default"
+	royaltyBackfillPage   = 1000
+	// feeDenominator is the ERC2981 default, feeNumerator 250 is a 2.5% royalty.
+	feeDenominator = 10000
+)
+
+type Royalty struct {
+	TokenId      string `json:"tokenId,omitempty"`
+	Receiver     string `json:"receiver"`
+	FeeNumerator string `json:"feeNumerator"`
+	TxHash       string `json:"txHash"`
+	BlockNumber  uint64 `json:"blockNumber"`
+}
+
+// after reports whether r was set in a later block than blockNumber, calls
+// of the same block are replayed in order so the last one wins.
+func (r Royalty) after(blockNumber uint64) bool {
+	return r.BlockNumber > blockNumber
+}
+
+type RoyaltyTable struct {
+	Default *Royalty  `json:"default"`
+	Tokens  []Royalty `json:"tokens"`
+}
+
+type RoyaltyInfo struct {
+	TokenId   string `json:"tokenId"`
+	SalePrice string `json:"salePrice"`
+	Receiver  string `json:"receiver"`
+	Amount    string `json:"amount"`
+}
+
+type royaltyService struct {
+	TokenId   string `json:"tokenId" binding:"required"`
+	SalePrice string `json:"salePrice" binding:"required"`
+}
+
+type defaultRoyaltyService struct {
+	Receiver     string `json:"receiver" binding:"required"`
+	FeeNumerator int64  `json:"feeNumerator"`
+}
+
+type tokenRoyaltyService struct {
+	TokenId      string `json:"tokenId" binding:"required"`
+	Receiver     string `json:"receiver" binding:"required"`
+	FeeNumerator int64  `json:"feeNumerator"`
+}
+
+// royaltyCall is a bscscan txlist row of the game nft.
+type royaltyCall struct {
+	Hash        string `json:"hash"`
+	BlockNumber string `json:"blockNumber"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Input       string `json:"input"`
+	IsError     string `json:"isError"`
+}
+
+type royaltyCallRes struct {
+	Status  string        `json:"status"`
+	Message string        `json:"message"`
+	Result  []royaltyCall `json:"result"`
+}
+
+// RoyaltyIndex keeps the royalties set on the game nft. ERC2981 emits no
+// event, so the table is built from the successful setter calls, the ones
+// before the server started are read back from bscscan.
+type RoyaltyIndex struct {
+	ec    *ethclient.Client
+	rpc   *rpc.Client
+	rc    *redis.Client
+	calls *CallWatcher
+}
+
+func newRoyaltyIndex(ec *ethclient.Client, rpcClient *rpc.Client, rc *redis.Client, calls *CallWatcher) *RoyaltyIndex {
+	ri := &RoyaltyIndex{
+		ec:    ec,
+		rpc:   rpcClient,
+		rc:    rc,
+		calls: calls,
+	}
+	nftAbi, err := contract.GameNftMetaData.GetAbi()
+	if err != nil {
+		log.Error("parse gameNft abi err : ", err)
+		return ri
+	}
+	calls.watch(config.Cfg.Contract.GameNftAddress, *nftAbi, "setDefaultRoyalty", func(call *DecodedCall) {
+		ri.save(defaultRoyaltyField, Royalty{
+			Receiver:     call.Address("receiver").Hex(),
+			FeeNumerator: call.BigInt("feeNumerator").String(),
+			TxHash:       call.TxHash,
+			BlockNumber:  call.BlockNumber,
+		})
+	})
+	calls.watch(config.Cfg.Contract.GameNftAddress, *nftAbi, "setTokenRoyalty", func(call *DecodedCall) {
+		tokenId := call.BigInt("tokenId").String()
+		ri.save(tokenId, Royalty{
+			TokenId:      tokenId,
+			Receiver:     call.Address("receiver").Hex(),
+			FeeNumerator: call.BigInt("feeNumerator").String(),
+			TxHash:       call.TxHash,
+			BlockNumber:  call.BlockNumber,
+		})
+	})
+	return ri
+}
+
+// save keeps the latest setter call of a field, the backfill and the
+// listener may overlap.
+func (ri *RoyaltyIndex) save(field string, royalty Royalty) {
+	if entry, err := ri.rc.HGet(nftRoyaltyKey, field).Result(); err == nil {
+		var saved Royalty
+		if json.Unmarshal([]byte(entry), &saved) == nil && saved.after(royalty.BlockNumber) {
+			return
+		}
+	}
+	val, err := json.Marshal(royalty)
+	if err != nil {
+		log.Error("json marshal err : ", err)
+		return
+	}
+	ri.rc.HSet(nftRoyaltyKey, field, string(val))
+}
+
+// backfill replays the setter calls to the game nft from the deploy block,
+// or from where an interrupted backfill stopped, up to the finalized block.
+func (ri *RoyaltyIndex) backfill() {
+	head, err := ri.ec.BlockNumber(context.Background())
+	for err != nil {
+		log.Error("query now blockNum err : ", err)
+		time.Sleep(time.Second)
+		head, err = ri.ec.BlockNumber(context.Background())
+	}
+	to := queryFinalizedHeight(ri.rpc, new(big.Int).SetUint64(head)).Uint64()
+	from := config.Cfg.Contract.GameNftDeployBlock
+	if cursor, err := ri.rc.Get(nftRoyaltyBackfillKey).Uint64(); err == nil {
+		from = cursor + 1
+	}
+	for from <= to {
+		calls, err := queryRoyaltyCalls(from, to)
+		if err != nil {
+			log.Errorf("nft royalty backfill err : %+v, from : %d", err, from)
+			time.Sleep(time.Second)
+			continue
+		}
+		end := to
+		if len(calls) == royaltyBackfillPage {
+			// the rows of the last block may go on in the next page
+			end, _ = strconv.ParseUint(calls[len(calls)-1].BlockNumber, 10, 64)
+			if end > from {
+				end--
+			}
+		}
+		for _, call := range calls {
+			blockNumber, _ := strconv.ParseUint(call.BlockNumber, 10, 64)
+			if call.IsError != "0" || blockNumber > end {
+				continue
+			}
+			data, err := hexutil.Decode(call.Input)
+			if err != nil {
+				continue
+			}
+			ri.calls.replay(common.HexToAddress(call.To), common.HexToAddress(call.From).Hex(), common.HexToHash(call.Hash), blockNumber, data)
+		}
+		ri.rc.Set(nftRoyaltyBackfillKey, strconv.FormatUint(end, 10), 0)
+		from = end + 1
+	}
+	log.Infof("nft royalty backfill done, blockNum : %d", to)
+}
+
+func queryRoyaltyCalls(from, to uint64) ([]royaltyCall, error) {
+	url := fmt.Sprintf("%s?module=account&action=txlist&address=%s&startblock=%d&endblock=%d&offset=%d&page=1&sort=asc&apikey=%s", config.Cfg.BscScan.UrlPrefix, config.Cfg.Contract.GameNftAddress, from, to, royaltyBackfillPage, config.Cfg.BscScan.ApiKey)
+	resp, err := resty.New().R().
+		SetHeader("Accept", "application/json").
+		Get(url)
+	if err != nil {
+		return nil, err
+	}
+	var res royaltyCallRes
+	if err := json.Unmarshal(resp.Body(), &res); err != nil {
+		return nil, xerrors.New(BscScanRateLimit)
+	}
+	return res.Result, nil
+}
+
+func (ri *RoyaltyIndex) table() (RoyaltyTable, error) {
+	entries, err := ri.rc.HGetAll(nftRoyaltyKey).Result()
+	if err != nil {
+		return RoyaltyTable{Tokens: make([]Royalty, 0)}, err
+	}
+	return royaltyTable(entries), nil
+}
+
+// royaltyTable splits the stored entries into the default royalty and the
+// per token ones, unreadable entries are skipped.
+func royaltyTable(entries map[string]string) RoyaltyTable {
+	table := RoyaltyTable{Tokens: make([]Royalty, 0)}
+	for field, entry := range entries {
+		var royalty Royalty
+		if err := json.Unmarshal([]byte(entry), &royalty); err != nil {
+			continue
+		}
+		if field == defaultRoyaltyField {
+			table.Default = &royalty
+			continue
+		}
+		table.Tokens = append(table.Tokens, royalty)
+	}
+	return table
+}
+
+func (bl *BscListener) QueryNftRoyalty(c *gin.Context) {
+	var service royaltyService
+	if err := c.ShouldBind(&service); err == nil {
+		tokenId, ok := new(big.Int).SetString(service.TokenId, 10)
+		salePrice, ok2 := new(big.Int).SetString(service.SalePrice, 10)
+		if !ok || !ok2 || salePrice.Sign() < 0 {
+			c.JSON(500, serializer.Response{
+				Code: 500,
+				Msg:  ErrorParam.Error(),
+			})
+			return
+		}
+		res := bl.queryNftRoyalty(tokenId, salePrice)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) queryNftRoyalty(tokenId, salePrice *big.Int) serializer.Response {
+	aunft, err := contract.NewGameNft(common.HexToAddress(config.Cfg.Contract.GameNftAddress), bl.ec)
+	if err != nil {
+		log.Error("new auNft err : ", err)
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	receiver, amount, err := aunft.RoyaltyInfo(nil, tokenId, salePrice)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: RoyaltyInfo{
+			TokenId:   tokenId.String(),
+			SalePrice: salePrice.String(),
+			Receiver:  receiver.Hex(),
+			Amount:    amount.String(),
+		},
+	}
+}
+
+func (bl *BscListener) QueryNftRoyalties(c *gin.Context) {
+	table, err := bl.royalty.table()
+	if err != nil {
+		c.JSON(200, serializer.Response{
+			Code: 500,
+			Msg:  err.Error(),
+		})
+		return
+	}
+	c.JSON(200, serializer.Response{
+		Code: 200,
+		Data: table,
+	})
+}
+
+func (bl *BscListener) SetDefaultRoyalty(c *gin.Context) {
+	var service defaultRoyaltyService
+	if err := c.ShouldBind(&service); err == nil && validRoyalty(service.Receiver, service.FeeNumerator) {
+		res := bl.sendNftTx(func(aunft *contract.GameNft, opts *bind.TransactOpts) (*types.Transaction, error) {
+			return aunft.SetDefaultRoyalty(opts, common.HexToAddress(service.Receiver), big.NewInt(service.FeeNumerator))
+		})
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) SetTokenRoyalty(c *gin.Context) {
+	var service tokenRoyaltyService
+	if err := c.ShouldBind(&service); err == nil && validRoyalty(service.Receiver, service.FeeNumerator) {
+		tokenId, ok := new(big.Int).SetString(service.TokenId, 10)
+		if !ok {
+			c.JSON(500, serializer.Response{
+				Code: 500,
+				Msg:  ErrorParam.Error(),
+			})
+			return
+		}
+		res := bl.sendNftTx(func(aunft *contract.GameNft, opts *bind.TransactOpts) (*types.Transaction, error) {
+			return aunft.SetTokenRoyalty(opts, tokenId, common.HexToAddress(service.Receiver), big.NewInt(service.FeeNumerator))
+		})
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func validRoyalty(receiver string, feeNumerator int64) bool {
+	return common.IsHexAddress(receiver) && receiver != emptyAddress && feeNumerator >= 0 && feeNumerator <= feeDenominator
+}
+
+// sendNftTx sends a game nft transaction with the configured signer and
+// returns its hash, the royalty table follows once the block is finalized.
+func (bl *BscListener) sendNftTx(send func(aunft *contract.GameNft, opts *bind.TransactOpts) (*types.Transaction, error)) serializer.Response {
+	aunft, err := contract.NewGameNft(common.HexToAddress(config.Cfg.Contract.GameNftAddress), bl.ec)
+	if err != nil {
+		log.Error("new auNft err : ", err)
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	tx, err := bl.signer.Transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return send(aunft, opts)
+	})
+	if err != nil {
+		log.Error("send nft tx err : ", err)
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: tx.Hash().Hex(),
+	}
+}
@@ -0,0 +1,96 @@
+package chain
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+
+	"spike-blockchain-server/chain/contract"
+)
+
+func TestRoyaltyTable(t *testing.T) {
+	entry := func(r Royalty) string {
+		b, err := json.Marshal(r)
+		assert.NoError(t, err)
+		return string(b)
+	}
+	def := Royalty{Receiver: "0x1111111111111111111111111111111111111111", FeeNumerator: "250", BlockNumber: 10}
+	token := Royalty{TokenId: "7", Receiver: "0x2222222222222222222222222222222222222222", FeeNumerator: "500", BlockNumber: 12}
+
+	table := royaltyTable(map[string]string{
+		defaultRoyaltyField: entry(def),
+		"7":                 entry(token),
+		"8":                 "{",
+	})
+	assert.Equal(t, &def, table.Default)
+	assert.Equal(t, []Royalty{token}, table.Tokens)
+
+	table = royaltyTable(map[string]string{})
+	assert.Nil(t, table.Default)
+	assert.NotNil(t, table.Tokens)
+	assert.Empty(t, table.Tokens)
+
+	// a backfilled call never overwrites a later live one
+	for _, tc := range []struct {
+		saved, call uint64
+		after       bool
+	}{
+		{12, 10, true},
+		{12, 12, false},
+		{12, 13, false},
+	} {
+		assert.Equal(t, tc.after, Royalty{BlockNumber: tc.saved}.after(tc.call))
+	}
+}
+
+func TestCallWatcherDecode(t *testing.T) {
+	nftAbi, err := contract.GameNftMetaData.GetAbi()
+	assert.NoError(t, err)
+	nftAddr := common.HexToAddress("0x4444444444444444444444444444444444444444")
+	receiver := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	txHash := common.HexToHash("0x01")
+
+	cw := newCallWatcher(nil, nil)
+	var handled []*DecodedCall
+	cw.watch(nftAddr.Hex(), *nftAbi, "setTokenRoyalty", func(call *DecodedCall) {
+		handled = append(handled, call)
+	})
+
+	setTokenRoyalty, err := nftAbi.Pack("setTokenRoyalty", big.NewInt(7), receiver, big.NewInt(500))
+	assert.NoError(t, err)
+	setDefaultRoyalty, err := nftAbi.Pack("setDefaultRoyalty", receiver, big.NewInt(250))
+	assert.NoError(t, err)
+
+	call, mapping, ok := cw.decode(nftAddr, "0xfrom", txHash, 12, setTokenRoyalty)
+	assert.True(t, ok)
+	assert.Equal(t, "setTokenRoyalty", call.Method)
+	assert.Equal(t, nftAddr.Hex(), call.Contract)
+	assert.Equal(t, txHash.Hex(), call.TxHash)
+	assert.Equal(t, uint64(12), call.BlockNumber)
+	assert.Equal(t, "7", call.BigInt("tokenId").String())
+	assert.Equal(t, receiver, call.Address("receiver"))
+	assert.Equal(t, "500", call.BigInt("feeNumerator").String())
+	mapping(call)
+	assert.Len(t, handled, 1)
+
+	for name, data := range map[string][]byte{
+		"unwatched method": setDefaultRoyalty,
+		"short":            setTokenRoyalty[:3],
+		"truncated args":   setTokenRoyalty[:40],
+		"unknown selector": append([]byte{0xde, 0xad, 0xbe, 0xef}, setTokenRoyalty[4:]...),
+	} {
+		_, _, ok := cw.decode(nftAddr, "0xfrom", txHash, 12, data)
+		assert.False(t, ok, name)
+	}
+	_, _, ok = cw.decode(receiver, "0xfrom", txHash, 12, setTokenRoyalty)
+	assert.False(t, ok, "unwatched contract")
+
+	// replay runs the mapping of a decodable call only
+	cw.replay(nftAddr, "0xfrom", txHash, 13, setTokenRoyalty)
+	cw.replay(nftAddr, "0xfrom", txHash, 13, setDefaultRoyalty)
+	assert.Len(t, handled, 2)
+	assert.Equal(t, uint64(13), handled[1].BlockNumber)
+}
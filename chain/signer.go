@@ -0,0 +1,66 @@
+package chain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+var ErrorNoSigner = errors.New("signer is not configured")
+
+// Signer sends transactions with the configured key. Transactions are sent
+// one at a time so that concurrent callers never reuse a nonce.
+type Signer struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+	chainId *big.Int
+	ec      *ethclient.Client
+	lk      sync.Mutex
+}
+
+func newSigner(hexKey string, chainId *big.Int, ec *ethclient.Client) (*Signer, error) {
+	if hexKey == "" {
+		return nil, ErrorNoSigner
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{
+		key:     key,
+		address: crypto.PubkeyToAddress(key.PublicKey),
+		chainId: chainId,
+		ec:      ec,
+	}, nil
+}
+
+func (s *Signer) Address() common.Address {
+	return s.address
+}
+
+// Transact runs send with transact options holding the next pending nonce.
+func (s *Signer) Transact(send func(opts *bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	if s == nil {
+		return nil, ErrorNoSigner
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	nonce, err := s.ec.PendingNonceAt(context.Background(), s.address)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := bind.NewKeyedTransactorWithChainID(s.key, s.chainId)
+	if err != nil {
+		return nil, err
+	}
+	opts.Nonce = new(big.Int).SetUint64(nonce)
+	return send(opts)
+}
@@ -0,0 +1,389 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"io"
+	"math/big"
+	"sort"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotPrefix = "snapshot_"
+	// snapshotDuration only applies to running and failed snapshots, the
+	// proofs of a completed one are kept for as long as the airdrop lasts.
+	snapshotDuration = 7 * 24 * time.Hour
+	snapshotStep     = 5000
+	deadAddress      = "0x000000000000000000000000000000000000dEaD"
+)
+
+const (
+	snapshotRunning   = "running"
+	snapshotCompleted = "completed"
+	snapshotFailed    = "failed"
+)
+
+type SnapshotRequest struct {
+	// Token is skk, sks or nft.
+	Token       string   `json:"token" binding:"required"`
+	BlockNumber uint64   `json:"blockNumber" binding:"required"`
+	Exclude     []string `json:"exclude"`
+}
+
+type SnapshotEntry struct {
+	Index   uint64   `json:"index"`
+	Address string   `json:"address"`
+	Balance string   `json:"balance"`
+	Amount  string   `json:"amount"`
+	Proof   []string `json:"proof"`
+}
+
+type Snapshot struct {
+	Id          string          `json:"id"`
+	Token       string          `json:"token"`
+	BlockNumber uint64          `json:"blockNumber"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	Holders     int             `json:"holders"`
+	Total       string          `json:"total"`
+	MerkleRoot  string          `json:"merkleRoot"`
+	Entries     []SnapshotEntry `json:"entries"`
+	CreateTime  int64           `json:"createTime"`
+	UpdateTime  int64           `json:"updateTime"`
+}
+
+type snapshotQueryService struct {
+	Id string `form:"id" json:"id" binding:"required"`
+	// Format is json or csv.
+	Format string `form:"format" json:"format"`
+}
+
+type snapshotToken struct {
+	tp          TokenType
+	address     string
+	deployBlock uint64
+}
+
+func snapshotTokenOf(token string) (snapshotToken, error) {
+	switch strings.ToLower(token) {
+	case "skk":
+		return snapshotToken{governanceToken, config.Cfg.Contract.GovernanceTokenAddress, config.Cfg.Contract.GovernanceTokenDeployBlock}, nil
+	case "sks":
+		return snapshotToken{gameToken, config.Cfg.Contract.GameTokenAddress, config.Cfg.Contract.GameTokenDeployBlock}, nil
+	case "nft":
+		return snapshotToken{gameNft, config.Cfg.Contract.GameNftAddress, config.Cfg.Contract.GameNftDeployBlock}, nil
+	default:
+		return snapshotToken{}, fmt.Errorf("token %s is not supported", token)
+	}
+}
+
+// holderTable replays Transfer logs into balances, nft transfers carry the
+// tokenId as a fourth topic and move a balance of one.
+type holderTable map[common.Address]*big.Int
+
+func (ht holderTable) apply(l types.Log) {
+	if l.Removed || len(l.Topics) < 3 {
+		return
+	}
+	value := big.NewInt(1)
+	if len(l.Topics) == 3 {
+		value = new(big.Int).SetBytes(l.Data)
+	}
+	from := common.BytesToAddress(l.Topics[1].Bytes())
+	to := common.BytesToAddress(l.Topics[2].Bytes())
+	ht.add(from, new(big.Int).Neg(value))
+	ht.add(to, value)
+}
+
+func (ht holderTable) add(addr common.Address, value *big.Int) {
+	if _, ok := ht[addr]; !ok {
+		ht[addr] = new(big.Int)
+	}
+	ht[addr].Add(ht[addr], value)
+}
+
+// entries drops excluded and empty holders, orders the rest by balance and
+// fills in the merkle proofs.
+func (ht holderTable) entries(exclude map[common.Address]struct{}) ([]SnapshotEntry, []*big.Int, common.Hash) {
+	holders := make([]common.Address, 0, len(ht))
+	for addr, balance := range ht {
+		if _, ok := exclude[addr]; ok || balance.Sign() <= 0 {
+			continue
+		}
+		holders = append(holders, addr)
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		if c := ht[holders[i]].Cmp(ht[holders[j]]); c != 0 {
+			return c > 0
+		}
+		return bytes.Compare(holders[i].Bytes(), holders[j].Bytes()) < 0
+	})
+	leaves := make([]common.Hash, 0, len(holders))
+	balances := make([]*big.Int, 0, len(holders))
+	for i, addr := range holders {
+		leaves = append(leaves, airdropLeaf(uint64(i), addr, ht[addr]))
+		balances = append(balances, ht[addr])
+	}
+	tree := newMerkleTree(leaves)
+	entries := make([]SnapshotEntry, 0, len(holders))
+	for i, addr := range holders {
+		proof := tree.Proof(i)
+		entry := SnapshotEntry{
+			Index:   uint64(i),
+			Address: addr.Hex(),
+			Balance: ht[addr].String(),
+			Proof:   make([]string, 0, len(proof)),
+		}
+		for _, p := range proof {
+			entry.Proof = append(entry.Proof, p.Hex())
+		}
+		entries = append(entries, entry)
+	}
+	return entries, balances, tree.Root()
+}
+
+// Snapshotter builds holder snapshots of our tokens by replaying their
+// Transfer logs from the deploy block, both for the admin api and the cli.
+type Snapshotter struct {
+	ec     *ethclient.Client
+	rc     *redis.Client
+	tokens *TokenRegistry
+}
+
+func NewSnapshotter(ec *ethclient.Client, rc *redis.Client) *Snapshotter {
+	return newSnapshotter(ec, rc, newTokenRegistry(ec))
+}
+
+func newSnapshotter(ec *ethclient.Client, rc *redis.Client, tokens *TokenRegistry) *Snapshotter {
+	return &Snapshotter{
+		ec:     ec,
+		rc:     rc,
+		tokens: tokens,
+	}
+}
+
+func (s *Snapshotter) Take(req SnapshotRequest) (*Snapshot, error) {
+	token, err := snapshotTokenOf(req.Token)
+	if err != nil {
+		return nil, err
+	}
+	head, err := s.ec.BlockNumber(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if req.BlockNumber > head {
+		return nil, fmt.Errorf("block %d is after the chain head %d", req.BlockNumber, head)
+	}
+	ht := make(holderTable)
+	transfer := common.HexToHash(EventSignHash(TransferTopic))
+	for from := token.deployBlock; from <= req.BlockNumber; from += snapshotStep {
+		end := from + snapshotStep - 1
+		if end > req.BlockNumber {
+			end = req.BlockNumber
+		}
+		logs, err := s.ec.FilterLogs(context.Background(), ethereum.FilterQuery{
+			Addresses: []common.Address{common.HexToAddress(token.address)},
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Topics:    [][]common.Hash{{transfer}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range logs {
+			ht.apply(l)
+		}
+	}
+
+	entries, balances, root := ht.entries(snapshotExclude(req.Exclude))
+	total := new(big.Int)
+	for i, balance := range balances {
+		total.Add(total, balance)
+		entries[i].Amount = s.format(token.tp, balance)
+	}
+	now := time.Now().UnixMilli()
+	return &Snapshot{
+		Token:       strings.ToLower(req.Token),
+		BlockNumber: req.BlockNumber,
+		Status:      snapshotCompleted,
+		Holders:     len(entries),
+		Total:       total.String(),
+		MerkleRoot:  root.Hex(),
+		Entries:     entries,
+		CreateTime:  now,
+		UpdateTime:  now,
+	}, nil
+}
+
+func (s *Snapshotter) format(tp TokenType, balance *big.Int) string {
+	if tp == gameNft {
+		return balance.String()
+	}
+	formatted, _ := s.tokens.formatAmount(tp, balance)
+	return formatted
+}
+
+func snapshotExclude(extra []string) map[common.Address]struct{} {
+	exclude := map[common.Address]struct{}{
+		common.HexToAddress(emptyAddress):                         {},
+		common.HexToAddress(deadAddress):                          {},
+		common.HexToAddress(config.Cfg.Contract.GameVaultAddress): {},
+	}
+	for _, addrs := range [][]string{config.Cfg.Snapshot.Exclude, extra} {
+		for _, addr := range addrs {
+			exclude[common.HexToAddress(addr)] = struct{}{}
+		}
+	}
+	return exclude
+}
+
+// submit takes the snapshot in the background, replaying from the deploy
+// block takes far longer than a request.
+func (s *Snapshotter) submit(req SnapshotRequest) (*Snapshot, error) {
+	if _, err := snapshotTokenOf(req.Token); err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	snapshot := &Snapshot{
+		Id:          uuid.New().String(),
+		Token:       strings.ToLower(req.Token),
+		BlockNumber: req.BlockNumber,
+		Status:      snapshotRunning,
+		Entries:     make([]SnapshotEntry, 0),
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+	if err := s.save(snapshot); err != nil {
+		return nil, err
+	}
+	go func() {
+		result, err := s.Take(req)
+		if err != nil {
+			log.Errorf("take snapshot %s err : %+v", snapshot.Id, err)
+			snapshot.Status = snapshotFailed
+			snapshot.Error = err.Error()
+			snapshot.UpdateTime = time.Now().UnixMilli()
+			s.save(snapshot)
+			return
+		}
+		result.Id = snapshot.Id
+		result.CreateTime = snapshot.CreateTime
+		if err := s.save(result); err != nil {
+			log.Errorf("save snapshot %s err : %+v", snapshot.Id, err)
+		}
+	}()
+	return snapshot, nil
+}
+
+func (s *Snapshotter) save(snapshot *Snapshot) error {
+	val, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	expiration := snapshotDuration
+	if snapshot.Status == snapshotCompleted {
+		expiration = 0
+	}
+	return s.rc.Set(snapshotPrefix+snapshot.Id, string(val), expiration).Err()
+}
+
+func (s *Snapshotter) load(id string) (*Snapshot, error) {
+	val, err := s.rc.Get(snapshotPrefix + id).Result()
+	if err != nil {
+		return nil, err
+	}
+	var snapshot Snapshot
+	err = json.Unmarshal([]byte(val), &snapshot)
+	return &snapshot, err
+}
+
+// WriteCSV writes one row per holder, the proof hashes are joined by |.
+func (snapshot *Snapshot) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"index", "address", "balance", "amount", "proof"})
+	for _, entry := range snapshot.Entries {
+		cw.Write([]string{
+			strconv.FormatUint(entry.Index, 10),
+			entry.Address,
+			entry.Balance,
+			entry.Amount,
+			strings.Join(entry.Proof, "|"),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (bl *BscListener) TakeSnapshot(c *gin.Context) {
+	var service SnapshotRequest
+	if err := c.ShouldBind(&service); err == nil {
+		snapshot, err := bl.snapshots.submit(service)
+		if err != nil {
+			c.JSON(200, serializer.Response{
+				Code:  500,
+				Error: err.Error(),
+			})
+			return
+		}
+		c.JSON(200, serializer.Response{
+			Code: 200,
+			Data: snapshot,
+		})
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) QuerySnapshot(c *gin.Context) {
+	var service snapshotQueryService
+	if err := c.ShouldBind(&service); err == nil {
+		snapshot, err := bl.snapshots.load(service.Id)
+		if err != nil {
+			c.JSON(200, serializer.Response{
+				Code:  500,
+				Error: err.Error(),
+			})
+			return
+		}
+		if service.Format == "csv" && snapshot.Status == snapshotCompleted {
+			var buf bytes.Buffer
+			if err := snapshot.WriteCSV(&buf); err != nil {
+				c.JSON(200, serializer.Response{
+					Code:  500,
+					Error: err.Error(),
+				})
+				return
+			}
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=snapshot_%s_%d.csv", snapshot.Token, snapshot.BlockNumber))
+			c.Data(200, "text/csv", buf.Bytes())
+			return
+		}
+		c.JSON(200, serializer.Response{
+			Code: 200,
+			Data: snapshot,
+		})
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
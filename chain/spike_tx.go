@@ -13,6 +13,12 @@ type ERC20Tx struct {
 	Status  uint64 `json:"status"`
 	PayTime int64  `json:"payTime"`
 	Amount  string `json:"amount"`
+	// FormattedAmount is Amount in whole token units.
+	FormattedAmount string `json:"formattedAmount"`
+	Decimals        uint8  `json:"decimals"`
+	Stage           string `json:"stage"`
+	// Blacklisted is set on usdc transfers from or to a blacklisted address.
+	Blacklisted bool `json:"blacklisted,omitempty"`
 }
 
 type ERC721Tx struct {
@@ -23,20 +29,29 @@ type ERC721Tx struct {
 	Status  uint64 `json:"status"`
 	PayTime int64  `json:"payTime"`
 	TokenId uint64 `json:"tokenId"`
+	Stage   string `json:"stage"`
 }
 
 type SpikeTxMgr struct {
-	erc20Notify  chan ERC20Tx
-	erc721Notify chan ERC721Tx
-	close        chan struct{}
-	mqApi        game.MqApi
+	erc20Notify   chan ERC20Tx
+	erc721Notify  chan ERC721Tx
+	pendingNotify chan PendingTx
+	decodedNotify chan DecodedEvent
+	mintNotify    chan MintJob
+	trackNotify   chan TrackedTx
+	close         chan struct{}
+	mqApi         game.MqApi
 }
 
-func newSpikeTxMgr(client *game.KafkaClient, erc20Notify chan ERC20Tx, erc721Notify chan ERC721Tx) *SpikeTxMgr {
+func newSpikeTxMgr(client *game.KafkaClient, erc20Notify chan ERC20Tx, erc721Notify chan ERC721Tx, pendingNotify chan PendingTx, decodedNotify chan DecodedEvent, mintNotify chan MintJob, trackNotify chan TrackedTx) *SpikeTxMgr {
 	s := &SpikeTxMgr{
-		erc20Notify:  erc20Notify,
-		erc721Notify: erc721Notify,
-		mqApi:        client,
+		erc20Notify:   erc20Notify,
+		erc721Notify:  erc721Notify,
+		pendingNotify: pendingNotify,
+		decodedNotify: decodedNotify,
+		mintNotify:    mintNotify,
+		trackNotify:   trackNotify,
+		mqApi:         client,
 	}
 
 	return s
@@ -58,6 +73,7 @@ func (s *SpikeTxMgr) run() {
 			} else {
 				topic = game.ERC20TXTOPIC
 			}
+			topic = stageTopic(erc20Tx.Stage, topic)
 			err = s.mqApi.SendMessage(game.Msg{
 				Topic: topic,
 				Key:   erc20Tx.TxHash,
@@ -79,6 +95,7 @@ func (s *SpikeTxMgr) run() {
 			} else {
 				topic = game.ERC721TXTOPIC
 			}
+			topic = stageTopic(erc721Tx.Stage, topic)
 			err = s.mqApi.SendMessage(game.Msg{
 				Topic: topic,
 				Key:   erc721Tx.TxHash,
@@ -87,6 +104,62 @@ func (s *SpikeTxMgr) run() {
 			if err != nil {
 				log.Error("erc721 tx produce err : ", err)
 			}
+		case pendingTx := <-s.pendingNotify:
+			txByte, err := json.Marshal(pendingTx)
+			if err != nil {
+				log.Error(err)
+				break
+			}
+			err = s.mqApi.SendMessage(game.Msg{
+				Topic: game.PENDINGDEPOSITTOPIC,
+				Key:   pendingTx.TxHash,
+				Value: string(txByte),
+			})
+			if err != nil {
+				log.Error("pending tx produce err : ", err)
+			}
+		case decoded := <-s.decodedNotify:
+			txByte, err := json.Marshal(decoded)
+			if err != nil {
+				log.Error(err)
+				break
+			}
+			err = s.mqApi.SendMessage(game.Msg{
+				Topic: decoded.topic,
+				Key:   decoded.TxHash,
+				Value: string(txByte),
+			})
+			if err != nil {
+				log.Errorf("%s event produce err : %+v", decoded.Event, err)
+			}
+		case job := <-s.mintNotify:
+			jobByte, err := json.Marshal(job)
+			if err != nil {
+				log.Error(err)
+				break
+			}
+			err = s.mqApi.SendMessage(game.Msg{
+				Topic: game.NFTMINTTOPIC,
+				Key:   job.Id,
+				Value: string(jobByte),
+			})
+			if err != nil {
+				log.Error("mint job produce err : ", err)
+			}
+		case tracked := <-s.trackNotify:
+			txByte, err := json.Marshal(tracked)
+			if err != nil {
+				log.Error(err)
+				break
+			}
+			err = s.mqApi.SendMessage(game.Msg{
+				Topic: game.TXTRACKTOPIC,
+				Key:   tracked.KafkaKey,
+				Value: string(txByte),
+			})
+			if err != nil {
+				log.Error("tracked tx produce err : ", err)
+			}
 		case <-s.close:
 			//log
 			return
@@ -0,0 +1,122 @@
+package chain
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/game"
+)
+
+// maxStageGap bounds how many blocks a listener catches up on in one
+// confirmed step, anything older is left to the finalized pass.
+const maxStageGap = 50
+
+type txStage int
+
+const (
+	stageSeen txStage = iota
+	stageConfirmed
+	stageFinalized
+)
+
+var stageNames = map[txStage]string{
+	stageSeen:      "seen",
+	stageConfirmed: "confirmed",
+	stageFinalized: "finalized",
+}
+
+func (s txStage) String() string {
+	n, ok := stageNames[s]
+	if !ok {
+		return "unknown"
+	}
+	return n
+}
+
+// stageTopic returns the kafka topic of a stage, finalized events keep the
+// original topic so that crediting still happens only once a block is final.
+func stageTopic(stage string, finalizedTopic string) string {
+	switch stage {
+	case stageSeen.String():
+		return game.TXSEENTOPIC
+	case stageConfirmed.String():
+		return game.TXCONFIRMEDTOPIC
+	default:
+		return finalizedTopic
+	}
+}
+
+// blockEvent is published on newBlockTopic. For seen and confirmed events
+// height is the chain head, for finalized events it is the finalized block.
+type blockEvent struct {
+	height *big.Int
+	stage  txStage
+}
+
+func confirmationsOf(tp TokenType) uint64 {
+	if n, ok := config.Cfg.Confirmation.Tokens[tp.String()]; ok {
+		return n
+	}
+	return defaultConfirmations()
+}
+
+func defaultConfirmations() uint64 {
+	if config.Cfg.Confirmation.Default != 0 {
+		return config.Cfg.Confirmation.Default
+	}
+	return blockConfirmHeight
+}
+
+// stageTracker turns block events into the block range a listener has to
+// filter, remembering the last confirmed height so skipped heads are not lost.
+type stageTracker struct {
+	tp            TokenType
+	lastConfirmed *big.Int
+}
+
+func newStageTracker(tp TokenType) *stageTracker {
+	return &stageTracker{tp: tp}
+}
+
+func (st *stageTracker) rangeOf(ev blockEvent) (from, to *big.Int, ok bool) {
+	if ev.stage != stageConfirmed {
+		return ev.height, ev.height, true
+	}
+	to = new(big.Int).Sub(ev.height, new(big.Int).SetUint64(confirmationsOf(st.tp)))
+	if to.Sign() < 0 {
+		return nil, nil, false
+	}
+	from = to
+	if st.lastConfirmed != nil {
+		if to.Cmp(st.lastConfirmed) <= 0 {
+			return nil, nil, false
+		}
+		gap := new(big.Int).Sub(to, st.lastConfirmed)
+		if gap.Int64() <= maxStageGap {
+			from = new(big.Int).Add(st.lastConfirmed, big.NewInt(1))
+		}
+	}
+	st.lastConfirmed = to
+	return from, to, true
+}
+
+// queryFinalizedHeight asks the node for the fast-finality finalized block and
+// falls back to head - blockConfirmHeight when the tag is not supported.
+func queryFinalizedHeight(rc *rpc.Client, head *big.Int) *big.Int {
+	fallback := new(big.Int).Sub(head, big.NewInt(blockConfirmHeight))
+	var header struct {
+		Number *hexutil.Big `json:"number"`
+	}
+	err := rc.CallContext(context.Background(), &header, "eth_getBlockByNumber", "finalized", false)
+	if err != nil || header.Number == nil {
+		log.Debugf("query finalized block err : %+v, fallback to %d", err, fallback.Int64())
+		return fallback
+	}
+	finalized := header.Number.ToInt()
+	if finalized.Cmp(head) > 0 {
+		return head
+	}
+	return finalized
+}
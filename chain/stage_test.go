@@ -0,0 +1,36 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStageTrackerConfirmedRange(t *testing.T) {
+	st := newStageTracker(gameToken)
+
+	from, to, ok := st.rangeOf(blockEvent{height: big.NewInt(100), stage: stageConfirmed})
+	assert.True(t, ok)
+	assert.Equal(t, int64(100-blockConfirmHeight), from.Int64())
+	assert.Equal(t, int64(100-blockConfirmHeight), to.Int64())
+
+	// a skipped head is caught up on the next one
+	from, to, ok = st.rangeOf(blockEvent{height: big.NewInt(103), stage: stageConfirmed})
+	assert.True(t, ok)
+	assert.Equal(t, int64(101-blockConfirmHeight), from.Int64())
+	assert.Equal(t, int64(103-blockConfirmHeight), to.Int64())
+
+	_, _, ok = st.rangeOf(blockEvent{height: big.NewInt(103), stage: stageConfirmed})
+	assert.False(t, ok)
+
+	from, to, ok = st.rangeOf(blockEvent{height: big.NewInt(90), stage: stageFinalized})
+	assert.True(t, ok)
+	assert.Equal(t, from, to)
+}
+
+func TestStageTopic(t *testing.T) {
+	assert.Equal(t, "tx_seen", stageTopic(stageSeen.String(), "recharge"))
+	assert.Equal(t, "tx_confirmed", stageTopic(stageConfirmed.String(), "recharge"))
+	assert.Equal(t, "recharge", stageTopic(stageFinalized.String(), "recharge"))
+}
@@ -0,0 +1,134 @@
+package chain
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gin-gonic/gin"
+	"math/big"
+	"spike-blockchain-server/chain/contract"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+	"strings"
+	"sync"
+)
+
+const nativeDecimals = 18
+
+type TokenInfo struct {
+	Type     string `json:"type"`
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Decimals uint8  `json:"decimals"`
+}
+
+// TokenRegistry caches decimals, symbol and name of the configured tokens,
+// they are read once at startup and again on lookup when that read failed.
+type TokenRegistry struct {
+	ec      *ethclient.Client
+	lk      sync.RWMutex
+	configs map[TokenType]string
+	tokens  map[TokenType]TokenInfo
+}
+
+func newTokenRegistry(ec *ethclient.Client) *TokenRegistry {
+	tr := &TokenRegistry{
+		ec: ec,
+		configs: map[TokenType]string{
+			governanceToken: config.Cfg.Contract.GovernanceTokenAddress,
+			gameToken:       config.Cfg.Contract.GameTokenAddress,
+			usdc:            config.Cfg.Contract.UsdcAddress,
+		},
+		tokens: map[TokenType]TokenInfo{
+			bnb: {Type: bnb.String(), Symbol: "BNB", Name: "BNB", Decimals: nativeDecimals},
+		},
+	}
+	for tp := range tr.configs {
+		if _, err := tr.load(tp); err != nil {
+			log.Errorf("load token %s err : %+v", tp.String(), err)
+		}
+	}
+	return tr
+}
+
+func (tr *TokenRegistry) load(tp TokenType) (TokenInfo, error) {
+	addr := tr.configs[tp]
+	erc20, err := contract.NewGameToken(common.HexToAddress(addr), tr.ec)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+	info := TokenInfo{Type: tp.String(), Address: addr}
+	if info.Decimals, err = erc20.Decimals(nil); err != nil {
+		return TokenInfo{}, err
+	}
+	if info.Symbol, err = erc20.Symbol(nil); err != nil {
+		return TokenInfo{}, err
+	}
+	if info.Name, err = erc20.Name(nil); err != nil {
+		return TokenInfo{}, err
+	}
+	tr.lk.Lock()
+	tr.tokens[tp] = info
+	tr.lk.Unlock()
+	log.Infof("token %s loaded : %+v", tp.String(), info)
+	return info, nil
+}
+
+func (tr *TokenRegistry) get(tp TokenType) (TokenInfo, error) {
+	tr.lk.RLock()
+	info, ok := tr.tokens[tp]
+	tr.lk.RUnlock()
+	if ok {
+		return info, nil
+	}
+	return tr.load(tp)
+}
+
+// byAddress looks a configured token up by contract address, the empty
+// address is bnb.
+func (tr *TokenRegistry) byAddress(addr string) (TokenInfo, bool) {
+	if addr == "" || addr == emptyAddress {
+		info, _ := tr.get(bnb)
+		return info, true
+	}
+	for tp, a := range tr.configs {
+		if strings.EqualFold(a, addr) {
+			info, err := tr.get(tp)
+			return info, err == nil
+		}
+	}
+	return TokenInfo{}, false
+}
+
+func (tr *TokenRegistry) list() []TokenInfo {
+	infos := make([]TokenInfo, 0, len(tr.configs)+1)
+	for _, tp := range []TokenType{governanceToken, gameToken, usdc, bnb} {
+		if info, err := tr.get(tp); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// formatAmount returns amount in whole token units.
+func (tr *TokenRegistry) formatAmount(tp TokenType, amount *big.Int) (string, uint8) {
+	decimals := tr.decimalsOf(tp)
+	return ToDecimal(amount, int(decimals)).String(), decimals
+}
+
+// decimalsOf falls back to 18 decimals when the token could not be loaded.
+func (tr *TokenRegistry) decimalsOf(tp TokenType) uint8 {
+	info, err := tr.get(tp)
+	if err != nil {
+		log.Errorf("query token %s decimals err : %+v", tp.String(), err)
+		return nativeDecimals
+	}
+	return info.Decimals
+}
+
+func (bl *BscListener) QueryTokens(c *gin.Context) {
+	c.JSON(200, serializer.Response{
+		Code: 200,
+		Data: bl.tokens.list(),
+	})
+}
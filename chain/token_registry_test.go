@@ -0,0 +1,33 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenRegistryFormat(t *testing.T) {
+	tr := &TokenRegistry{
+		configs: map[TokenType]string{usdc: "0x64544969ed7EBf5f083679233325356EbE738930"},
+		tokens: map[TokenType]TokenInfo{
+			usdc: {Type: usdc.String(), Symbol: "USDC", Decimals: 6},
+			bnb:  {Type: bnb.String(), Symbol: "BNB", Decimals: nativeDecimals},
+		},
+	}
+	formatted, decimals := tr.formatAmount(usdc, big.NewInt(1234567))
+	assert.Equal(t, "1.234567", formatted)
+	assert.Equal(t, uint8(6), decimals)
+
+	formatted, _ = tr.formatAmount(bnb, new(big.Int).Mul(big.NewInt(15), big.NewInt(1e17)))
+	assert.Equal(t, "1.5", formatted)
+
+	info, ok := tr.byAddress("0x64544969ED7EBF5F083679233325356EBE738930")
+	assert.True(t, ok)
+	assert.Equal(t, "USDC", info.Symbol)
+	info, ok = tr.byAddress(emptyAddress)
+	assert.True(t, ok)
+	assert.Equal(t, "BNB", info.Symbol)
+	_, ok = tr.byAddress("0x0000000000000000000000000000000000000001")
+	assert.False(t, ok)
+}
@@ -0,0 +1,289 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/shopspring/decimal"
+	"math/big"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+	"strings"
+	"time"
+)
+
+const (
+	buildDepositSks   = "depositSks"
+	buildTransferNft  = "transferNft"
+	buildApproveVault = "approveVault"
+	buildSetNftUser   = "setNftUser"
+)
+
+const (
+	broadcastPrefix   = "broadcast_"
+	broadcastDuration = 24 * time.Hour
+)
+
+var (
+	ErrorUnknownAction = errors.New("unknown tx action")
+	ErrorWrongChain    = errors.New("tx is signed for another chain")
+)
+
+type txBuildService struct {
+	Action string `json:"action" binding:"required"`
+	From   string `json:"from" binding:"required"`
+	// Token is the symbol approved by approveVault, sks when empty.
+	Token string `json:"token"`
+	// Amount is in whole token units, approveVault approves the max when empty.
+	Amount  string `json:"amount"`
+	To      string `json:"to"`
+	TokenId string `json:"tokenId"`
+	User    string `json:"user"`
+	Expires uint64 `json:"expires"`
+}
+
+type txBroadcastService struct {
+	RawTx string `json:"rawTx" binding:"required"`
+}
+
+// UnsignedTx is ready to be signed by the wallet of From as is.
+type UnsignedTx struct {
+	Action   string `json:"action"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Data     string `json:"data"`
+	Value    string `json:"value"`
+	Gas      uint64 `json:"gas"`
+	GasPrice string `json:"gasPrice"`
+	Nonce    uint64 `json:"nonce"`
+	ChainId  string `json:"chainId"`
+}
+
+// BroadcastTx is kept for a day after a signed tx was sent through the api.
+type BroadcastTx struct {
+	Hash     string `json:"hash"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Nonce    uint64 `json:"nonce"`
+	SentTime int64  `json:"sentTime"`
+}
+
+// TxBuilder encodes the calls of the wallet clients against the contract
+// abis, so that they only sign and never embed an abi.
+type TxBuilder struct {
+	ec      *ethclient.Client
+	rc      *redis.Client
+	tokens  *TokenRegistry
+	mempool *MempoolWatcher
+	chainId *big.Int
+	target  common.Address
+	erc20   abi.ABI
+	nft     abi.ABI
+}
+
+func newTxBuilder(ec *ethclient.Client, rc *redis.Client, tokens *TokenRegistry, mempool *MempoolWatcher, chainId *big.Int, targetWalletAddr string) *TxBuilder {
+	return &TxBuilder{
+		ec:      ec,
+		rc:      rc,
+		tokens:  tokens,
+		mempool: mempool,
+		chainId: chainId,
+		target:  common.HexToAddress(targetWalletAddr),
+		erc20:   getABI(GameTokenABI),
+		nft:     getABI(GameNftABI),
+	}
+}
+
+// call returns the contract and calldata of the action.
+func (tb *TxBuilder) call(s txBuildService) (common.Address, []byte, error) {
+	switch s.Action {
+	case buildDepositSks:
+		amount, err := tb.amount(gameToken, s.Amount)
+		if err != nil || amount.Sign() <= 0 {
+			return common.Address{}, nil, ErrorParam
+		}
+		data, err := tb.erc20.Pack("transfer", tb.target, amount)
+		return common.HexToAddress(config.Cfg.Contract.GameTokenAddress), data, err
+	case buildApproveVault:
+		tp := gameToken
+		if s.Token != "" {
+			tokens, err := parseBalanceTokens([]string{s.Token})
+			if err != nil || tokens[0].tp == bnb {
+				return common.Address{}, nil, ErrorParam
+			}
+			tp = tokens[0].tp
+		}
+		amount := math.MaxBig256
+		if s.Amount != "" {
+			var err error
+			if amount, err = tb.amount(tp, s.Amount); err != nil {
+				return common.Address{}, nil, ErrorParam
+			}
+		}
+		data, err := tb.erc20.Pack("approve", common.HexToAddress(config.Cfg.Contract.GameVaultAddress), amount)
+		return common.HexToAddress(approvalContract(tp)), data, err
+	case buildTransferNft:
+		tokenId, ok := new(big.Int).SetString(s.TokenId, 10)
+		if !ok || !common.IsHexAddress(s.To) {
+			return common.Address{}, nil, ErrorParam
+		}
+		data, err := tb.nft.Pack("safeTransferFrom", common.HexToAddress(s.From), common.HexToAddress(s.To), tokenId)
+		return common.HexToAddress(config.Cfg.Contract.GameNftAddress), data, err
+	case buildSetNftUser:
+		tokenId, ok := new(big.Int).SetString(s.TokenId, 10)
+		if !ok || !common.IsHexAddress(s.User) {
+			return common.Address{}, nil, ErrorParam
+		}
+		data, err := tb.nft.Pack("setUser", tokenId, common.HexToAddress(s.User), s.Expires)
+		return common.HexToAddress(config.Cfg.Contract.GameNftAddress), data, err
+	}
+	return common.Address{}, nil, ErrorUnknownAction
+}
+
+// amount converts whole token units to the smallest unit of tp, more
+// fraction digits than the token has are rejected.
+func (tb *TxBuilder) amount(tp TokenType, s string) (*big.Int, error) {
+	d, err := decimal.NewFromString(s)
+	if err != nil || d.IsNegative() {
+		return nil, ErrorParam
+	}
+	wei := d.Shift(int32(tb.tokens.decimalsOf(tp)))
+	if !wei.Equal(wei.Truncate(0)) {
+		return nil, ErrorParam
+	}
+	return wei.BigInt(), nil
+}
+
+func (tb *TxBuilder) build(s txBuildService) (UnsignedTx, error) {
+	to, data, err := tb.call(s)
+	if err != nil {
+		return UnsignedTx{}, err
+	}
+	from := common.HexToAddress(s.From)
+	ctx := context.Background()
+	gas, err := tb.ec.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Data: data})
+	if err != nil {
+		return UnsignedTx{}, err
+	}
+	gasPrice, err := tb.ec.SuggestGasPrice(ctx)
+	if err != nil {
+		return UnsignedTx{}, err
+	}
+	nonce, err := tb.ec.PendingNonceAt(ctx, from)
+	if err != nil {
+		return UnsignedTx{}, err
+	}
+	return UnsignedTx{
+		Action:   s.Action,
+		From:     from.Hex(),
+		To:       to.Hex(),
+		Data:     hexutil.Encode(data),
+		Value:    "0",
+		Gas:      gas,
+		GasPrice: gasPrice.String(),
+		Nonce:    nonce,
+		ChainId:  tb.chainId.String(),
+	}, nil
+}
+
+// broadcast sends a signed tx and hands it to the mempool watcher, a deposit
+// is then reported pending without waiting for the node to gossip it back.
+func (tb *TxBuilder) broadcast(rawTx string) (BroadcastTx, error) {
+	raw, err := hexutil.Decode(rawTx)
+	if err != nil {
+		return BroadcastTx{}, ErrorParam
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return BroadcastTx{}, ErrorParam
+	}
+	if tx.Protected() && tx.ChainId().Cmp(tb.chainId) != 0 {
+		return BroadcastTx{}, ErrorWrongChain
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tb.chainId), tx)
+	if err != nil {
+		return BroadcastTx{}, err
+	}
+	if err := tb.ec.SendTransaction(context.Background(), tx); err != nil {
+		return BroadcastTx{}, err
+	}
+	btx := BroadcastTx{
+		Hash:     tx.Hash().Hex(),
+		From:     from.Hex(),
+		Nonce:    tx.Nonce(),
+		SentTime: time.Now().UnixMilli(),
+	}
+	if tx.To() != nil {
+		btx.To = tx.To().Hex()
+	}
+	if b, err := json.Marshal(btx); err == nil {
+		tb.rc.Set(broadcastPrefix+strings.ToLower(btx.Hash), string(b), broadcastDuration)
+	}
+	go tb.mempool.handleTx(tx)
+	return btx, nil
+}
+
+func (bl *BscListener) BuildTx(c *gin.Context) {
+	var service txBuildService
+	if err := c.ShouldBind(&service); err == nil && common.IsHexAddress(service.From) {
+		res := bl.buildTx(service)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) buildTx(service txBuildService) serializer.Response {
+	tx, err := bl.builder.build(service)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Msg:   "build tx err ",
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: tx,
+	}
+}
+
+func (bl *BscListener) BroadcastTx(c *gin.Context) {
+	var service txBroadcastService
+	if err := c.ShouldBind(&service); err == nil {
+		res := bl.broadcastTx(service.RawTx)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) broadcastTx(rawTx string) serializer.Response {
+	btx, err := bl.builder.broadcast(rawTx)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Msg:   "broadcast tx err ",
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: btx,
+	}
+}
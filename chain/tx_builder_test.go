@@ -0,0 +1,47 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxBuilderCall(t *testing.T) {
+	target := "0x00000000000000000000000000000000000000aa"
+	tokens := &TokenRegistry{
+		tokens: map[TokenType]TokenInfo{
+			gameToken: {Type: gameToken.String(), Symbol: "SKS", Decimals: 18},
+			usdc:      {Type: usdc.String(), Symbol: "USDC", Decimals: 6},
+		},
+	}
+	tb := newTxBuilder(nil, nil, tokens, nil, big.NewInt(97), target)
+
+	_, data, err := tb.call(txBuildService{Action: buildDepositSks, Amount: "1.5"})
+	assert.NoError(t, err)
+	args, err := tb.erc20.Methods["transfer"].Inputs.Unpack(data[4:])
+	assert.NoError(t, err)
+	assert.Equal(t, common.HexToAddress(target), args[0])
+	assert.Equal(t, "1500000000000000000", args[1].(*big.Int).String())
+
+	_, data, err = tb.call(txBuildService{Action: buildApproveVault, Token: "usdc", Amount: "2"})
+	assert.NoError(t, err)
+	args, _ = tb.erc20.Methods["approve"].Inputs.Unpack(data[4:])
+	assert.Equal(t, "2000000", args[1].(*big.Int).String())
+
+	_, data, err = tb.call(txBuildService{Action: buildSetNftUser, TokenId: "7", User: target, Expires: 100})
+	assert.NoError(t, err)
+	args, _ = tb.nft.Methods["setUser"].Inputs.Unpack(data[4:])
+	assert.Equal(t, int64(7), args[0].(*big.Int).Int64())
+	assert.Equal(t, uint64(100), args[2])
+
+	_, _, err = tb.call(txBuildService{Action: buildApproveVault, Token: "usdc", Amount: "0.0000001"})
+	assert.ErrorIs(t, err, ErrorParam)
+	_, _, err = tb.call(txBuildService{Action: buildDepositSks, Amount: "-1"})
+	assert.ErrorIs(t, err, ErrorParam)
+	_, _, err = tb.call(txBuildService{Action: buildTransferNft, TokenId: "1", To: "0x01"})
+	assert.ErrorIs(t, err, ErrorParam)
+	_, _, err = tb.call(txBuildService{Action: "mint"})
+	assert.ErrorIs(t, err, ErrorUnknownAction)
+}
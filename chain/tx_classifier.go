@@ -0,0 +1,270 @@
+package chain
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"math/big"
+	"sort"
+	"spike-blockchain-server/chain/contract"
+	"spike-blockchain-server/config"
+	"strings"
+	"sync"
+)
+
+type TxAction string
+
+const (
+	actionSwap            TxAction = "swap"
+	actionAddLiquidity    TxAction = "addLiquidity"
+	actionRemoveLiquidity TxAction = "removeLiquidity"
+	actionTransfer        TxAction = "transfer"
+	actionApprove         TxAction = "approve"
+	actionVaultDeposit    TxAction = "vaultDeposit"
+	actionVaultWithdraw   TxAction = "vaultWithdraw"
+)
+
+type TokenAmount struct {
+	Token           string `json:"token"`
+	Symbol          string `json:"symbol,omitempty"`
+	Amount          string `json:"amount"`
+	FormattedAmount string `json:"formattedAmount"`
+	Decimals        uint8  `json:"decimals"`
+}
+
+// txMethod is a known calldata selector and the abi it decodes with.
+type txMethod struct {
+	action TxAction
+	method abi.Method
+}
+
+// TxClassifier labels a wallet's transactions from their calldata and the
+// logs of their own receipt, amounts are taken relative to the wallet.
+type TxClassifier struct {
+	ec       *ethclient.Client
+	tokens   *TokenRegistry
+	target   common.Address
+	vault    common.Address
+	methods  map[string]txMethod
+	vaultAbi abi.ABI
+	wbnbAbi  abi.ABI
+	lk       sync.RWMutex
+	decimals map[common.Address]uint8
+}
+
+func newTxClassifier(ec *ethclient.Client, tokens *TokenRegistry, targetWalletAddr string) *TxClassifier {
+	router := getABI(PancakeRouterABI)
+	erc20 := getABI(GameTokenABI)
+	vault := getABI(GameVaultABI)
+	methods := make(map[string]txMethod)
+	for name, m := range router.Methods {
+		switch {
+		case strings.HasPrefix(name, "swap"):
+			methods[hexutil.Encode(m.ID)] = txMethod{actionSwap, m}
+		case strings.HasPrefix(name, "addLiquidity"):
+			methods[hexutil.Encode(m.ID)] = txMethod{actionAddLiquidity, m}
+		case strings.HasPrefix(name, "removeLiquidity"):
+			methods[hexutil.Encode(m.ID)] = txMethod{actionRemoveLiquidity, m}
+		}
+	}
+	for _, name := range []string{"transfer", "transferFrom"} {
+		methods[hexutil.Encode(erc20.Methods[name].ID)] = txMethod{actionTransfer, erc20.Methods[name]}
+	}
+	methods[hexutil.Encode(erc20.Methods["approve"].ID)] = txMethod{actionApprove, erc20.Methods["approve"]}
+	for name, m := range vault.Methods {
+		if strings.HasPrefix(name, "withdraw") || strings.HasPrefix(name, "batchWithdraw") {
+			methods[hexutil.Encode(m.ID)] = txMethod{actionVaultWithdraw, m}
+		}
+	}
+	return &TxClassifier{
+		ec:       ec,
+		tokens:   tokens,
+		target:   common.HexToAddress(targetWalletAddr),
+		vault:    common.HexToAddress(config.Cfg.Contract.GameVaultAddress),
+		methods:  methods,
+		vaultAbi: vault,
+		wbnbAbi:  getABI(WBNBABI),
+		decimals: make(map[common.Address]uint8),
+	}
+}
+
+// method looks the selector of input up, ok is false for plain transfers and
+// calls this registry does not know.
+func (tc *TxClassifier) method(input string) (txMethod, bool) {
+	if len(input) < 10 {
+		return txMethod{}, false
+	}
+	m, ok := tc.methods[strings.ToLower(input[:10])]
+	return m, ok
+}
+
+// classify fills Action, In, Out and Type of r and reports whether the record
+// belongs to the native history.
+func (tc *TxClassifier) classify(owner common.Address, r *Result) bool {
+	from := common.HexToAddress(r.From)
+	to := common.HexToAddress(r.To)
+	value, _ := new(big.Int).SetString(r.Value, 10)
+	if r.Input == "0x" || r.Input == "" {
+		r.Action = actionTransfer
+		if from == owner && to == tc.target {
+			r.Action = actionVaultDeposit
+		}
+		if from == owner {
+			r.Out = tc.amounts(map[common.Address]*big.Int{emptyAddr: value})
+		} else {
+			r.In = tc.amounts(map[common.Address]*big.Int{emptyAddr: value})
+		}
+		r.Type = nativeDirection(r)
+		return true
+	}
+	m, ok := tc.method(r.Input)
+	if !ok {
+		return false
+	}
+	r.Action = m.action
+	if m.action == actionApprove {
+		return true
+	}
+	receipt, err := tc.ec.TransactionReceipt(context.Background(), common.HexToHash(r.Hash))
+	if err != nil {
+		log.Errorf("query tx receipt : %s, err : %+v", r.Hash, err)
+		return false
+	}
+	in, out := tc.flows(owner, to, receipt.Logs)
+	if from == owner && value != nil && value.Sign() > 0 {
+		out[emptyAddr] = new(big.Int).Add(amountOf(out, emptyAddr), value)
+	}
+	if m.action == actionTransfer && tc.depositsToVault(m.method, r.Input) {
+		r.Action = actionVaultDeposit
+	}
+	r.In = tc.amounts(in)
+	r.Out = tc.amounts(out)
+	r.Type = nativeDirection(r)
+	if r.Type == "Receive" && (value == nil || value.Sign() == 0) {
+		// Value has always carried the bnb received by the wallet
+		r.Value = amountOf(in, emptyAddr).String()
+	}
+	return true
+}
+
+// flows sums the ERC20 Transfer logs, the bnb the router unwraps and the
+// vault Withdraw events touching owner.
+func (tc *TxClassifier) flows(owner, callee common.Address, logs []*types.Log) (in, out map[common.Address]*big.Int) {
+	in = make(map[common.Address]*big.Int)
+	out = make(map[common.Address]*big.Int)
+	transfer := common.HexToHash(EventSignHash("Transfer(address,address,uint256)"))
+	withdrawal := tc.wbnbAbi.Events["Withdrawal"].ID
+	vaultWithdraw := tc.vaultAbi.Events["Withdraw"].ID
+	for _, l := range logs {
+		if len(l.Topics) == 0 {
+			continue
+		}
+		switch {
+		case l.Topics[0] == transfer && len(l.Topics) == 3:
+			amount := new(big.Int).SetBytes(l.Data)
+			if common.BytesToAddress(l.Topics[2].Bytes()) == owner {
+				in[l.Address] = new(big.Int).Add(amountOf(in, l.Address), amount)
+			}
+			if common.BytesToAddress(l.Topics[1].Bytes()) == owner {
+				out[l.Address] = new(big.Int).Add(amountOf(out, l.Address), amount)
+			}
+		case l.Topics[0] == withdrawal && len(l.Topics) == 2 && common.BytesToAddress(l.Topics[1].Bytes()) == callee:
+			// the router unwraps wbnb right before paying the recipient
+			in[emptyAddr] = new(big.Int).Add(amountOf(in, emptyAddr), new(big.Int).SetBytes(l.Data))
+		case l.Topics[0] == vaultWithdraw && l.Address == tc.vault:
+			values, err := tc.vaultAbi.Unpack("Withdraw", l.Data)
+			if err != nil || len(values) != 4 || values[2].(common.Address) != owner {
+				continue
+			}
+			token := values[0].(common.Address)
+			in[token] = new(big.Int).Add(amountOf(in, token), values[3].(*big.Int))
+		}
+	}
+	return in, out
+}
+
+func (tc *TxClassifier) depositsToVault(m abi.Method, input string) bool {
+	args, err := m.Inputs.Unpack(common.FromHex(input)[4:])
+	if err != nil {
+		return false
+	}
+	// transfer(to, amount) and transferFrom(from, to, amount)
+	to, ok := args[len(args)-2].(common.Address)
+	return ok && to == tc.target
+}
+
+func (tc *TxClassifier) amounts(flows map[common.Address]*big.Int) []TokenAmount {
+	res := make([]TokenAmount, 0, len(flows))
+	for token, amount := range flows {
+		if amount == nil || amount.Sign() == 0 {
+			continue
+		}
+		ta := TokenAmount{Token: token.Hex(), Amount: amount.String()}
+		if token == emptyAddr {
+			ta.Token = emptyAddress
+		}
+		if info, ok := tc.tokens.byAddress(ta.Token); ok {
+			ta.Symbol = info.Symbol
+			ta.Decimals = info.Decimals
+		} else {
+			ta.Decimals = tc.decimalsOf(token)
+		}
+		ta.FormattedAmount = ToDecimal(amount, int(ta.Decimals)).String()
+		res = append(res, ta)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Token < res[j].Token
+	})
+	return res
+}
+
+// decimalsOf reads the decimals of a token outside the registry once, 18 is
+// assumed when the read fails.
+func (tc *TxClassifier) decimalsOf(token common.Address) uint8 {
+	tc.lk.RLock()
+	d, ok := tc.decimals[token]
+	tc.lk.RUnlock()
+	if ok {
+		return d
+	}
+	d = nativeDecimals
+	erc20, err := contract.NewGameToken(token, tc.ec)
+	if err == nil {
+		if d, err = erc20.Decimals(nil); err != nil {
+			log.Errorf("query token %s decimals err : %+v", token.Hex(), err)
+			return nativeDecimals
+		}
+	}
+	tc.lk.Lock()
+	tc.decimals[token] = d
+	tc.lk.Unlock()
+	return d
+}
+
+// nativeDirection keeps the Send/Receive type of the record, by the way bnb
+// moved in it.
+func nativeDirection(r *Result) string {
+	for _, ta := range r.In {
+		if ta.Token == emptyAddress {
+			return "Receive"
+		}
+	}
+	for _, ta := range r.Out {
+		if ta.Token == emptyAddress {
+			return "Send"
+		}
+	}
+	return r.Type
+}
+
+func amountOf(flows map[common.Address]*big.Int, token common.Address) *big.Int {
+	if v, ok := flows[token]; ok {
+		return v
+	}
+	return new(big.Int)
+}
+
+var emptyAddr = common.HexToAddress(emptyAddress)
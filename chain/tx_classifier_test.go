@@ -0,0 +1,66 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxClassifierMethods(t *testing.T) {
+	target := "0x00000000000000000000000000000000000000aa"
+	tc := newTxClassifier(nil, nil, target)
+
+	m, ok := tc.method(hexutil.Encode(GetTxMethodName("swapExactTokensForETHSupportingFeeOnTransferTokens(uint256,uint256,address[],address,uint256)")) + "00")
+	assert.True(t, ok)
+	assert.Equal(t, actionSwap, m.action)
+	m, ok = tc.method(hexutil.Encode(GetTxMethodName("removeLiquidityETHWithPermit(address,uint256,uint256,uint256,address,uint256,bool,uint8,bytes32,bytes32)")))
+	assert.True(t, ok)
+	assert.Equal(t, actionRemoveLiquidity, m.action)
+	m, ok = tc.method(hexutil.Encode(GetTxMethodName("addLiquidityETH(address,uint256,uint256,uint256,address,uint256)")))
+	assert.True(t, ok)
+	assert.Equal(t, actionAddLiquidity, m.action)
+	m, ok = tc.method(hexutil.Encode(GetTxMethodName("approve(address,uint256)")))
+	assert.True(t, ok)
+	assert.Equal(t, actionApprove, m.action)
+	_, ok = tc.method("0xdeadbeef")
+	assert.False(t, ok)
+
+	m, _ = tc.method(hexutil.Encode(GetTxMethodName("transfer(address,uint256)")))
+	input, err := m.method.Inputs.Pack(common.HexToAddress(target), big.NewInt(1))
+	assert.NoError(t, err)
+	assert.True(t, tc.depositsToVault(m.method, hexutil.Encode(append(m.method.ID, input...))))
+	input, _ = m.method.Inputs.Pack(common.HexToAddress("0x01"), big.NewInt(1))
+	assert.False(t, tc.depositsToVault(m.method, hexutil.Encode(append(m.method.ID, input...))))
+}
+
+func TestTxClassifierFlows(t *testing.T) {
+	tc := newTxClassifier(nil, nil, emptyAddress)
+	owner := common.HexToAddress("0x01")
+	router := common.HexToAddress("0x10ED43C718714eb63d5aA57B78B54704E256024E")
+	pair := common.HexToAddress("0x02")
+	token := common.HexToAddress("0x03")
+	wbnb := common.HexToAddress("0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c")
+	transfer := common.HexToHash(EventSignHash("Transfer(address,address,uint256)"))
+	word := func(v int64) []byte {
+		return common.LeftPadBytes(big.NewInt(v).Bytes(), 32)
+	}
+
+	// swapExactTokensForETH: tokens go to the pair, the router unwraps wbnb
+	logs := []*types.Log{
+		{Address: token, Topics: []common.Hash{transfer, owner.Hash(), pair.Hash()}, Data: word(100)},
+		{Address: wbnb, Topics: []common.Hash{transfer, pair.Hash(), router.Hash()}, Data: word(7)},
+		{Address: wbnb, Topics: []common.Hash{tc.wbnbAbi.Events["Withdrawal"].ID, router.Hash()}, Data: word(7)},
+	}
+	in, out := tc.flows(owner, router, logs)
+	assert.Equal(t, "7", in[emptyAddr].String())
+	assert.Equal(t, "100", out[token].String())
+	assert.Len(t, in, 1)
+
+	// an unwrap for another caller in the same receipt is not the wallet's
+	in, _ = tc.flows(owner, pair, logs)
+	assert.Len(t, in, 0)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis"
@@ -14,7 +15,6 @@ import (
 	"golang.org/x/xerrors"
 	"math"
 	"math/big"
-	"sort"
 	"spike-blockchain-server/chain/contract"
 	"spike-blockchain-server/config"
 	"spike-blockchain-server/constants"
@@ -39,8 +39,10 @@ const (
 )
 
 type balanceShow struct {
-	Symbol  string `json:"symbol"`
-	Balance string `json:"balance"`
+	Symbol   string `json:"symbol"`
+	Balance  string `json:"balance"`
+	Raw      string `json:"raw"`
+	Decimals uint8  `json:"decimals"`
 }
 
 type NftType struct {
@@ -70,9 +72,24 @@ type balanceService struct {
 	Address string `json:"address" binding:"required"`
 }
 
+// walletBalanceService answers the balances at BlockNumber, or at the last
+// block before Timestamp in seconds, when one of them is set.
+type walletBalanceService struct {
+	Address     string   `json:"address" binding:"required"`
+	BlockNumber *uint64  `json:"blockNumber"`
+	Timestamp   uint64   `json:"timestamp"`
+	Tokens      []string `json:"tokens"`
+}
+
+// metadataService checks the rights of Address on the token when Verify is
+// set, Sign is then an optional personal_sign of Nonce by Address. Nonce is
+// the unix time in seconds of the signature.
 type metadataService struct {
 	TokenId string `json:"tokenId"`
 	Address string `json:"address"`
+	Verify  bool   `json:"verify"`
+	Sign    string `json:"sign"`
+	Nonce   string `json:"nonce"`
 }
 
 type tokenUriService struct {
@@ -83,11 +100,14 @@ type nftTypeService struct {
 	WalletAddress string `json:"walletAddress" binding:"required"`
 }
 
+// nftMetadataService pages with Page when it is set and answers with the
+// plain list, otherwise it pages with NftQuery.Cursor and answers an NftPage.
 type nftMetadataService struct {
 	WalletAddress string `json:"walletAddress"`
 	Type          string `json:"type"`
 	Page          int    `json:"page"`
 	PageSize      int    `json:"page_size"`
+	NftQuery
 }
 
 type Metadata struct {
@@ -169,6 +189,9 @@ func (bl *BscListener) queryTxIsPendingByHash(txHash string) serializer.Response
 func (bl *BscListener) queryTxStatusByHash(txHash string) serializer.Response {
 	receipt, err := bl.ec.TransactionReceipt(context.Background(), common.HexToHash(txHash))
 	code := 200
+	if errors.Is(err, ethereum.NotFound) || (err == nil && receipt == nil) {
+		err = ErrorTxNotFound
+	}
 	if err != nil {
 		code = 500
 		return serializer.Response{
@@ -230,7 +253,12 @@ func (bl *BscListener) QueryNftMetadata(c *gin.Context) {
 			c.JSON(500, err.Error())
 			return
 		}
-		res := bl.queryNftMetadata(int64(tokenId), service.Address)
+		var res serializer.Response
+		if service.Verify {
+			res = bl.queryVerifiedNftMetadata(big.NewInt(int64(tokenId)), service)
+		} else {
+			res = bl.queryNftMetadata(int64(tokenId), service.Address)
+		}
 		c.JSON(200, res)
 	} else {
 		c.JSON(500, err.Error())
@@ -238,72 +266,18 @@ func (bl *BscListener) QueryNftMetadata(c *gin.Context) {
 }
 
 func (bl *BscListener) queryNftMetadata(tokenId int64, address string) serializer.Response {
-	aunft, err := contract.NewGameNft(common.HexToAddress(config.Cfg.Contract.GameNftAddress), bl.ec)
-	if err != nil {
-		log.Error("new auNft err : ", err)
-		return serializer.Response{
-			Code:  500,
-			Error: err.Error(),
-		}
-	}
-	uri, err := aunft.TokenURI(nil, big.NewInt(tokenId))
-	if err != nil {
-		log.Error("query tokenUri err : ", err)
-		return serializer.Response{
-			Code:  500,
-			Error: err.Error(),
-		}
-	}
-	//owner, err := aunft.OwnerOf(nil, big.NewInt(tokenId))
-	//if err != nil {
-	//	return serializer.Response{
-	//		Code:  500,
-	//		Error: err.Error(),
-	//	}
-	//}
-	//if strings.ToLower(owner.String()) != strings.ToLower(address) {
-	//	return serializer.Response{
-	//		Code:  500,
-	//		Error: xerrors.New("tokenId, nft not match").Error(),
-	//	}
-	//}
-
-	client := resty.New()
-
-	resp, err := client.R().Get(uri)
-	log.Infof("query nft tokenId : %d, uri : %s", tokenId, uri)
-	if err != nil {
-		return serializer.Response{
-			Code:  500,
-			Error: err.Error(),
-		}
-	}
-
-	if resp.IsError() {
-		return serializer.Response{
-			Code:  500,
-			Error: resp.String(),
-		}
-	}
-	var m Metadata
-	err = json.Unmarshal(resp.Body(), &m)
-	if err != nil {
-		return serializer.Response{
-			Code:  500,
-			Error: err.Error(),
-		}
-	}
-	metadata, err := json.Marshal(m)
+	sm, err := bl.metadata.get(strconv.FormatInt(tokenId, 10))
 	if err != nil {
+		log.Errorf("query nft metadata tokenId : %d, err : %+v", tokenId, err)
 		return serializer.Response{
 			Code:  500,
 			Error: err.Error(),
 		}
 	}
-	log.Infof(string(metadata))
+	log.Infof("query nft tokenId : %d, uri : %s", tokenId, sm.Uri)
 	return serializer.Response{
 		Code: 200,
-		Data: string(metadata),
+		Data: sm.Metadata,
 	}
 }
 
@@ -315,7 +289,7 @@ func (bl *BscListener) QueryNftListByType(c *gin.Context) {
 			c.JSON(500, xerrors.New("param can not be null").Error())
 			return
 		}
-		res := bl.queryNftListByType(service.WalletAddress, bl.network, service.Type, int64(service.Page), int64(service.PageSize))
+		res := bl.queryNftListByType(service.WalletAddress, bl.network, service.Type, &service.NftQuery, int64(service.Page), int64(service.PageSize))
 		c.JSON(200, res)
 	} else {
 		c.JSON(500, serializer.Response{
@@ -325,9 +299,9 @@ func (bl *BscListener) QueryNftListByType(c *gin.Context) {
 	}
 }
 
-func (bl *BscListener) queryNftListByType(addr, network, tp string, page, pageSize int64) serializer.Response {
+func (bl *BscListener) queryNftListByType(addr, network, tp string, query *NftQuery, page, pageSize int64) serializer.Response {
 	if result := bl.GetJson(addr + tp); result == "" {
-		nftType, err := bl.queryNftFromMoralis(addr, network)
+		nftType, err := bl.queryWalletNft(addr, network)
 		if err != nil {
 			return serializer.Response{
 				Code: 500,
@@ -350,10 +324,24 @@ func (bl *BscListener) queryNftListByType(addr, network, tp string, page, pageSi
 			Msg:  err.Error(),
 		}
 	}
-	dataList := cdList.CD
-	sort.Slice(dataList, func(i, j int) bool {
-		return dataList[i].BlockNumber < dataList[j].BlockNumber
-	})
+	// a cursor, or filters without a page, ask for an NftPage, the plain list
+	// of page 1 is kept for the callers that send neither
+	if query.Cursor != "" || (page <= 0 && query.filtered()) {
+		nftPage, err := query.apply(cdList.CD, int(pageSize))
+		if err != nil {
+			return serializer.Response{
+				Code: 500,
+				Msg:  err.Error(),
+			}
+		}
+		return serializer.Response{
+			Code: 200,
+			Data: nftPage,
+		}
+	}
+	query.Cursor = ""
+	all, _ := query.apply(cdList.CD, len(cdList.CD))
+	dataList := all.Result
 	start, end := SlicePage(page, pageSize, int64(len(dataList)))
 	dataPage := dataList[start:end]
 	return serializer.Response{
@@ -382,7 +370,7 @@ func (bl *BscListener) QueryWalletAddrNft(c *gin.Context) {
 
 func (bl *BscListener) queryWalletAddrNft(addr string, network string) serializer.Response {
 	if t := bl.GetJson(addr + nftTypeSuffix); t == "" {
-		nftType, err := bl.queryNftFromMoralis(addr, network)
+		nftType, err := bl.queryWalletNft(addr, network)
 		log.Infof("queryWalletAddrNft , wallet : %s , type : %+v", addr, nftType)
 		if err != nil {
 			return serializer.Response{
@@ -411,17 +399,20 @@ func (bl *BscListener) queryWalletAddrNft(addr string, network string) serialize
 	}
 }
 
-func (bl *BscListener) queryNftFromMoralis(addr string, network string) ([]NftType, error) {
-	uuid := uuid.New()
-	bl.nlManager.QueryNftList(uuid, addr, network)
+// queryWalletNft lists the nfts of a wallet grouped by type and caches every
+// group. Ownership comes from the local index once its backfill is done.
+func (bl *BscListener) queryWalletNft(addr string, network string) ([]NftType, error) {
 	nftType := make([]NftType, 0)
-	ctx, cancel := context.WithTimeout(context.TODO(), queryNftListTimeout)
-	result, err := bl.nlManager.WaitCall(ctx, uuid)
-	cancel()
+	var nr []NftResult
+	var err error
+	if bl.owners.Ready() {
+		nr, err = bl.queryNftFromIndex(addr)
+	} else {
+		nr, err = bl.queryNftFromMoralis(addr, network)
+	}
 	if err != nil {
 		return nftType, err
 	}
-	nr := result.([]NftResult)
 	nr = bl.convertNftResult(nr)
 	dataList := parseMetadata(nr)
 	dataMap := parseCacheData(dataList)
@@ -449,6 +440,33 @@ func (bl *BscListener) queryNftFromMoralis(addr string, network string) ([]NftTy
 	return nftType, err
 }
 
+func (bl *BscListener) queryNftFromIndex(addr string) ([]NftResult, error) {
+	owned, err := bl.owners.tokensOf(addr)
+	if err != nil {
+		return nil, err
+	}
+	nr := make([]NftResult, 0, len(owned))
+	for _, o := range owned {
+		nr = append(nr, NftResult{
+			TokenId:     o.TokenId,
+			BlockNumber: strconv.FormatUint(o.BlockNumber, 10),
+		})
+	}
+	return nr, nil
+}
+
+func (bl *BscListener) queryNftFromMoralis(addr string, network string) ([]NftResult, error) {
+	uuid := uuid.New()
+	bl.nlManager.QueryNftList(uuid, addr, network)
+	ctx, cancel := context.WithTimeout(context.TODO(), queryNftListTimeout)
+	result, err := bl.nlManager.WaitCall(ctx, uuid)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	return result.([]NftResult), nil
+}
+
 func (bl *BscListener) SetJson(key string, value string, duration time.Duration) {
 	bl.rc.Set(key, value, duration)
 }
@@ -461,11 +479,6 @@ func (bl *BscListener) GetJson(key string) string {
 }
 
 func (bl *BscListener) convertNftResult(res []NftResult) []NftResult {
-	aunft, err := contract.NewGameNft(common.HexToAddress(config.Cfg.Contract.GameNftAddress), bl.ec)
-	if err != nil {
-		log.Error("new auNft err : ", err)
-		return res
-	}
 	throttle := make(chan struct{}, 20)
 	var wg sync.WaitGroup
 	for i, nftResult := range res {
@@ -478,38 +491,13 @@ func (bl *BscListener) convertNftResult(res []NftResult) []NftResult {
 			}()
 
 			if v.TokenUri == "" || v.Metadata == "" {
-				tokenId, err := strconv.Atoi(v.TokenId)
+				sm, err := bl.metadata.get(v.TokenId)
 				if err != nil {
-					log.Errorf("string %s convert int err : %v", v.TokenId, err)
+					log.Errorf("query nft metadata tokenId : %s, err : %+v", v.TokenId, err)
 					return
 				}
-				uri, err := aunft.TokenURI(nil, big.NewInt(int64(tokenId)))
-				if err != nil {
-					log.Errorf("query tokenUri tokenId : %d, err : %+v", tokenId, err)
-					return
-				}
-				client := resty.New()
-				t3 := time.Now()
-				resp, err := client.R().Get(uri)
-				if err != nil {
-					log.Errorf("req err : uri :%s", uri)
-					return
-				}
-				log.Info("query metadata took :", time.Since(t3))
-				log.Infof("query nft tokenId : %d, uri : %s", tokenId, uri)
-				var m Metadata
-				err = json.Unmarshal(resp.Body(), &m)
-				if err != nil {
-					log.Errorf("json unmarshal err : %+v, resp : %s", err, string(resp.Body()))
-					return
-				}
-				metadata, err := json.Marshal(m)
-				if err != nil {
-					log.Errorf("json marshal err : %+v, meatadata : %+v", err, m)
-					return
-				}
-				res[k].TokenUri = uri
-				res[k].Metadata = string(metadata)
+				res[k].TokenUri = sm.Uri
+				res[k].Metadata = sm.Metadata
 			}
 		}(i, nftResult)
 	}
@@ -619,10 +607,15 @@ func SlicePage(page, pageSize, nums int64) (sliceStart, sliceEnd int64) {
 }
 
 func (bl *BscListener) QueryWalletBalance(c *gin.Context) {
-	var service balanceService
+	var service walletBalanceService
 
 	if err := c.ShouldBind(&service); err == nil {
-		res := bl.queryWalletBalance(service.Address)
+		var res serializer.Response
+		if service.BlockNumber != nil || service.Timestamp != 0 {
+			res = bl.queryHistoricalBalance(service)
+		} else {
+			res = bl.queryWalletBalance(service.Address)
+		}
 		c.JSON(200, res)
 	} else {
 		c.JSON(500, serializer.Response{
@@ -633,71 +626,9 @@ func (bl *BscListener) QueryWalletBalance(c *gin.Context) {
 }
 
 func (bl *BscListener) queryWalletBalance(address string) serializer.Response {
-	balanceList := make([]balanceShow, 0)
-	addr := common.HexToAddress(address)
-	var wg sync.WaitGroup
-	wg.Add(4)
-	go func() {
-		defer wg.Done()
-		skkContract, err := contract.NewGovernanceToken(common.HexToAddress(config.Cfg.Contract.GovernanceTokenAddress), bl.ec)
-		if err != nil {
-			return
-		}
-		skkBalance, err := skkContract.BalanceOf(nil, addr)
-		if err != nil {
-			return
-		}
-		balanceList = append(balanceList, balanceShow{
-			Symbol:  "SKK",
-			Balance: parseBalance(skkBalance),
-		})
-	}()
-
-	go func() {
-		defer wg.Done()
-		sksContract, err := contract.NewGameToken(common.HexToAddress(config.Cfg.Contract.GameTokenAddress), bl.ec)
-		if err != nil {
-			return
-		}
-		sksBalance, err := sksContract.BalanceOf(nil, addr)
-		if err != nil {
-			return
-		}
-		balanceList = append(balanceList, balanceShow{
-			Symbol:  "SKS",
-			Balance: parseBalance(sksBalance),
-		})
-	}()
-
-	go func() {
-		defer wg.Done()
-		usdcContract, err := contract.NewUsdc(common.HexToAddress(config.Cfg.Contract.UsdcAddress), bl.ec)
-		if err != nil {
-			return
-		}
-		usdcBalance, err := usdcContract.BalanceOf(nil, addr)
-		if err != nil {
-			return
-		}
-		balanceList = append(balanceList, balanceShow{
-			Symbol:  "USDC",
-			Balance: parseBalance(usdcBalance),
-		})
-	}()
-
-	go func() {
-		defer wg.Done()
-		bnbBalance, err := bl.ec.BalanceAt(context.Background(), addr, nil)
-		if err != nil {
-			return
-		}
-		balanceList = append(balanceList, balanceShow{
-			Symbol:  "BNB",
-			Balance: parseBalance(bnbBalance),
-		})
-	}()
-	wg.Wait()
-	if len(balanceList) != 4 {
+	balances, err := bl.balances.balances([]common.Address{common.HexToAddress(address)}, balanceTokens(), nil)
+	if err != nil {
+		log.Errorf("query wallet balance : %s, err : %+v", address, err)
 		return serializer.Response{
 			Code: 500,
 			Msg:  "chain node err ",
@@ -705,7 +636,7 @@ func (bl *BscListener) queryWalletBalance(address string) serializer.Response {
 	}
 	return serializer.Response{
 		Code: 200,
-		Data: balanceList,
+		Data: balances[0].Balances,
 	}
 }
 
@@ -750,8 +681,3 @@ func ToWei(iamount interface{}, decimals int) *big.Int {
 
 	return wei
 }
-
-func parseBalance(balance *big.Int) string {
-	decimalBalance := ToDecimal(balance, 18)
-	return decimalBalance.String()
-}
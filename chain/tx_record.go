@@ -4,19 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis"
 	"github.com/go-resty/resty/v2"
 	"github.com/google/uuid"
 	"golang.org/x/xerrors"
-	"math/big"
 	"sort"
 	"spike-blockchain-server/config"
 	"spike-blockchain-server/serializer"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 )
 
@@ -43,6 +41,14 @@ type Result struct {
 	Value       string `json:"value"`
 	Input       string `json:"input"`
 	Type        string `json:"type"`
+	// TokenDecimal is only sent by bscscan for token transfers.
+	TokenDecimal   string `json:"tokenDecimal,omitempty"`
+	FormattedValue string `json:"formattedValue"`
+	Decimals       uint8  `json:"decimals"`
+	// Action, In and Out are set by the classifier for native records.
+	Action TxAction      `json:"action,omitempty"`
+	In     []TokenAmount `json:"in,omitempty"`
+	Out    []TokenAmount `json:"out,omitempty"`
 }
 
 type BscRes struct {
@@ -189,39 +195,24 @@ func (bl *BscListener) FindNativeTransactionRecord(address string) (BscRes, erro
 		bl.rc.Set(address+nativeTxRecordSuffix, string(cacheData), txRecordDuration)
 		return bscRes, nil
 	}
-	for i, result := range bscRes.Result {
-		if bscRes.Result[i].Input == "0x" {
-			bnbRecord = append(bnbRecord, bscRes.Result[i])
-			continue
-		}
-		methodId := result.Input[0:10]
-		switch methodId {
-		case hexutil.Encode(GetTxMethodName("swapExactTokensForETHSupportingFeeOnTransferTokens(uint256,uint256,address[],address,uint256)")):
-			height, err := strconv.ParseInt(bscRes.Result[i].BlockNumber, 10, 64)
-			if err != nil {
-				break
-			}
-			query := ethereum.FilterQuery{
-				FromBlock: big.NewInt(height),
-				ToBlock:   big.NewInt(height),
-			}
-			sub, err := bl.ec.FilterLogs(context.Background(), query)
-			if err != nil {
-				break
-			}
-			for _, logEvent := range sub {
-				if logEvent.Topics[0].String() == EventSignHash(WITHRAWALTOPIC) {
-					bscRes.Result[i].Type = "Receive"
-					value := new(big.Int)
-					value.SetString(strings.Split(hexutil.Encode(logEvent.Data), "0x")[1], 16)
-
-					bscRes.Result[i].Value = value.String()
-					bnbRecord = append(bnbRecord, bscRes.Result[i])
-					break
-				}
-			}
-		case hexutil.Encode(GetTxMethodName("swapExactETHForTokens(uint256,address[],address,uint256)")):
-			bscRes.Result[i].Type = "Send"
+	owner := common.HexToAddress(address)
+	keep := make([]bool, len(bscRes.Result))
+	throttle := make(chan struct{}, 20)
+	var wg sync.WaitGroup
+	for i := range bscRes.Result {
+		wg.Add(1)
+		throttle <- struct{}{}
+		go func(k int) {
+			defer func() {
+				wg.Done()
+				<-throttle
+			}()
+			keep[k] = bl.classifier.classify(owner, &bscRes.Result[k])
+		}(i)
+	}
+	wg.Wait()
+	for i := range bscRes.Result {
+		if keep[i] {
 			bnbRecord = append(bnbRecord, bscRes.Result[i])
 		}
 	}
@@ -230,6 +221,7 @@ func (bl *BscListener) FindNativeTransactionRecord(address string) (BscRes, erro
 		time2, _ := strconv.Atoi(bnbRecord[j].TimeStamp)
 		return time1 > time2
 	})
+	formatRecords(bnbRecord, nativeDecimals)
 	bscRes.Result = bnbRecord
 	cacheData, _ := json.Marshal(bscRes)
 	bl.rc.Set(address+nativeTxRecordSuffix, string(cacheData), txRecordDuration)
@@ -254,11 +246,25 @@ func (bl *BscListener) FindFindERC20TxRecord(contractAddr, address string) (BscR
 		bl.rc.Set(address+contractAddr+erc20TxRecordSuffix, string(cacheData), txRecordDuration)
 		return bscRes, nil
 	}
+	decimals := uint8(nativeDecimals)
+	if info, ok := bl.tokens.byAddress(contractAddr); ok {
+		decimals = info.Decimals
+	} else if d, err := strconv.ParseUint(bscRes.Result[0].TokenDecimal, 10, 8); err == nil {
+		decimals = uint8(d)
+	}
+	formatRecords(bscRes.Result, decimals)
 	cacheData, _ := json.Marshal(bscRes)
 	bl.rc.Set(address+contractAddr+erc20TxRecordSuffix, string(cacheData), txRecordDuration)
 	return bscRes, nil
 }
 
+func formatRecords(records []Result, decimals uint8) {
+	for i := range records {
+		records[i].FormattedValue = ToDecimal(records[i].Value, int(decimals)).String()
+		records[i].Decimals = decimals
+	}
+}
+
 func getNativeUrl(blockNumber uint64, address string) string {
 	return fmt.Sprintf("%s?module=account&action=txlist&address=%s&startblock=%d&endblock=%d&offset=10000&page=1&sort=desc&apikey=%s", config.Cfg.BscScan.UrlPrefix, address, blockNumber-201600, blockNumber, config.Cfg.BscScan.ApiKey)
 }
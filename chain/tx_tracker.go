@@ -0,0 +1,719 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/go-resty/resty/v2"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	txTrackActiveKey    = "tx_track_active"
+	txTrackPrefix       = "tx_track_"
+	txTrackSubsPrefix   = "tx_track_subs_"
+	txTrackCallerPrefix = "tx_track_caller_"
+	txTrackCallerLimit  = 100
+	txTrackDuration     = 7 * 24 * time.Hour
+	txTrackInterval     = 3 * time.Second
+	txDropTimeout       = 10 * time.Minute
+	txReplaceScanLimit  = 500
+	webhookRetry        = 3
+	webhookTimeout      = 5 * time.Second
+)
+
+const (
+	txPending   = "pending"
+	txMined     = "mined"
+	txConfirmed = "confirmed"
+	txDropped   = "dropped"
+	txReplaced  = "replaced"
+)
+
+var (
+	ErrorTxNotFound   = errors.New("tx not found")
+	ErrorTrackLimit   = errors.New("too many txs tracked, retry once some are done")
+	ErrorCallbackHost = errors.New("callback host is not allowed")
+	ErrorCallbackIP   = errors.New("callback host does not resolve to a public address, webhooks are only posted to public addresses")
+)
+
+// TrackedTx is both the stored state of a tracked tx and the message sent to
+// a subscriber on every state change, Target, Callback and KafkaKey are then
+// the subscriber's.
+type TrackedTx struct {
+	Hash          string `json:"hash"`
+	From          string `json:"from"`
+	Nonce         uint64 `json:"nonce"`
+	State         string `json:"state"`
+	Status        uint64 `json:"status"`
+	GasUsed       uint64 `json:"gasUsed,omitempty"`
+	BlockNumber   uint64 `json:"blockNumber,omitempty"`
+	BlockHash     string `json:"blockHash,omitempty"`
+	Confirmations uint64 `json:"confirmations"`
+	Target        uint64 `json:"target"`
+	RevertReason  string `json:"revertReason,omitempty"`
+	ReplacedBy    string `json:"replacedBy,omitempty"`
+	Callback      string `json:"callback,omitempty"`
+	KafkaKey      string `json:"kafkaKey,omitempty"`
+	// SeenBlock is the head when the node last knew the tx.
+	SeenBlock  uint64 `json:"seenBlock"`
+	SeenTime   int64  `json:"seenTime"`
+	CreateTime int64  `json:"createTime"`
+	UpdateTime int64  `json:"updateTime"`
+}
+
+func (t *TrackedTx) done() bool {
+	return t.State == txConfirmed || t.State == txDropped || t.State == txReplaced
+}
+
+type txTrackService struct {
+	Hash          string `json:"hash" binding:"required"`
+	Callback      string `json:"callback"`
+	KafkaKey      string `json:"kafkaKey"`
+	Confirmations uint64 `json:"confirmations"`
+}
+
+type txTrackQueryService struct {
+	Hash string `form:"hash" json:"hash" binding:"required"`
+}
+
+// txSubscription is one registration of a tx, by its callback and kafka key.
+type txSubscription struct {
+	Callback string `json:"callback,omitempty"`
+	KafkaKey string `json:"kafkaKey,omitempty"`
+	Target   uint64 `json:"target"`
+	Caller   string `json:"caller"`
+	// State and BlockHash are what the subscriber was sent last.
+	State     string `json:"state"`
+	BlockHash string `json:"blockHash"`
+}
+
+func (s txSubscription) id() string {
+	return s.Callback + "|" + s.KafkaKey
+}
+
+// view is t as sent to s, confirmed once it has the confirmations s asked for.
+func (s txSubscription) view(t TrackedTx) TrackedTx {
+	t.Target, t.Callback, t.KafkaKey = s.Target, s.Callback, s.KafkaKey
+	if t.State == txMined && t.Confirmations >= s.Target {
+		t.State = txConfirmed
+	}
+	return t
+}
+
+// trackClient is the part of the node api the tracker reads.
+type trackClient interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+	TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// TxTracker follows registered txs from pending to mined and confirmed, or
+// until they are dropped from the pool or replaced by another tx of the same
+// nonce, and pushes every change instead of being polled for it. A tx is
+// followed once however many subscribers registered it, until the highest
+// confirmations any of them asked for.
+type TxTracker struct {
+	ec          trackClient
+	rc          *redis.Client
+	signer      types.Signer
+	client      *resty.Client
+	trackNotify chan TrackedTx
+	lk          sync.Mutex
+	// webhooks holds the undelivered messages by tx and callback, a key is
+	// present while its messages are being posted in order.
+	webhooks map[string][]TrackedTx
+	// kafka holds the messages not handed to trackNotify yet, publishing is
+	// set while they are being handed over in order.
+	kafka      []TrackedTx
+	publishing bool
+	wlk        sync.Mutex
+}
+
+func newTxTracker(ec trackClient, rc *redis.Client, chainId *big.Int, trackNotify chan TrackedTx) *TxTracker {
+	return &TxTracker{
+		ec:     ec,
+		rc:     rc,
+		signer: types.LatestSignerForChainID(chainId),
+		client: resty.New().
+			SetTimeout(webhookTimeout).
+			SetTransport(&http.Transport{DialContext: publicDialer().DialContext}).
+			SetRedirectPolicy(resty.NoRedirectPolicy()),
+		trackNotify: trackNotify,
+		webhooks:    make(map[string][]TrackedTx),
+	}
+}
+
+// publicDialer refuses to connect webhooks to loopback, private and link
+// local addresses, whatever the callback host resolves to.
+func publicDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("webhook address %s is not public", address)
+			}
+			return nil
+		},
+	}
+}
+
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// callbackIPCheck resolves the callback host when it is registered, so an
+// allowlisted host that can never be dialed is refused with a clear error.
+func callbackIPCheck(callback string) error {
+	if callback == "" {
+		return nil
+	}
+	u, err := url.Parse(callback)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return ErrorCallbackIP
+		}
+	}
+	return nil
+}
+
+func callbackAllowed(callback string) bool {
+	if callback == "" {
+		return true
+	}
+	u, err := url.Parse(callback)
+	if err != nil {
+		return false
+	}
+	for _, host := range config.Cfg.TxTrack.CallbackHosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// register subscribes caller to hash, registering the same callback and
+// kafka key again returns the current view of the tx.
+func (tt *TxTracker) register(service txTrackService, caller string) (*TrackedTx, error) {
+	if !callbackAllowed(service.Callback) {
+		return nil, ErrorCallbackHost
+	}
+	if err := callbackIPCheck(service.Callback); err != nil {
+		return nil, err
+	}
+	hash := common.HexToHash(service.Hash)
+	sub := txSubscription{
+		Callback: service.Callback,
+		KafkaKey: service.KafkaKey,
+		Target:   service.Confirmations,
+		Caller:   caller,
+	}
+	if sub.Target == 0 {
+		sub.Target = defaultConfirmations()
+	}
+	tt.lk.Lock()
+	defer tt.lk.Unlock()
+	t, err := tt.load(hash.Hex())
+	if err == nil {
+		if saved, ok := tt.subscription(t.Hash, sub.id()); ok {
+			v := saved.view(*t)
+			return &v, nil
+		}
+	}
+	callerKey := txTrackCallerPrefix + caller
+	if tt.rc.SCard(callerKey).Val() >= txTrackCallerLimit {
+		return nil, ErrorTrackLimit
+	}
+	if err != nil {
+		if t, err = tt.newTracked(hash); err != nil {
+			return nil, err
+		}
+	}
+	if sub.Target > t.Target {
+		t.Target = sub.Target
+	}
+	if err := tt.save(t); err != nil {
+		return nil, err
+	}
+	if !t.done() {
+		tt.rc.SAdd(txTrackActiveKey, t.Hash)
+		tt.rc.SAdd(callerKey, t.Hash+"|"+sub.id())
+		tt.rc.Expire(callerKey, txTrackDuration)
+	}
+	v := sub.view(*t)
+	sub.State, sub.BlockHash = v.State, v.BlockHash
+	if err := tt.saveSubscription(t.Hash, sub); err != nil {
+		return nil, err
+	}
+	tt.notify(v)
+	return &v, nil
+}
+
+func (tt *TxTracker) newTracked(hash common.Hash) (*TrackedTx, error) {
+	head, err := tt.ec.BlockNumber(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	t := &TrackedTx{
+		Hash:       hash.Hex(),
+		State:      txPending,
+		SeenBlock:  head,
+		SeenTime:   now,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	tx, _, err := tt.ec.TransactionByHash(context.Background(), hash)
+	switch {
+	case err == nil:
+		from, err := types.Sender(tt.signer, tx)
+		if err != nil {
+			return nil, err
+		}
+		t.From, t.Nonce = from.Hex(), tx.Nonce()
+	case errors.Is(err, ethereum.NotFound):
+		// the node may have dropped a tx sent through /tx/broadcast already
+		var btx BroadcastTx
+		val, err := tt.rc.Get(broadcastPrefix + strings.ToLower(t.Hash)).Result()
+		if err != nil || json.Unmarshal([]byte(val), &btx) != nil {
+			return nil, ErrorTxNotFound
+		}
+		t.From, t.Nonce = btx.From, btx.Nonce
+	default:
+		return nil, err
+	}
+	return t, nil
+}
+
+func (tt *TxTracker) subscription(hash, id string) (txSubscription, bool) {
+	var sub txSubscription
+	val, err := tt.rc.HGet(txTrackSubsPrefix+strings.ToLower(hash), id).Result()
+	if err != nil || json.Unmarshal([]byte(val), &sub) != nil {
+		return sub, false
+	}
+	return sub, true
+}
+
+func (tt *TxTracker) saveSubscription(hash string, sub txSubscription) error {
+	b, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	key := txTrackSubsPrefix + strings.ToLower(hash)
+	if err := tt.rc.HSet(key, sub.id(), string(b)).Err(); err != nil {
+		return err
+	}
+	return tt.rc.Expire(key, txTrackDuration).Err()
+}
+
+func (tt *TxTracker) save(t *TrackedTx) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return tt.rc.Set(txTrackPrefix+strings.ToLower(t.Hash), string(b), txTrackDuration).Err()
+}
+
+func (tt *TxTracker) load(hash string) (*TrackedTx, error) {
+	val, err := tt.rc.Get(txTrackPrefix + strings.ToLower(hash)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var t TrackedTx
+	if err := json.Unmarshal([]byte(val), &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (tt *TxTracker) run() {
+	ticker := time.NewTicker(txTrackInterval)
+	for range ticker.C {
+		hashes, err := tt.rc.SMembers(txTrackActiveKey).Result()
+		if err != nil {
+			log.Error("query tracked txs err : ", err)
+			continue
+		}
+		if len(hashes) == 0 {
+			continue
+		}
+		head, err := tt.ec.BlockNumber(context.Background())
+		if err != nil {
+			log.Error("query now blockNum err : ", err)
+			continue
+		}
+		for _, hash := range hashes {
+			tt.lk.Lock()
+			tt.track(hash, head)
+			tt.lk.Unlock()
+		}
+	}
+}
+
+func (tt *TxTracker) track(hash string, head uint64) {
+	t, err := tt.load(hash)
+	if err != nil {
+		tt.rc.SRem(txTrackActiveKey, hash)
+		return
+	}
+	changed, err := tt.check(t, head)
+	if err != nil {
+		log.Errorf("track tx %s err : %+v", hash, err)
+		return
+	}
+	// the confirmations of a mined tx move on without a state change
+	if changed || t.State == txMined {
+		if changed {
+			t.UpdateTime = time.Now().UnixMilli()
+		}
+		if err := tt.save(t); err != nil {
+			log.Errorf("save tracked tx %s err : %+v", hash, err)
+			return
+		}
+	}
+	tt.dispatch(t)
+}
+
+// dispatch sends every subscriber of t the view it was not sent yet and lets
+// go of t once it is done.
+func (tt *TxTracker) dispatch(t *TrackedTx) {
+	subs, err := tt.rc.HGetAll(txTrackSubsPrefix + strings.ToLower(t.Hash)).Result()
+	if err != nil {
+		log.Errorf("query tx %s subscriptions err : %+v", t.Hash, err)
+		return
+	}
+	for id, val := range subs {
+		var sub txSubscription
+		if err := json.Unmarshal([]byte(val), &sub); err != nil {
+			continue
+		}
+		v := sub.view(*t)
+		if v.State != sub.State || v.BlockHash != sub.BlockHash {
+			sub.State, sub.BlockHash = v.State, v.BlockHash
+			if err := tt.saveSubscription(t.Hash, sub); err != nil {
+				log.Errorf("save tx %s subscription err : %+v", t.Hash, err)
+				continue
+			}
+			tt.notify(v)
+		}
+		if t.done() {
+			tt.rc.SRem(txTrackCallerPrefix+sub.Caller, t.Hash+"|"+id)
+		}
+	}
+	if t.done() {
+		tt.rc.SRem(txTrackActiveKey, t.Hash)
+	}
+}
+
+// check moves t along its lifecycle at head and reports whether its state
+// changed. A mined tx whose block was reorged out goes back to pending.
+func (tt *TxTracker) check(t *TrackedTx, head uint64) (bool, error) {
+	ctx := context.Background()
+	hash := common.HexToHash(t.Hash)
+	receipt, err := tt.ec.TransactionReceipt(ctx, hash)
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		return false, err
+	}
+	if err == nil && receipt != nil {
+		t.SeenBlock, t.SeenTime = head, time.Now().UnixMilli()
+		if t.State == txMined && t.BlockHash == receipt.BlockHash.Hex() {
+			t.Confirmations = confirmationsAt(receipt.BlockNumber.Uint64(), head)
+			if t.Confirmations < t.Target {
+				return false, nil
+			}
+			t.State = txConfirmed
+			return true, nil
+		}
+		t.State = txMined
+		t.Status = receipt.Status
+		t.GasUsed = receipt.GasUsed
+		t.BlockNumber = receipt.BlockNumber.Uint64()
+		t.BlockHash = receipt.BlockHash.Hex()
+		t.Confirmations = confirmationsAt(t.BlockNumber, head)
+		if receipt.Status == types.ReceiptStatusFailed {
+			t.RevertReason = tt.revertReason(hash, receipt.BlockNumber)
+		}
+		return true, nil
+	}
+	reorged := t.State == txMined
+	if reorged {
+		t.State = txPending
+		t.BlockNumber, t.BlockHash, t.Confirmations = 0, "", 0
+		t.Status, t.GasUsed, t.RevertReason = 0, 0, ""
+	}
+	_, _, err = tt.ec.TransactionByHash(ctx, hash)
+	if err == nil {
+		t.SeenBlock, t.SeenTime = head, time.Now().UnixMilli()
+		return reorged, nil
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return reorged, err
+	}
+	nonce, err := tt.ec.NonceAt(ctx, common.HexToAddress(t.From), nil)
+	if err != nil {
+		return reorged, err
+	}
+	if nonce > t.Nonce {
+		t.State = txReplaced
+		t.ReplacedBy = tt.replacement(t, head)
+		return true, nil
+	}
+	if time.Since(time.UnixMilli(t.SeenTime)) > txDropTimeout {
+		t.State = txDropped
+		return true, nil
+	}
+	return reorged, nil
+}
+
+func confirmationsAt(blockNumber, head uint64) uint64 {
+	if head < blockNumber {
+		return 0
+	}
+	return head - blockNumber + 1
+}
+
+// replacement looks the mined tx of the same sender and nonce up in the
+// blocks since the tracked tx was last seen.
+func (tt *TxTracker) replacement(t *TrackedTx, head uint64) string {
+	from := common.HexToAddress(t.From)
+	start := t.SeenBlock
+	if head > txReplaceScanLimit && start < head-txReplaceScanLimit {
+		start = head - txReplaceScanLimit
+	}
+	for n := start; n <= head; n++ {
+		block, err := tt.ec.BlockByNumber(context.Background(), new(big.Int).SetUint64(n))
+		if err != nil {
+			log.Errorf("query block %d err : %+v", n, err)
+			return ""
+		}
+		for _, tx := range block.Transactions() {
+			if tx.Nonce() != t.Nonce {
+				continue
+			}
+			if sender, err := types.Sender(tt.signer, tx); err == nil && sender == from {
+				return tx.Hash().Hex()
+			}
+		}
+	}
+	return ""
+}
+
+// revertReason replays the failed tx on the state of the parent block and
+// decodes the Error(string) it reverted with.
+func (tt *TxTracker) revertReason(hash common.Hash, blockNumber *big.Int) string {
+	ctx := context.Background()
+	tx, _, err := tt.ec.TransactionByHash(ctx, hash)
+	if err != nil || tx.To() == nil {
+		return ""
+	}
+	from, err := types.Sender(tt.signer, tx)
+	if err != nil {
+		return ""
+	}
+	_, err = tt.ec.CallContract(ctx, ethereum.CallMsg{
+		From:     from,
+		To:       tx.To(),
+		Gas:      tx.Gas(),
+		GasPrice: tx.GasPrice(),
+		Value:    tx.Value(),
+		Data:     tx.Data(),
+	}, new(big.Int).Sub(blockNumber, big.NewInt(1)))
+	if err == nil {
+		return ""
+	}
+	return decodeRevert(err)
+}
+
+func decodeRevert(err error) string {
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if s, ok := dataErr.ErrorData().(string); ok {
+			if data, err := hexutil.Decode(s); err == nil {
+				if reason, err := abi.UnpackRevert(data); err == nil {
+					return reason
+				}
+			}
+		}
+	}
+	return err.Error()
+}
+
+// notify publishes t on kafka when it has a key and posts it to its webhook.
+// It only queues t, callers hold tt.lk and must not wait on trackNotify.
+func (tt *TxTracker) notify(t TrackedTx) {
+	if t.KafkaKey != "" {
+		tt.publish(t)
+	}
+	if t.Callback != "" {
+		tt.post(t)
+	}
+}
+
+// publish queues t for trackNotify behind the earlier kafka messages.
+func (tt *TxTracker) publish(t TrackedTx) {
+	tt.wlk.Lock()
+	defer tt.wlk.Unlock()
+	tt.kafka = append(tt.kafka, t)
+	if !tt.publishing {
+		tt.publishing = true
+		go tt.handOver()
+	}
+}
+
+func (tt *TxTracker) handOver() {
+	for {
+		tt.wlk.Lock()
+		if len(tt.kafka) == 0 {
+			tt.kafka = nil
+			tt.publishing = false
+			tt.wlk.Unlock()
+			return
+		}
+		t := tt.kafka[0]
+		tt.kafka = tt.kafka[1:]
+		tt.wlk.Unlock()
+		tt.trackNotify <- t
+	}
+}
+
+// post queues t behind the earlier messages of the same tx and callback, so
+// that a webhook never sees the states out of order.
+func (tt *TxTracker) post(t TrackedTx) {
+	key := t.Hash + "|" + t.Callback
+	tt.wlk.Lock()
+	defer tt.wlk.Unlock()
+	queue, running := tt.webhooks[key]
+	tt.webhooks[key] = append(queue, t)
+	if !running {
+		go tt.deliver(key)
+	}
+}
+
+func (tt *TxTracker) deliver(key string) {
+	for {
+		tt.wlk.Lock()
+		queue := tt.webhooks[key]
+		if len(queue) == 0 {
+			delete(tt.webhooks, key)
+			tt.wlk.Unlock()
+			return
+		}
+		t := queue[0]
+		tt.webhooks[key] = queue[1:]
+		tt.wlk.Unlock()
+		tt.send(t)
+	}
+}
+
+func (tt *TxTracker) send(t TrackedTx) {
+	for i := 0; i < webhookRetry; i++ {
+		resp, err := tt.client.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(t).
+			Post(t.Callback)
+		if err == nil && resp.IsSuccess() {
+			return
+		}
+		log.Errorf("tx track webhook %s, hash : %s, state : %s, err : %+v", t.Callback, t.Hash, t.State, err)
+		time.Sleep(time.Duration(i+1) * time.Second)
+	}
+}
+
+func (bl *BscListener) TrackTx(c *gin.Context) {
+	var service txTrackService
+	if err := c.ShouldBind(&service); err == nil && validTrackService(service) {
+		res := bl.trackTx(service, c.ClientIP())
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func validTrackService(service txTrackService) bool {
+	if len(common.FromHex(service.Hash)) != common.HashLength {
+		return false
+	}
+	if service.Callback == "" {
+		return service.KafkaKey != ""
+	}
+	u, err := url.Parse(service.Callback)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (bl *BscListener) trackTx(service txTrackService, caller string) serializer.Response {
+	t, err := bl.tracker.register(service, caller)
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Msg:   "track tx err ",
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: t,
+	}
+}
+
+func (bl *BscListener) QueryTrackedTx(c *gin.Context) {
+	var service txTrackQueryService
+	if err := c.ShouldBind(&service); err == nil {
+		t, err := bl.tracker.load(common.HexToHash(service.Hash).Hex())
+		if err != nil {
+			c.JSON(200, serializer.Response{
+				Code:  500,
+				Msg:   ErrorTxNotFound.Error(),
+				Error: err.Error(),
+			})
+			return
+		}
+		c.JSON(200, serializer.Response{
+			Code: 200,
+			Data: t,
+		})
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
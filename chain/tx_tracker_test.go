@@ -0,0 +1,270 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"spike-blockchain-server/config"
+)
+
+type revertError struct {
+	data string
+}
+
+func (e revertError) Error() string          { return "execution reverted" }
+func (e revertError) ErrorData() interface{} { return e.data }
+
+func TestDecodeRevert(t *testing.T) {
+	// Error("not owner")
+	data := "0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000009" +
+		"6e6f74206f776e65720000000000000000000000000000000000000000000000"
+	assert.Equal(t, "not owner", decodeRevert(revertError{data: data}))
+	assert.Equal(t, "execution reverted", decodeRevert(revertError{data: hexutil.Encode([]byte{1, 2, 3, 4})}))
+	assert.Equal(t, "out of gas", decodeRevert(errors.New("out of gas")))
+}
+
+func TestTxTrackLifecycle(t *testing.T) {
+	assert.Equal(t, uint64(1), confirmationsAt(100, 100))
+	assert.Equal(t, uint64(15), confirmationsAt(100, 114))
+	assert.Equal(t, uint64(0), confirmationsAt(100, 99))
+
+	for state, done := range map[string]bool{
+		txPending:   false,
+		txMined:     false,
+		txConfirmed: true,
+		txDropped:   true,
+		txReplaced:  true,
+	} {
+		assert.Equal(t, done, (&TrackedTx{State: state}).done(), state)
+	}
+
+	hash := "0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060"
+	assert.True(t, validTrackService(txTrackService{Hash: hash, KafkaKey: "match-1"}))
+	assert.True(t, validTrackService(txTrackService{Hash: hash, Callback: "https://game.example.com/tx"}))
+	assert.False(t, validTrackService(txTrackService{Hash: hash}))
+	assert.False(t, validTrackService(txTrackService{Hash: hash, Callback: "ftp://game.example.com"}))
+	assert.False(t, validTrackService(txTrackService{Hash: "0x1234", KafkaKey: "match-1"}))
+}
+
+// trackNode answers the tracker from fixed receipts, pool txs and nonces.
+type trackNode struct {
+	receipts map[common.Hash]*types.Receipt
+	pool     map[common.Hash]*types.Transaction
+	nonce    uint64
+	blocks   map[uint64]*types.Block
+}
+
+func (n *trackNode) BlockNumber(ctx context.Context) (uint64, error) {
+	return 0, nil
+}
+
+func (n *trackNode) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	if b, ok := n.blocks[number.Uint64()]; ok {
+		return b, nil
+	}
+	return types.NewBlockWithHeader(&types.Header{Number: number}), nil
+}
+
+func (n *trackNode) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	if tx, ok := n.pool[hash]; ok {
+		return tx, true, nil
+	}
+	return nil, false, ethereum.NotFound
+}
+
+func (n *trackNode) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	if r, ok := n.receipts[hash]; ok {
+		return r, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (n *trackNode) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return n.nonce, nil
+}
+
+func (n *trackNode) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func TestTxTrackCheck(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	chainId := big.NewInt(97)
+	signer := types.LatestSignerForChainID(chainId)
+	tx, _ := types.SignTx(types.NewTransaction(5, common.HexToAddress("0x01"), big.NewInt(1), 21000, big.NewInt(1), nil), signer, key)
+	replacement, _ := types.SignTx(types.NewTransaction(5, common.HexToAddress("0x01"), big.NewInt(0), 21000, big.NewInt(2), nil), signer, key)
+	blockHash := common.HexToHash("0xb1")
+	receipt := &types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: 21000, BlockNumber: big.NewInt(100), BlockHash: blockHash}
+	recent := time.Now().UnixMilli()
+	stale := time.Now().Add(-txDropTimeout - time.Minute).UnixMilli()
+
+	tests := []struct {
+		name    string
+		node    *trackNode
+		tracked TrackedTx
+		head    uint64
+		changed bool
+		state   string
+		check   func(t *testing.T, tracked TrackedTx)
+	}{
+		{
+			name:    "pending to mined",
+			node:    &trackNode{receipts: map[common.Hash]*types.Receipt{tx.Hash(): receipt}},
+			tracked: TrackedTx{State: txPending, Target: 15},
+			head:    101,
+			changed: true,
+			state:   txMined,
+			check: func(t *testing.T, tracked TrackedTx) {
+				assert.Equal(t, uint64(100), tracked.BlockNumber)
+				assert.Equal(t, blockHash.Hex(), tracked.BlockHash)
+				assert.Equal(t, uint64(2), tracked.Confirmations)
+			},
+		},
+		{
+			name:    "mined below target",
+			node:    &trackNode{receipts: map[common.Hash]*types.Receipt{tx.Hash(): receipt}},
+			tracked: TrackedTx{State: txMined, Target: 15, BlockNumber: 100, BlockHash: blockHash.Hex()},
+			head:    110,
+			changed: false,
+			state:   txMined,
+			check: func(t *testing.T, tracked TrackedTx) {
+				assert.Equal(t, uint64(11), tracked.Confirmations)
+			},
+		},
+		{
+			name:    "mined to confirmed",
+			node:    &trackNode{receipts: map[common.Hash]*types.Receipt{tx.Hash(): receipt}},
+			tracked: TrackedTx{State: txMined, Target: 15, BlockNumber: 100, BlockHash: blockHash.Hex()},
+			head:    114,
+			changed: true,
+			state:   txConfirmed,
+		},
+		{
+			name:    "reorged back to pending",
+			node:    &trackNode{pool: map[common.Hash]*types.Transaction{tx.Hash(): tx}},
+			tracked: TrackedTx{State: txMined, Target: 15, BlockNumber: 100, BlockHash: blockHash.Hex(), Confirmations: 3, Status: 1},
+			head:    103,
+			changed: true,
+			state:   txPending,
+			check: func(t *testing.T, tracked TrackedTx) {
+				assert.Equal(t, uint64(0), tracked.BlockNumber)
+				assert.Empty(t, tracked.BlockHash)
+				assert.Equal(t, uint64(103), tracked.SeenBlock)
+			},
+		},
+		{
+			name:    "still pending",
+			node:    &trackNode{pool: map[common.Hash]*types.Transaction{tx.Hash(): tx}},
+			tracked: TrackedTx{State: txPending, SeenTime: stale},
+			head:    103,
+			changed: false,
+			state:   txPending,
+		},
+		{
+			name: "replaced when the nonce moved",
+			node: &trackNode{nonce: 6, blocks: map[uint64]*types.Block{
+				102: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(102)}).WithBody([]*types.Transaction{replacement}, nil),
+			}},
+			tracked: TrackedTx{State: txPending, SeenBlock: 101, SeenTime: recent},
+			head:    103,
+			changed: true,
+			state:   txReplaced,
+			check: func(t *testing.T, tracked TrackedTx) {
+				assert.Equal(t, replacement.Hash().Hex(), tracked.ReplacedBy)
+			},
+		},
+		{
+			name:    "not dropped before the timeout",
+			node:    &trackNode{nonce: 5},
+			tracked: TrackedTx{State: txPending, SeenTime: recent},
+			head:    103,
+			changed: false,
+			state:   txPending,
+		},
+		{
+			name:    "dropped after the timeout",
+			node:    &trackNode{nonce: 5},
+			tracked: TrackedTx{State: txPending, SeenTime: stale},
+			head:    103,
+			changed: true,
+			state:   txDropped,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tt := newTxTracker(tc.node, nil, chainId, nil)
+			tracked := tc.tracked
+			tracked.Hash, tracked.From, tracked.Nonce = tx.Hash().Hex(), from.Hex(), tx.Nonce()
+			changed, err := tt.check(&tracked, tc.head)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.changed, changed)
+			assert.Equal(t, tc.state, tracked.State)
+			if tc.check != nil {
+				tc.check(t, tracked)
+			}
+		})
+	}
+}
+
+func TestTxTrackSubscriptions(t *testing.T) {
+	tracked := TrackedTx{State: txMined, Target: 15, Confirmations: 5}
+	fast := txSubscription{KafkaKey: "match-1", Target: 3}
+	slow := txSubscription{Callback: "https://game.example.com/tx", Target: 15}
+	assert.Equal(t, txConfirmed, fast.view(tracked).State)
+	assert.Equal(t, "match-1", fast.view(tracked).KafkaKey)
+	assert.Equal(t, txMined, slow.view(tracked).State)
+	assert.NotEqual(t, fast.id(), slow.id())
+
+	config.Cfg.TxTrack.CallbackHosts = []string{"game.example.com"}
+	defer func() {
+		config.Cfg.TxTrack.CallbackHosts = nil
+	}()
+	assert.True(t, callbackAllowed(""))
+	assert.True(t, callbackAllowed("https://GAME.example.com:8443/tx"))
+	assert.False(t, callbackAllowed("http://169.254.169.254/latest/meta-data"))
+
+	config.Cfg.TxTrack.CallbackHosts = []string{"game.example.com", "10.0.0.5"}
+	assert.True(t, callbackAllowed("http://10.0.0.5/tx"))
+	assert.Equal(t, ErrorCallbackIP, callbackIPCheck("http://10.0.0.5/tx"))
+	assert.NoError(t, callbackIPCheck("http://8.8.8.8/tx"))
+	assert.NoError(t, callbackIPCheck(""))
+
+	for ip, public := range map[string]bool{
+		"8.8.8.8":         true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fd00::1":         false,
+	} {
+		assert.Equal(t, public, publicIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestTxTrackPublishOrder(t *testing.T) {
+	trackNotify := make(chan TrackedTx)
+	tt := newTxTracker(nil, nil, big.NewInt(56), trackNotify)
+	// nothing reads trackNotify yet, notify must not wait for it
+	for _, state := range []string{txPending, txMined, txConfirmed} {
+		tt.notify(TrackedTx{Hash: "0x01", KafkaKey: "match-1", State: state})
+	}
+	for _, state := range []string{txPending, txMined, txConfirmed} {
+		assert.Equal(t, state, (<-trackNotify).State)
+	}
+}
@@ -0,0 +1,211 @@
+package chain
+
+import (
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"spike-blockchain-server/chain/contract"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/game"
+	"spike-blockchain-server/serializer"
+	"strings"
+	"time"
+)
+
+const (
+	usdcBlacklistKey      = "usdc_blacklist"
+	usdcBlacklistedPrefix = "usdc_blacklisted_"
+	usdcPausedKey         = "usdc_paused"
+	usdcStateDuration     = time.Minute
+)
+
+var (
+	ErrorUsdcPaused      = errors.New("usdc is paused")
+	ErrorUsdcBlacklisted = errors.New("address is blacklisted by usdc")
+)
+
+type UsdcStatus struct {
+	Paused           bool   `json:"paused"`
+	Address          string `json:"address,omitempty"`
+	Blacklisted      bool   `json:"blacklisted"`
+	BlacklistedBlock uint64 `json:"blacklistedBlock,omitempty"`
+	Withdrawable     bool   `json:"withdrawable"`
+	Reason           string `json:"reason,omitempty"`
+}
+
+type usdcStatusService struct {
+	Address string `form:"address" json:"address"`
+}
+
+// UsdcCompliance follows the blacklist and pause state of usdc. Reads go to
+// the contract and are cached for a minute, the events drop the cache and
+// the finalized Blacklisted ones are kept by address.
+type UsdcCompliance struct {
+	rc   *redis.Client
+	usdc *contract.Usdc
+}
+
+func newUsdcCompliance(ec *ethclient.Client, rc *redis.Client) *UsdcCompliance {
+	usdc, err := contract.NewUsdc(common.HexToAddress(config.Cfg.Contract.UsdcAddress), ec)
+	if err != nil {
+		log.Error("new usdc err : ", err)
+	}
+	return &UsdcCompliance{
+		rc:   rc,
+		usdc: usdc,
+	}
+}
+
+func (uc *UsdcCompliance) mappings() map[string]EventMapping {
+	blacklist := EventMapping{
+		Topic:         game.USDCCOMPLIANCETOPIC,
+		FinalizedOnly: true,
+		Handle: func(ev *DecodedEvent) {
+			account := strings.ToLower(ev.Address("_account").Hex())
+			uc.rc.Del(usdcBlacklistedPrefix + account)
+			if ev.Stage != stageFinalized.String() {
+				return
+			}
+			if ev.Event == "Blacklisted" {
+				uc.rc.HSet(usdcBlacklistKey, account, ev.BlockNumber)
+			} else {
+				uc.rc.HDel(usdcBlacklistKey, account)
+			}
+		},
+	}
+	pause := EventMapping{
+		Topic:         game.USDCCOMPLIANCETOPIC,
+		FinalizedOnly: true,
+		Handle: func(ev *DecodedEvent) {
+			uc.rc.Del(usdcPausedKey)
+		},
+	}
+	return map[string]EventMapping{
+		"Blacklisted":   blacklist,
+		"UnBlacklisted": blacklist,
+		"Pause":         pause,
+		"Unpause":       pause,
+	}
+}
+
+func (uc *UsdcCompliance) paused() (bool, error) {
+	if v, err := uc.rc.Get(usdcPausedKey).Result(); err == nil {
+		return v == "1", nil
+	}
+	paused, err := uc.usdc.Paused(nil)
+	if err != nil {
+		return false, err
+	}
+	uc.rc.Set(usdcPausedKey, boolFlag(paused), usdcStateDuration)
+	return paused, nil
+}
+
+func (uc *UsdcCompliance) blacklisted(addr string) (bool, error) {
+	addr = strings.ToLower(addr)
+	if uc.rc.HExists(usdcBlacklistKey, addr).Val() {
+		return true, nil
+	}
+	if v, err := uc.rc.Get(usdcBlacklistedPrefix + addr).Result(); err == nil {
+		return v == "1", nil
+	}
+	blacklisted, err := uc.usdc.IsBlacklisted(nil, common.HexToAddress(addr))
+	if err != nil {
+		return false, err
+	}
+	uc.rc.Set(usdcBlacklistedPrefix+addr, boolFlag(blacklisted), usdcStateDuration)
+	return blacklisted, nil
+}
+
+// checkWithdraw reports why a usdc withdrawal to addr would revert, the
+// vault withdraw endpoint refuses those before sending them.
+func (uc *UsdcCompliance) checkWithdraw(addr string) error {
+	paused, err := uc.paused()
+	if err != nil {
+		return err
+	}
+	if paused {
+		return ErrorUsdcPaused
+	}
+	blacklisted, err := uc.blacklisted(addr)
+	if err != nil {
+		return err
+	}
+	if blacklisted {
+		return ErrorUsdcBlacklisted
+	}
+	return nil
+}
+
+// flag marks a usdc transfer whose counterpart is blacklisted, the sender of
+// a recharge or the recipient of a withdrawal.
+func (uc *UsdcCompliance) flag(tx *ERC20Tx) {
+	counterpart := tx.To
+	if checkRecharge(int(tx.TxType)) {
+		counterpart = tx.From
+	}
+	blacklisted, err := uc.blacklisted(counterpart)
+	if err != nil {
+		log.Errorf("query usdc blacklist : %s, err : %+v", counterpart, err)
+		return
+	}
+	tx.Blacklisted = blacklisted
+}
+
+func boolFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func (bl *BscListener) QueryUsdcStatus(c *gin.Context) {
+	var service usdcStatusService
+	if err := c.ShouldBind(&service); err == nil && (service.Address == "" || common.IsHexAddress(service.Address)) {
+		res := bl.queryUsdcStatus(service.Address)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
+
+func (bl *BscListener) queryUsdcStatus(address string) serializer.Response {
+	paused, err := bl.usdc.paused()
+	if err != nil {
+		return serializer.Response{
+			Code:  500,
+			Msg:   "chain node err ",
+			Error: err.Error(),
+		}
+	}
+	status := UsdcStatus{
+		Paused:       paused,
+		Address:      address,
+		Withdrawable: !paused,
+	}
+	if paused {
+		status.Reason = ErrorUsdcPaused.Error()
+	}
+	if address != "" {
+		if status.Blacklisted, err = bl.usdc.blacklisted(address); err != nil {
+			return serializer.Response{
+				Code:  500,
+				Msg:   "chain node err ",
+				Error: err.Error(),
+			}
+		}
+		status.BlacklistedBlock, _ = bl.rc.HGet(usdcBlacklistKey, strings.ToLower(address)).Uint64()
+		if status.Blacklisted {
+			status.Withdrawable = false
+			status.Reason = ErrorUsdcBlacklisted.Error()
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: status,
+	}
+}
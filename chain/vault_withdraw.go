@@ -0,0 +1,76 @@
+package chain
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gin-gonic/gin"
+	"spike-blockchain-server/config"
+	"spike-blockchain-server/serializer"
+)
+
+type vaultWithdrawService struct {
+	// Token is skk, sks or usdc.
+	Token     string `json:"token" binding:"required"`
+	Recipient string `json:"recipient" binding:"required"`
+	// Amount is in whole token units.
+	Amount string `json:"amount" binding:"required"`
+}
+
+// withdrawFromVault sends a token withdrawal out of the game vault with the
+// signer. A usdc withdrawal that would revert on a paused token or a
+// blacklisted recipient is refused before it is sent.
+func (bl *BscListener) withdrawFromVault(service vaultWithdrawService) serializer.Response {
+	tokens, err := parseBalanceTokens([]string{service.Token})
+	if err != nil || tokens[0].tp == bnb || !common.IsHexAddress(service.Recipient) || service.Recipient == emptyAddress {
+		return serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		}
+	}
+	tp := tokens[0].tp
+	amount, err := bl.builder.amount(tp, service.Amount)
+	if err != nil || amount.Sign() <= 0 {
+		return serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		}
+	}
+	if tp == usdc {
+		if err := bl.usdc.checkWithdraw(service.Recipient); err != nil {
+			return serializer.Response{
+				Code:  500,
+				Msg:   err.Error(),
+				Error: err.Error(),
+			}
+		}
+	}
+	vault := bind.NewBoundContract(common.HexToAddress(config.Cfg.Contract.GameVaultAddress), getABI(GameVaultABI), bl.ec, bl.ec, bl.ec)
+	tx, err := bl.signer.Transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return vault.Transact(opts, "withdraw", common.HexToAddress(approvalContract(tp)), common.HexToAddress(service.Recipient), amount)
+	})
+	if err != nil {
+		log.Error("send vault withdraw tx err : ", err)
+		return serializer.Response{
+			Code:  500,
+			Error: err.Error(),
+		}
+	}
+	return serializer.Response{
+		Code: 200,
+		Data: tx.Hash().Hex(),
+	}
+}
+
+func (bl *BscListener) WithdrawFromVault(c *gin.Context) {
+	var service vaultWithdrawService
+	if err := c.ShouldBind(&service); err == nil {
+		res := bl.withdrawFromVault(service)
+		c.JSON(200, res)
+	} else {
+		c.JSON(500, serializer.Response{
+			Code: 500,
+			Msg:  ErrorParam.Error(),
+		})
+	}
+}
@@ -16,37 +16,82 @@ func Init() {
 	path, ok := os.LookupEnv("CONFIG_PATH")
 	if !ok {
 		panic("config path is not assign")
-		return
 	}
 	file, err := os.Open(path)
 	switch {
 	case os.IsNotExist(err):
 		panic("config is not exist")
-		return
 	case err != nil:
 		panic("config path error")
-		return
 	}
 	_, err = toml.NewDecoder(file).Decode(&Cfg)
 	if err != nil {
 		panic("init config err")
-		return
 	}
 	log.Infof("cfg : %+v", Cfg)
 	cache.Redis(Cfg.Redis.Address, Cfg.Redis.Password)
 }
 
 type Config struct {
-	Moralis  Moralis  `toml:"moralis"`
-	BscScan  BscScan  `toml:"bscscan"`
-	Redis    Redis    `toml:"redis"`
-	Kafka    Kafka    `toml:"kafka"`
-	Contract Contract `toml:"contract"`
-	Chain    Chain    `toml:"chain"`
+	Moralis      Moralis      `toml:"moralis"`
+	BscScan      BscScan      `toml:"bscscan"`
+	Redis        Redis        `toml:"redis"`
+	Kafka        Kafka        `toml:"kafka"`
+	Contract     Contract     `toml:"contract"`
+	Chain        Chain        `toml:"chain"`
+	Confirmation Confirmation `toml:"confirmation"`
+	EventBus     EventBus     `toml:"event_bus"`
+	Events       []Event      `toml:"events"`
+	Signer       Signer       `toml:"signer"`
+	Resolver     Resolver     `toml:"resolver"`
+	Snapshot     Snapshot     `toml:"snapshot"`
+	TxTrack      TxTrack      `toml:"tx_track"`
 }
 
 type Chain struct {
-	NodeAddress string `toml:"node_address""`
+	NodeAddress string `toml:"node_address"`
+	// ArchiveNodeAddress serves historical state, NodeAddress when empty.
+	ArchiveNodeAddress string   `toml:"archive_node_address"`
+	WatchAddresses     []string `toml:"watch_addresses"`
+}
+
+// Confirmation holds the number of blocks a transfer must be buried under
+// before its confirmed event is published. Tokens is keyed by token short
+// name (governanceToken, gameToken, usdc, bnb, gameVault, gameNft).
+type Confirmation struct {
+	Default uint64            `toml:"default"`
+	Tokens  map[string]uint64 `toml:"tokens"`
+}
+
+// EventBus configures the in-process block event bus. Overflow is one of
+// block, drop-oldest or spill.
+type EventBus struct {
+	QueueSize int    `toml:"queue_size"`
+	Overflow  string `toml:"overflow"`
+}
+
+// Event publishes a contract event on a kafka topic without code changes.
+// Contract is the token short name, Event the ABI event name and Fields
+// optionally renames ABI argument names in the published message.
+type Event struct {
+	Contract string            `toml:"contract"`
+	Event    string            `toml:"event"`
+	Topic    string            `toml:"topic"`
+	Fields   map[string]string `toml:"fields"`
+}
+
+// Signer is the hex private key admin transactions are sent with, the admin
+// endpoints are disabled while it is empty.
+type Signer struct {
+	PrivateKey string `toml:"private_key"`
+}
+
+// Resolver lists the gateways token uris are fetched through, in order of
+// preference. Empty lists use public gateways.
+type Resolver struct {
+	IpfsGateways    []string `toml:"ipfs_gateways"`
+	ArweaveGateways []string `toml:"arweave_gateways"`
+	TimeoutMs       int64    `toml:"timeout_ms"`
 }
 
 type Moralis struct {
@@ -74,4 +119,23 @@ type Contract struct {
 	GameTokenAddress       string `toml:"game_token_address"`
 	GameVaultAddress       string `toml:"game_vault_address"`
 	UsdcAddress            string `toml:"usdc_address"`
+	// Multicall3Address defaults to the canonical Multicall3 deployment.
+	Multicall3Address string `toml:"multicall3_address"`
+	// GameNftDeployBlock is where the nft ownership backfill starts.
+	GameNftDeployBlock uint64 `toml:"game_nft_deploy_block"`
+	// The token deploy blocks are where holder snapshots start replaying.
+	GovernanceTokenDeployBlock uint64 `toml:"governance_token_deploy_block"`
+	GameTokenDeployBlock       uint64 `toml:"game_token_deploy_block"`
+}
+
+// Snapshot lists the addresses left out of holder snapshots besides the
+// zero, burn and vault addresses, e.g. the LP pools.
+type Snapshot struct {
+	Exclude []string `toml:"exclude"`
+}
+
+// TxTrack lists the hosts tx tracking webhooks may be posted to, callbacks
+// are refused while it is empty. The hosts must resolve to public addresses.
+type TxTrack struct {
+	CallbackHosts []string `toml:"callback_hosts"`
 }
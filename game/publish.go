@@ -1,4 +1,4 @@
-package (game
+package game
 
 import (
 	"github.com/Shopify/sarama"
@@ -10,10 +10,18 @@ import (
 var log = logger.Logger("game")
 
 const (
-	ERC20TXTOPIC    = "ack_erc20tx"
-	ERC721TXTOPIC   = "ack_erc721tx"
-	RECHARGETXTOPIC = "recharge"
-	IMPORTNFTTOPIC  = "import_nft"
+	ERC20TXTOPIC          = "ack_erc20tx"
+	ERC721TXTOPIC         = "ack_erc721tx"
+	RECHARGETXTOPIC       = "recharge"
+	IMPORTNFTTOPIC        = "import_nft"
+	TXSEENTOPIC           = "tx_seen"
+	TXCONFIRMEDTOPIC      = "tx_confirmed"
+	PENDINGDEPOSITTOPIC   = "pending_deposit"
+	NFTRENTALTOPIC        = "nft_rental"
+	NFTRENTALEXPIREDTOPIC = "nft_rental_expired"
+	NFTMINTTOPIC          = "nft_mint"
+	USDCCOMPLIANCETOPIC   = "usdc_compliance"
+	TXTRACKTOPIC          = "tx_track"
 )
 
 type Msg struct {
@@ -18,6 +18,8 @@ require (
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
 )
 
+require github.com/holiman/uint256 v1.2.0 // indirect
+
 require (
 	github.com/BurntSushi/toml v1.2.0
 	github.com/StackExchange/wmi v0.0.0-20180116203802-5d049714c4a6 // indirect
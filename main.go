@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	logger "github.com/ipfs/go-log"
+	"os"
 	"spike-blockchain-server/chain"
 	"spike-blockchain-server/config"
 	"spike-blockchain-server/server"
@@ -10,6 +12,13 @@ import (
 func main() {
 	logger.SetLogLevel("*", "INFO")
 	config.Init()
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		if err := runSnapshot(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	bscClient, err := chain.NewBscListener(config.Cfg.Chain.NodeAddress, config.Cfg.Contract.GameVaultAddress)
 	if err != nil {
 		//log
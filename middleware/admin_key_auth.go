@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"spike-blockchain-server/cache"
+	"spike-blockchain-server/serializer"
+)
+
+// AdminKeyAuth guards the endpoints that send transactions with the server
+// signer, admin keys are kept apart from the api keys.
+func AdminKeyAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params adminParams
+		if err := c.ShouldBindHeader(&params); err != nil {
+			c.JSON(200, serializer.Response{
+				Code:  101,
+				Error: "header: admin_key is required",
+			})
+			c.Abort()
+		} else {
+			res, _ := cache.RedisClient.SIsMember("admin_key", params.AdminKey).Result()
+			if res {
+				c.Next()
+			} else {
+				c.JSON(200, serializer.Response{
+					Code:  101,
+					Error: "header: admin_key doesn't exist",
+				})
+				c.Abort()
+			}
+		}
+	}
+}
+
+type adminParams struct {
+	AdminKey string `header:"admin_key" binding:"required"`
+}
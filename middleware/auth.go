@@ -41,14 +41,25 @@ type ethParams struct {
 }
 
 func (params *ethParams) verify() bool {
-	sig := hexutil.MustDecode(params.Sign)
-	msg := accounts.TextHash([]byte(params.Nonce))
-	sig[crypto.RecoveryIDOffset] -= 27
+	return VerifySignature(params.Addr, params.Nonce, params.Sign)
+}
+
+// VerifySignature reports whether sign is the personal_sign signature of
+// nonce by addr.
+func VerifySignature(addr, nonce, sign string) bool {
+	sig, err := hexutil.Decode(sign)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return false
+	}
+	msg := accounts.TextHash([]byte(nonce))
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
 
 	recovered, err := crypto.SigToPub(msg, sig)
 	if err != nil {
 		return false
 	}
 	recoveredAddr := crypto.PubkeyToAddress(*recovered)
-	return strings.ToLower(params.Addr) == strings.ToLower(recoveredAddr.String())
+	return strings.ToLower(addr) == strings.ToLower(recoveredAddr.String())
 }
@@ -0,0 +1,302 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/ipfs/go-log"
+	"golang.org/x/xerrors"
+
+	"spike-blockchain-server/config"
+)
+
+var log = logger.Logger("resolver")
+
+const (
+	defaultTimeout  = 10 * time.Second
+	defaultMaxSize  = 10 << 20
+	failuresToTrip  = 3
+	unhealthyPeriod = time.Minute
+)
+
+var (
+	defaultIpfsGateways    = []string{"https://ipfs.io", "https://cloudflare-ipfs.com", "https://dweb.link"}
+	defaultArweaveGateways = []string{"https://arweave.net"}
+
+	// JSONTypes are the content types metadata is accepted with, gateways
+	// often serve json files as text/plain or octet-stream.
+	JSONTypes = []string{"application/json", "text/plain", "application/octet-stream"}
+)
+
+var ErrTooLarge = xerrors.New("content exceeds size limit")
+
+type Resource struct {
+	Body        []byte
+	ContentType string
+	Source      string
+}
+
+// Limits restricts what Resolve accepts. ContentTypes are media type prefixes,
+// e.g. image/ accepts any image, an empty list accepts everything.
+type Limits struct {
+	MaxSize      int64
+	ContentTypes []string
+}
+
+type Options struct {
+	IpfsGateways    []string
+	ArweaveGateways []string
+	Timeout         time.Duration
+}
+
+type GatewayHealth struct {
+	Gateway     string `json:"gateway"`
+	Healthy     bool   `json:"healthy"`
+	Successes   uint64 `json:"successes"`
+	Failures    uint64 `json:"failures"`
+	LastError   string `json:"lastError,omitempty"`
+	LastLatency int64  `json:"lastLatency"`
+}
+
+type gateway struct {
+	url            string
+	successes      uint64
+	failures       uint64
+	consecutive    int
+	unhealthyUntil time.Time
+	lastError      string
+	lastLatency    time.Duration
+}
+
+// Resolver fetches token uris. Ipfs and arweave content is tried on every
+// configured gateway in order, gateways that keep failing are moved to the
+// back for a while.
+type Resolver struct {
+	ipfs    []*gateway
+	arweave []*gateway
+	timeout time.Duration
+	client  *http.Client
+	lk      sync.Mutex
+}
+
+func New(opts Options) *Resolver {
+	if len(opts.IpfsGateways) == 0 {
+		opts.IpfsGateways = defaultIpfsGateways
+	}
+	if len(opts.ArweaveGateways) == 0 {
+		opts.ArweaveGateways = defaultArweaveGateways
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	return &Resolver{
+		ipfs:    newGateways(opts.IpfsGateways),
+		arweave: newGateways(opts.ArweaveGateways),
+		timeout: opts.Timeout,
+		client:  &http.Client{},
+	}
+}
+
+func newGateways(urls []string) []*gateway {
+	gateways := make([]*gateway, 0, len(urls))
+	for _, u := range urls {
+		gateways = append(gateways, &gateway{url: strings.TrimSuffix(u, "/")})
+	}
+	return gateways
+}
+
+var (
+	defaultResolver *Resolver
+	defaultOnce     sync.Once
+)
+
+// Default is the resolver built from the [resolver] config, the pinata
+// gateway, when set, is tried before the configured ipfs gateways.
+func Default() *Resolver {
+	defaultOnce.Do(func() {
+		cfg := config.Cfg.Resolver
+		ipfs := cfg.IpfsGateways
+		if len(ipfs) == 0 {
+			ipfs = defaultIpfsGateways
+		}
+		if gw := os.Getenv("PINATA_GATEWAY"); gw != "" {
+			ipfs = append([]string{"https://" + gw}, ipfs...)
+		}
+		defaultResolver = New(Options{
+			IpfsGateways:    ipfs,
+			ArweaveGateways: cfg.ArweaveGateways,
+			Timeout:         time.Duration(cfg.TimeoutMs) * time.Millisecond,
+		})
+	})
+	return defaultResolver
+}
+
+func (r *Resolver) Resolve(ctx context.Context, uri string, limits Limits) (*Resource, error) {
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = defaultMaxSize
+	}
+	loc, err := Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	switch loc.Scheme {
+	case SchemeData:
+		res, err := decodeData(loc.URL)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(res.Body)) > limits.MaxSize {
+			return nil, ErrTooLarge
+		}
+		if !accepted(res.ContentType, limits.ContentTypes) {
+			return nil, fmt.Errorf("content type %s not accepted", res.ContentType)
+		}
+		return res, nil
+	case SchemeIPFS:
+		return r.fromGateways(ctx, r.ipfs, "/ipfs/"+loc.Path, loc.URL, limits)
+	case SchemeArweave:
+		return r.fromGateways(ctx, r.arweave, "/"+loc.Path, "", limits)
+	default:
+		return r.get(ctx, loc.URL, limits)
+	}
+}
+
+// fromGateways tries the original url first, if the uri had one, and then
+// every gateway, healthy ones first.
+func (r *Resolver) fromGateways(ctx context.Context, gateways []*gateway, path, original string, limits Limits) (*Resource, error) {
+	var lastErr error
+	if original != "" {
+		res, err := r.get(ctx, original, limits)
+		if err == nil {
+			return res, nil
+		}
+		lastErr = err
+	}
+	for _, gw := range r.ordered(gateways) {
+		if original != "" && strings.HasPrefix(original, gw.url+"/") {
+			continue
+		}
+		start := time.Now()
+		res, err := r.get(ctx, gw.url+path, limits)
+		r.report(gw, time.Since(start), err)
+		if err == nil {
+			return res, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if lastErr == nil {
+		lastErr = xerrors.New("no gateway configured")
+	}
+	return nil, lastErr
+}
+
+func (r *Resolver) get(ctx context.Context, url string, limits Limits) (*Resource, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("get %s status : %d", url, resp.StatusCode)
+	}
+	if resp.ContentLength > limits.MaxSize {
+		return nil, ErrTooLarge
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !accepted(contentType, limits.ContentTypes) {
+		return nil, fmt.Errorf("content type %s not accepted", contentType)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limits.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limits.MaxSize {
+		return nil, ErrTooLarge
+	}
+	return &Resource{
+		Body:        body,
+		ContentType: contentType,
+		Source:      url,
+	}, nil
+}
+
+func accepted(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	for _, a := range allowed {
+		if strings.HasPrefix(mediaType, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Resolver) ordered(gateways []*gateway) []*gateway {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	now := time.Now()
+	ordered := append([]*gateway{}, gateways...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return !ordered[i].unhealthyUntil.After(now) && ordered[j].unhealthyUntil.After(now)
+	})
+	return ordered
+}
+
+func (r *Resolver) report(gw *gateway, latency time.Duration, err error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	gw.lastLatency = latency
+	if err == nil {
+		gw.successes++
+		gw.consecutive = 0
+		gw.unhealthyUntil = time.Time{}
+		return
+	}
+	gw.failures++
+	gw.consecutive++
+	gw.lastError = err.Error()
+	if gw.consecutive >= failuresToTrip {
+		gw.unhealthyUntil = time.Now().Add(unhealthyPeriod)
+		log.Warnf("gateway %s is unhealthy after %d failures, last err : %+v", gw.url, gw.consecutive, err)
+	}
+}
+
+func (r *Resolver) Health() []GatewayHealth {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	now := time.Now()
+	health := make([]GatewayHealth, 0, len(r.ipfs)+len(r.arweave))
+	for _, gw := range append(append([]*gateway{}, r.ipfs...), r.arweave...) {
+		health = append(health, GatewayHealth{
+			Gateway:     gw.url,
+			Healthy:     !gw.unhealthyUntil.After(now),
+			Successes:   gw.successes,
+			Failures:    gw.failures,
+			LastError:   gw.lastError,
+			LastLatency: gw.lastLatency.Milliseconds(),
+		})
+	}
+	return health
+}
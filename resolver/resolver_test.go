@@ -0,0 +1,103 @@
+package resolver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const cid = "QmfNxKabtsdNgdLCib1AXaVrMvyLaFD2UbMmsmoRNJTU8w"
+
+func TestParse(t *testing.T) {
+	loc, err := Parse("ipfs://" + cid + "/1.json")
+	assert.NoError(t, err)
+	assert.Equal(t, SchemeIPFS, loc.Scheme)
+	assert.Equal(t, cid+"/1.json", loc.Path)
+
+	loc, err = Parse("ipfs://ipfs/" + cid)
+	assert.NoError(t, err)
+	assert.Equal(t, cid, loc.Path)
+
+	loc, err = Parse("https://gateway.pinata.cloud/ipfs/" + cid)
+	assert.NoError(t, err)
+	assert.Equal(t, SchemeIPFS, loc.Scheme)
+	assert.Equal(t, "https://gateway.pinata.cloud/ipfs/"+cid, loc.URL)
+
+	loc, err = Parse("bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi")
+	assert.NoError(t, err)
+	assert.Equal(t, SchemeIPFS, loc.Scheme)
+
+	loc, err = Parse("ar://bNbA3TEQVL60xlgCcqdz4ZPHFZ711cZ3hmkpGttDt_U")
+	assert.NoError(t, err)
+	assert.Equal(t, SchemeArweave, loc.Scheme)
+
+	loc, err = Parse("https://api.spike.game/nft/1")
+	assert.NoError(t, err)
+	assert.Equal(t, SchemeHTTP, loc.Scheme)
+
+	_, err = Parse("ipfs://not-a-cid")
+	assert.Error(t, err)
+	_, err = Parse("ftp://example.com/1.json")
+	assert.Error(t, err)
+}
+
+func TestResolveData(t *testing.T) {
+	r := New(Options{})
+	res, err := r.Resolve(context.Background(), "data:application/json;base64,eyJuYW1lIjoiU291bCAjMSJ9", Limits{ContentTypes: JSONTypes})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"Soul #1"}`, string(res.Body))
+	assert.Equal(t, "application/json", res.ContentType)
+
+	res, err = r.Resolve(context.Background(), "data:application/json,%7B%22name%22%3A%22Soul%22%7D", Limits{})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"Soul"}`, string(res.Body))
+
+	_, err = r.Resolve(context.Background(), "data:image/png;base64,iVBORw0KGgo=", Limits{ContentTypes: JSONTypes})
+	assert.Error(t, err)
+}
+
+func TestResolveGatewayFallback(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/ipfs/"+cid, req.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"Soul #1"}`))
+	}))
+	defer up.Close()
+
+	r := New(Options{IpfsGateways: []string{down.URL, up.URL}, Timeout: time.Second})
+	for i := 0; i < failuresToTrip; i++ {
+		res, err := r.Resolve(context.Background(), "ipfs://"+cid, Limits{ContentTypes: JSONTypes})
+		assert.NoError(t, err)
+		assert.Equal(t, up.URL+"/ipfs/"+cid, res.Source)
+	}
+	health := r.Health()
+	assert.False(t, health[0].Healthy)
+	assert.True(t, health[1].Healthy)
+	assert.Equal(t, up.URL, r.ordered(r.ipfs)[0].url)
+}
+
+func TestResolveLimits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(strings.Repeat("a", 100)))
+	}))
+	defer srv.Close()
+
+	r := New(Options{})
+	_, err := r.Resolve(context.Background(), srv.URL, Limits{MaxSize: 10})
+	assert.Equal(t, ErrTooLarge, err)
+	_, err = r.Resolve(context.Background(), srv.URL, Limits{ContentTypes: JSONTypes})
+	assert.Error(t, err)
+	res, err := r.Resolve(context.Background(), srv.URL, Limits{})
+	assert.NoError(t, err)
+	assert.Len(t, res.Body, 100)
+}
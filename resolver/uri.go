@@ -0,0 +1,120 @@
+package resolver
+
+import (
+	"encoding/base64"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+type Scheme int
+
+const (
+	SchemeHTTP Scheme = iota
+	SchemeIPFS
+	SchemeArweave
+	SchemeData
+)
+
+var (
+	ErrUnsupportedURI = xerrors.New("unsupported uri")
+	ErrInvalidCID     = xerrors.New("invalid cid")
+
+	cidV0     = regexp.MustCompile(`^Qm[1-9A-HJ-NP-Za-km-z]{44}$`)
+	cidV1     = regexp.MustCompile(`^b[a-z2-7]{58,}$`)
+	arweaveId = regexp.MustCompile(`^[a-zA-Z0-9_-]{43}$`)
+)
+
+// Location is a parsed token uri. For ipfs and arweave Path is the content
+// id followed by the optional path inside it, it is joined to each gateway.
+type Location struct {
+	Scheme Scheme
+	Path   string
+	URL    string
+}
+
+// Parse recognises ipfs://, ar://, data: and http(s) uris. Http uris that
+// point at an ipfs gateway are turned into ipfs locations so that the other
+// gateways can be tried when that one is down.
+func Parse(uri string) (Location, error) {
+	uri = strings.TrimSpace(uri)
+	switch {
+	case strings.HasPrefix(uri, "ipfs://"):
+		return ipfsLocation(strings.TrimPrefix(strings.TrimPrefix(uri, "ipfs://"), "ipfs/"))
+	case strings.HasPrefix(uri, "ar://"):
+		path := strings.TrimPrefix(uri, "ar://")
+		if !arweaveId.MatchString(strings.SplitN(path, "/", 2)[0]) {
+			return Location{}, ErrUnsupportedURI
+		}
+		return Location{Scheme: SchemeArweave, Path: path}, nil
+	case strings.HasPrefix(uri, "data:"):
+		return Location{Scheme: SchemeData, URL: uri}, nil
+	case strings.HasPrefix(uri, "http://"), strings.HasPrefix(uri, "https://"):
+		u, err := url.Parse(uri)
+		if err != nil {
+			return Location{}, err
+		}
+		if i := strings.Index(u.Path, "/ipfs/"); i >= 0 {
+			if loc, err := ipfsLocation(u.Path[i+len("/ipfs/"):]); err == nil {
+				loc.URL = uri
+				return loc, nil
+			}
+		}
+		return Location{Scheme: SchemeHTTP, URL: uri}, nil
+	}
+	if loc, err := ipfsLocation(uri); err == nil {
+		return loc, nil
+	}
+	return Location{}, ErrUnsupportedURI
+}
+
+func ipfsLocation(path string) (Location, error) {
+	cid := strings.SplitN(path, "/", 2)[0]
+	if !cidV0.MatchString(cid) && !cidV1.MatchString(cid) {
+		return Location{}, ErrInvalidCID
+	}
+	return Location{Scheme: SchemeIPFS, Path: path}, nil
+}
+
+// decodeData decodes a data uri, data:[<mediatype>][;base64],<data>.
+func decodeData(uri string) (*Resource, error) {
+	meta, data, ok := cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok {
+		return nil, ErrUnsupportedURI
+	}
+	contentType := "text/plain"
+	isBase64 := strings.HasSuffix(meta, ";base64")
+	meta = strings.TrimSuffix(meta, ";base64")
+	if meta != "" {
+		contentType = meta
+	}
+	var body []byte
+	var err error
+	if isBase64 {
+		body, err = base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			body, err = base64.RawStdEncoding.DecodeString(data)
+		}
+	} else {
+		var s string
+		s, err = url.PathUnescape(data)
+		body = []byte(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Resource{
+		Body:        body,
+		ContentType: contentType,
+		Source:      "data:",
+	}, nil
+}
+
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -26,6 +26,8 @@ func NewRouter(chainApi *chain.BscListener) *gin.Engine {
 		nft := v1.Group("/nft")
 		{
 			nft.GET("all", api.FindAllNFTs)
+			nft.POST("mint", middleware.AdminKeyAuth(), chainApi.MintNft)
+			nft.GET("mint/job", chainApi.QueryMintJob)
 		}
 
 		ipfs := v1.Group("/ipfs")
@@ -35,22 +37,60 @@ func NewRouter(chainApi *chain.BscListener) *gin.Engine {
 			ipfs.POST("pin/jsonfile", api.PinJSONFile)
 			ipfs.GET("file", api.DownloadFile)
 			ipfs.GET("json", api.DownloadJSON)
+			ipfs.GET("gateways", api.GatewayHealth)
 		}
 		chain := v1.Group("/chain")
 		{
 			chain.POST("tx/isPending", chainApi.QueryTxIsPendingByHash)
 			chain.POST("tx/status", chainApi.QueryTxStatusByHash)
+			chain.GET("tx/pending", chainApi.QueryPendingTx)
 			chain.POST("nft/metadata", chainApi.QueryNftMetadata)
 			chain.POST("nft/tokenUri", chainApi.QueryNftTokenUri)
 			chain.POST("nft/type", chainApi.QueryWalletAddrNft)
 			chain.POST("nft/list", chainApi.QueryNftListByType)
+			chain.GET("nft/rental", chainApi.QueryNftRental)
+			chain.GET("nft/rented", chainApi.QueryNftRented)
+			chain.POST("nft/royalty", chainApi.QueryNftRoyalty)
+			chain.GET("nft/royalties", chainApi.QueryNftRoyalties)
+			chain.GET("nft/stats", chainApi.QueryNftStats)
+			chain.GET("nft/traits", chainApi.QueryNftTraits)
+			chain.GET("nft/rarity", chainApi.QueryNftRarity)
+			chain.GET("tokens", chainApi.QueryTokens)
+			chain.GET("usdc/status", chainApi.QueryUsdcStatus)
+			chain.GET("gas", chainApi.QueryGas)
+			chain.POST("gas", chainApi.QueryGas)
+			chain.POST("tx/track", chainApi.TrackTx)
+			chain.GET("tx/track", chainApi.QueryTrackedTx)
+			chain.GET("gov/proposals", chainApi.QueryProposals)
+			chain.GET("gov/tally", chainApi.QueryProposalTally)
+			chain.GET("gov/power", chainApi.QueryVotingPower)
+			chain.POST("gov/vote", chainApi.SubmitVote)
+			chain.POST("gov/delegate", chainApi.SubmitDelegation)
 			chain.POST("erc20/price", api.FindERC20TokenPrice)
+			chain.GET("eventbus/metrics", chainApi.QueryEventBusMetrics)
 		}
 		wallet := v1.Group("/wallet")
 		{
 			wallet.POST("balance", chainApi.QueryWalletBalance)
+			wallet.POST("portfolio", chainApi.QueryWalletPortfolio)
+			wallet.POST("balances", chainApi.QueryWalletBalances)
 			wallet.POST("erc20", chainApi.ERC20TxRecord)
 			wallet.POST("native", chainApi.NativeTxRecord)
+			wallet.GET("approvals", chainApi.QueryWalletApprovals)
+		}
+		tx := v1.Group("/tx")
+		{
+			tx.POST("build", chainApi.BuildTx)
+			tx.POST("broadcast", chainApi.BroadcastTx)
+		}
+		admin := v1.Group("/admin", middleware.AdminKeyAuth())
+		{
+			admin.POST("nft/royalty/default", chainApi.SetDefaultRoyalty)
+			admin.POST("nft/royalty/token", chainApi.SetTokenRoyalty)
+			admin.POST("snapshot", chainApi.TakeSnapshot)
+			admin.GET("snapshot", chainApi.QuerySnapshot)
+			admin.POST("gov/proposal", chainApi.CreateProposal)
+			admin.POST("vault/withdraw", chainApi.WithdrawFromVault)
 		}
 	}
 	return r
@@ -1,41 +1,42 @@
 package ipfs
 
 import (
-	"os"
-
-	"github.com/go-resty/resty/v2"
+	"context"
 
+	"spike-blockchain-server/resolver"
 	"spike-blockchain-server/serializer"
 )
 
+const downloadMaxSize = 50 << 20
+
 type DownloadService struct {
 	IpfsHash string `form:"ipfs_hash" json:"ipfs_hash" binding:"required"`
 }
 
 func (service *DownloadService) Download() serializer.Response {
-	client := resty.New()
-
-	resp, err := client.R().Get(service.url())
+	res, err := resolver.Default().Resolve(context.Background(), service.uri(), resolver.Limits{
+		MaxSize: downloadMaxSize,
+	})
 	if err != nil {
 		return serializer.Response{
 			Code:  400,
 			Error: err.Error(),
 		}
 	}
-
-	if resp.IsError() {
-		return serializer.Response{
-			Code:  401,
-			Error: resp.String(),
-		}
-	}
 	return serializer.Response{
 		Code: 200,
-		Data: resp.Body(),
-		Msg:  resp.Header().Get("Content-Type"),
+		Data: res.Body,
+		Msg:  res.ContentType,
 	}
 }
 
-func (service *DownloadService) url() string {
-	return PROTOCOL + "://" + os.Getenv("PINATA_GATEWAY") + "/ipfs/" + service.IpfsHash
+func (service *DownloadService) uri() string {
+	return "ipfs://" + service.IpfsHash
+}
+
+func GatewayHealth() serializer.Response {
+	return serializer.Response{
+		Code: 200,
+		Data: resolver.Default().Health(),
+	}
 }
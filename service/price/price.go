@@ -1,23 +1,145 @@
 package price
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/go-resty/resty/v2"
+	logger "github.com/ipfs/go-log"
+
+	"spike-blockchain-server/cache"
 	"spike-blockchain-server/config"
+	"spike-blockchain-server/constants"
+)
+
+var log = logger.Logger("price")
+
+const (
+	pricePrefix   = "price_"
+	priceDuration = time.Minute
+	// WBNB is priced for bnb, moralis only prices erc20 contracts.
+	WBNB = "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c"
 )
 
 type TokenPriceService struct {
 	Token string `json:"token" binding:"required"`
 }
 
+type Price struct {
+	UsdPrice   float64 `json:"usdPrice"`
+	Change24h  float64 `json:"change24h"`
+	UpdateTime int64   `json:"updateTime"`
+}
+
+type moralisPrice struct {
+	UsdPrice          float64 `json:"usdPrice"`
+	PercentChange24hr string  `json:"24hrPercentChange"`
+}
+
 func GetTokenContractAddrByTokenSymbol(token string) (string, error) {
 	switch token {
 	case "skk":
 		return config.Cfg.Contract.GovernanceTokenAddress, nil
 	case "sks":
 		return config.Cfg.Contract.GameTokenAddress, nil
+	case "usdc":
+		return config.Cfg.Contract.UsdcAddress, nil
+	case "bnb":
+		return WBNB, nil
 	case "test":
 		return "0x3EE2200Efb3400fAbB9AacF31297cBdD1d435D47", nil
 	default:
 		return "", errors.New("token type is not supported")
 	}
 }
+
+var (
+	fetchLks = map[string]*sync.Mutex{}
+	lksLk    sync.Mutex
+)
+
+// fetchLk is keyed by contract address, so only supported tokens get a lock.
+func fetchLk(contractAddr string) *sync.Mutex {
+	lksLk.Lock()
+	defer lksLk.Unlock()
+	if _, ok := fetchLks[contractAddr]; !ok {
+		fetchLks[contractAddr] = &sync.Mutex{}
+	}
+	return fetchLks[contractAddr]
+}
+
+// GetPrice returns the usd price of a token symbol. Prices are cached in
+// redis for a minute and concurrent misses share one moralis request.
+func GetPrice(token string) (Price, error) {
+	contractAddr, err := GetTokenContractAddrByTokenSymbol(token)
+	if err != nil {
+		return Price{}, err
+	}
+	if p, ok := cachedPrice(token); ok {
+		return p, nil
+	}
+	lk := fetchLk(contractAddr)
+	lk.Lock()
+	defer lk.Unlock()
+	if p, ok := cachedPrice(token); ok {
+		return p, nil
+	}
+	p, err := queryMoralisPrice(contractAddr)
+	if err != nil {
+		return Price{}, err
+	}
+	val, err := json.Marshal(p)
+	if err != nil {
+		return p, err
+	}
+	cache.RedisClient.Set(pricePrefix+token, string(val), priceDuration)
+	return p, nil
+}
+
+func cachedPrice(token string) (Price, bool) {
+	var p Price
+	val, err := cache.RedisClient.Get(pricePrefix + token).Result()
+	if err != nil {
+		if err != redis.Nil {
+			log.Error("query cached price err : ", err)
+		}
+		return p, false
+	}
+	if err := json.Unmarshal([]byte(val), &p); err != nil {
+		return p, false
+	}
+	return p, true
+}
+
+func queryMoralisPrice(contractAddr string) (Price, error) {
+	log.Infof("query erc20 price url : %s", getUrl(contractAddr))
+	resp, err := resty.New().R().
+		SetHeader("Accept", "application/json").
+		SetHeader("x-api-key", config.Cfg.Moralis.XApiKey).
+		Get(getUrl(contractAddr))
+	if err != nil {
+		return Price{}, err
+	}
+	if resp.IsError() {
+		return Price{}, errors.New(resp.String())
+	}
+	var res moralisPrice
+	if err := json.Unmarshal(resp.Body(), &res); err != nil {
+		return Price{}, err
+	}
+	change, _ := strconv.ParseFloat(res.PercentChange24hr, 64)
+	return Price{
+		UsdPrice:   res.UsdPrice,
+		Change24h:  change,
+		UpdateTime: time.Now().UnixMilli(),
+	}, nil
+}
+
+func getUrl(contractAddr string) string {
+	return fmt.Sprintf("%serc20/%s/price?chain=bsc", constants.MORALIS_API, contractAddr)
+}
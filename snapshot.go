@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"io"
+	"os"
+	"spike-blockchain-server/cache"
+	"spike-blockchain-server/chain"
+	"spike-blockchain-server/config"
+	"strings"
+)
+
+// runSnapshot is the snapshot subcommand, e.g.
+//
+//	spike-blockchain-server snapshot -token skk -block 25000000 -format csv -out skk.csv
+func runSnapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	token := fs.String("token", "skk", "skk, sks or nft")
+	block := fs.Uint64("block", 0, "last block replayed into the snapshot")
+	exclude := fs.String("exclude", "", "comma separated addresses to leave out")
+	format := fs.String("format", "json", "json or csv")
+	out := fs.String("out", "", "output file, stdout when empty")
+	fs.Parse(args)
+	if *block == 0 {
+		return errors.New("snapshot -block is required")
+	}
+
+	ec, err := ethclient.Dial(config.Cfg.Chain.NodeAddress)
+	if err != nil {
+		return err
+	}
+	req := chain.SnapshotRequest{
+		Token:       *token,
+		BlockNumber: *block,
+	}
+	if *exclude != "" {
+		req.Exclude = strings.Split(*exclude, ",")
+	}
+	snapshot, err := chain.NewSnapshotter(ec, cache.RedisClient).Take(req)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "csv" {
+		return snapshot.WriteCSV(w)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(snapshot)
+}